@@ -1,33 +1,61 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/sfkleach/execman/pkg/cache"
 	"github.com/sfkleach/execman/pkg/check"
+	"github.com/sfkleach/execman/pkg/export"
 	"github.com/sfkleach/execman/pkg/forget"
 	initpkg "github.com/sfkleach/execman/pkg/init"
 	"github.com/sfkleach/execman/pkg/install"
 	"github.com/sfkleach/execman/pkg/list"
+	"github.com/sfkleach/execman/pkg/lock"
+	"github.com/sfkleach/execman/pkg/move"
+	"github.com/sfkleach/execman/pkg/policy"
 	"github.com/sfkleach/execman/pkg/remove"
+	"github.com/sfkleach/execman/pkg/rename"
+	"github.com/sfkleach/execman/pkg/run"
+	"github.com/sfkleach/execman/pkg/scope"
+	syncpkg "github.com/sfkleach/execman/pkg/sync"
+	"github.com/sfkleach/execman/pkg/tools"
 	"github.com/sfkleach/execman/pkg/update"
+	"github.com/sfkleach/execman/pkg/use"
+	"github.com/sfkleach/execman/pkg/verify"
 	"github.com/sfkleach/execman/pkg/version"
 	"github.com/spf13/cobra"
 )
 
 var versionFlag bool
+var systemFlag bool
 
 // Install command flags.
 var (
 	installInto               string
 	installYes                bool
 	installIncludePrereleases bool
+	installCompanions         bool
+	installChecksumPolicy     string
+	installSignaturePolicy    string
+	installTrustKey           string
+	installVerifyProvenance   bool
+	installStore              bool
+	installName               string
+	installAliases            []string
+	installReplace            bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "execman",
 	Short: "Execman - Executable manager",
 	Long:  `Execman is a command-line tool for managing executables.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if systemFlag {
+			scope.Set(scope.System)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if versionFlag {
 			if err := version.ShowVersion(false); err != nil {
@@ -51,10 +79,19 @@ var installCmd = &cobra.Command{
 			Into:               installInto,
 			Yes:                installYes,
 			IncludePrereleases: installIncludePrereleases,
+			Companions:         installCompanions,
+			ChecksumPolicy:     installChecksumPolicy,
+			SignaturePolicy:    installSignaturePolicy,
+			TrustKey:           installTrustKey,
+			VerifyProvenance:   installVerifyProvenance,
+			Store:              installStore,
+			Name:               installName,
+			Aliases:            installAliases,
+			Replace:            installReplace,
 		}
 		if err := install.Run(opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 	},
 }
@@ -70,26 +107,59 @@ var adoptCmd = &cobra.Command{
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&versionFlag, "version", false, "Print version information")
+	rootCmd.PersistentFlags().BoolVar(&systemFlag, "system", false, "Manage the system-wide installation instead of the user's")
 
 	// Install command flags.
-	installCmd.Flags().StringVarP(&installInto, "into", "d", "", "Install to specified directory")
+	installCmd.Flags().StringVarP(&installInto, "into", "d", "", "Install to specified directory, or @name for a configured location")
 	installCmd.Flags().BoolVarP(&installYes, "yes", "y", false, "Skip confirmation prompts")
 	installCmd.Flags().BoolVar(&installIncludePrereleases, "include-prereleases", false, "Allow installing prerelease versions")
+	installCmd.Flags().BoolVar(&installCompanions, "companions", false, "Also install completions, man pages and licenses")
+	installCmd.Flags().StringVar(&installChecksumPolicy, "checksum-policy", "", "Checksum policy for this executable: off, warn or require")
+	installCmd.Flags().StringVar(&installSignaturePolicy, "signature-policy", "", "Signature policy for this executable: off, warn or require")
+	installCmd.Flags().StringVar(&installTrustKey, "trust-key", "", "Trust this minisign or GPG public key file in place of the pinned key")
+	installCmd.Flags().BoolVar(&installVerifyProvenance, "verify-provenance", false, "Require SLSA build provenance from the source repository")
+	installCmd.Flags().StringVar(&installName, "name", "", "Install the executable under this name instead of the repository name")
+	installCmd.Flags().StringSliceVar(&installAliases, "alias", nil, "Also make the executable available under this name, as a symlink (repeatable)")
+	installCmd.Flags().BoolVar(&installReplace, "replace", false, "Replace an executable of the same name installed from another source")
+	installCmd.Flags().BoolVar(&installStore, "store", false, "Keep this version in the versioned store, beside the installed one")
 
 	rootCmd.AddCommand(version.NewVersionCommand())
 	rootCmd.AddCommand(initpkg.NewInitCommand())
 	rootCmd.AddCommand(installCmd)
 	rootCmd.AddCommand(list.NewListCommand())
 	rootCmd.AddCommand(check.NewCheckCommand())
+	rootCmd.AddCommand(verify.NewVerifyCommand())
 	rootCmd.AddCommand(update.NewUpdateCommand())
+	rootCmd.AddCommand(use.NewUseCommand())
+	rootCmd.AddCommand(move.NewMoveCommand())
+	rootCmd.AddCommand(rename.NewRenameCommand())
+	rootCmd.AddCommand(syncpkg.NewSyncCommand())
+	rootCmd.AddCommand(lock.NewLockCommand())
+	rootCmd.AddCommand(export.NewExportCommand())
+	rootCmd.AddCommand(export.NewImportCommand())
+	rootCmd.AddCommand(tools.NewToolsCommand())
+	rootCmd.AddCommand(tools.NewExecCommand())
+	rootCmd.AddCommand(run.NewRunCommand())
 	rootCmd.AddCommand(remove.NewRemoveCommand())
 	rootCmd.AddCommand(forget.NewForgetCommand())
+	rootCmd.AddCommand(cache.NewCacheCommand())
+	rootCmd.AddCommand(policy.NewPolicyCommand())
 	rootCmd.AddCommand(adoptCmd)
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the process exit code for an error: the code it carries,
+// such as that of a policy violation, or 1.
+func exitCode(err error) int {
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
 	}
+	return 1
 }
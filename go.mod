@@ -2,9 +2,15 @@ module github.com/sfkleach/execman
 
 go 1.24.2
 
-require github.com/spf13/cobra v1.10.2
+require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/crypto v0.38.0
+)
 
 require (
+	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 )
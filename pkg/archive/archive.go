@@ -3,17 +3,103 @@ package archive
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// ErrLimitExceeded is returned when an archive breaches one of its Limits.
+var ErrLimitExceeded = errors.New("archive resource limit exceeded")
+
+// Limits bounds the resources that extracting an archive may consume, so that
+// a malicious or broken archive cannot fill the disk. A zero or negative value
+// means that dimension is unlimited.
+type Limits struct {
+	MaxTotalSize int64 `json:"max_uncompressed_size,omitempty"`
+	MaxEntrySize int64 `json:"max_entry_size,omitempty"`
+	MaxEntries   int   `json:"max_entries,omitempty"`
+}
+
+// DefaultLimits are generous enough for any reasonable release archive.
+var DefaultLimits = Limits{
+	MaxTotalSize: 2 << 30,
+	MaxEntrySize: 1 << 30,
+	MaxEntries:   20000,
+}
+
 // ExtractBinary extracts a binary from a tar.gz archive.
-func ExtractBinary(archivePath, destPath string) error {
+func ExtractBinary(archivePath, destPath string, limits Limits) error {
+	// Get the directory of the destination to create a root scope.
+	destDir := filepath.Dir(destPath)
+	destName := filepath.Base(destPath)
+
+	// Create a scoped root for the destination directory to prevent path traversal.
+	root, err := os.OpenRoot(destDir)
+	if err != nil {
+		return fmt.Errorf("failed to create root scope: %w", err)
+	}
+	defer root.Close()
+
+	// Find and extract the first executable file.
+	var extracted bool
+	err = walkTarGz(archivePath, limits, func(header *tar.Header, r io.Reader) (bool, error) {
+		// Skip anything that is not an executable regular file.
+		if header.Typeflag != tar.TypeReg || header.Mode&0111 == 0 {
+			return false, nil
+		}
+
+		// Extract this file using scoped root.
+		destFile, err := root.OpenFile(destName, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+		if err != nil {
+			return false, fmt.Errorf("failed to create destination file: %w", err)
+		}
+		defer destFile.Close()
+
+		// #nosec G110 -- Entry size is bounded by the limits checked in walkTarGz
+		if _, err := io.Copy(destFile, r); err != nil {
+			return false, fmt.Errorf("failed to extract file: %w", err)
+		}
+
+		extracted = true
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !extracted {
+		return fmt.Errorf("no executable file found in archive")
+	}
+
+	return nil
+}
+
+// WalkFiles calls fn for every regular file in a tar.gz archive, passing the
+// entry name, its permission bits and a reader for its contents.
+func WalkFiles(archivePath string, limits Limits, fn func(name string, mode int64, r io.Reader) error) error {
+	return walkTarGz(archivePath, limits, func(header *tar.Header, r io.Reader) (bool, error) {
+		if header.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		return false, fn(header.Name, header.Mode, r)
+	})
+}
+
+// walkTarGz iterates over the entries of a tar.gz archive until fn asks to
+// stop, returns an error, or the archive is exhausted. Every entry header is
+// checked against the limits before fn sees it. The tar reader never yields
+// more than the size recorded in the header, so checking headers bounds the
+// amount of data decompressed.
+func walkTarGz(archivePath string, limits Limits, fn func(header *tar.Header, r io.Reader) (bool, error)) error {
 	// Open the archive.
 	// #nosec G304 -- Opening archive in temp directory
 	file, err := os.Open(archivePath)
@@ -32,61 +118,80 @@ func ExtractBinary(archivePath, destPath string) error {
 	// Create tar reader.
 	tr := tar.NewReader(gzr)
 
-	// Get the directory of the destination to create a root scope.
-	destDir := filepath.Dir(destPath)
-	destName := filepath.Base(destPath)
-
-	// Create a scoped root for the destination directory to prevent path traversal.
-	root, err := os.OpenRoot(destDir)
-	if err != nil {
-		return fmt.Errorf("failed to create root scope: %w", err)
-	}
-	defer root.Close()
-
-	// Find and extract the first executable file.
-	var extracted bool
+	var entries int
+	var totalSize int64
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("failed to read tar header: %w", err)
 		}
 
-		// Skip directories.
-		if header.Typeflag == tar.TypeDir {
-			continue
+		entries++
+		if limits.MaxEntries > 0 && entries > limits.MaxEntries {
+			return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, limits.MaxEntries)
+		}
+		if limits.MaxEntrySize > 0 && header.Size > limits.MaxEntrySize {
+			return fmt.Errorf("%w: entry %s is %d bytes (limit %d)",
+				ErrLimitExceeded, header.Name, header.Size, limits.MaxEntrySize)
+		}
+		totalSize += header.Size
+		if limits.MaxTotalSize > 0 && totalSize > limits.MaxTotalSize {
+			return fmt.Errorf("%w: uncompressed size exceeds %d bytes", ErrLimitExceeded, limits.MaxTotalSize)
 		}
 
-		// Check if file is executable.
-		if header.Mode&0111 != 0 {
-			// Extract this file using scoped root.
-			destFile, err := root.OpenFile(destName, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
-			if err != nil {
-				return fmt.Errorf("failed to create destination file: %w", err)
-			}
-			defer destFile.Close()
-
-			// #nosec G110 -- Decompression of trusted GitHub release assets
-			if _, err := io.Copy(destFile, tr); err != nil {
-				return fmt.Errorf("failed to extract file: %w", err)
-			}
-
-			extracted = true
-			break
+		stop, err := fn(header, tr)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
 		}
 	}
+}
 
-	if !extracted {
-		return fmt.Errorf("no executable file found in archive")
-	}
+// Supported checksum algorithms. Checksums are written as "<algorithm>:<hex>".
+const (
+	AlgorithmSHA1   = "sha1"
+	AlgorithmSHA256 = "sha256"
+	AlgorithmSHA512 = "sha512"
+)
 
-	return nil
+// bsdChecksumPattern matches BSD-style lines such as "SHA256 (file) = hash".
+var bsdChecksumPattern = regexp.MustCompile(`^(?i)(SHA-?1|SHA-?256|SHA-?512)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+// ChecksumAlgorithm returns the algorithm of a checksum such as
+// "sha512:abc...". Checksums without a prefix are taken to be SHA256.
+func ChecksumAlgorithm(checksum string) string {
+	if algorithm, _, found := strings.Cut(checksum, ":"); found {
+		return algorithm
+	}
+	return AlgorithmSHA256
 }
 
 // CalculateChecksum calculates the SHA256 checksum of a file.
 func CalculateChecksum(filePath string) (string, error) {
+	return CalculateChecksumWith(filePath, AlgorithmSHA256)
+}
+
+// CalculateChecksumWith calculates the checksum of a file using the given
+// algorithm.
+func CalculateChecksumWith(filePath, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case AlgorithmSHA1:
+		// #nosec G401 -- SHA1 is only used when that is all a project publishes
+		h = sha1.New()
+	case AlgorithmSHA256:
+		h = sha256.New()
+	case AlgorithmSHA512:
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
 	// #nosec G304 -- Calculating checksum of controlled file path
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -94,17 +199,17 @@ func CalculateChecksum(filePath string) (string, error) {
 	}
 	defer file.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(h, file); err != nil {
 		return "", fmt.Errorf("failed to calculate checksum: %w", err)
 	}
 
-	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// VerifyChecksum verifies a file's checksum against an expected value.
+// VerifyChecksum verifies a file's checksum against an expected value, using
+// the algorithm that the expected value names.
 func VerifyChecksum(filePath, expectedChecksum string) error {
-	actualChecksum, err := CalculateChecksum(filePath)
+	actualChecksum, err := CalculateChecksumWith(filePath, ChecksumAlgorithm(expectedChecksum))
 	if err != nil {
 		return err
 	}
@@ -116,7 +221,11 @@ func VerifyChecksum(filePath, expectedChecksum string) error {
 	return nil
 }
 
-// FindChecksumInFile finds the checksum for a specific file in a checksums.txt file.
+// FindChecksumInFile finds the checksum for a specific file in a checksums
+// file. GNU-style lines ("hash  file", with "*file" marking binary mode) and
+// BSD-style lines ("SHA256 (file) = hash") are understood, and the algorithm
+// is deduced from the length of the hash. The result is prefixed with the
+// algorithm, e.g. "sha512:...".
 func FindChecksumInFile(checksumsPath, targetFilename string) (string, error) {
 	// #nosec G304 -- Reading checksums from temp directory
 	data, err := os.ReadFile(checksumsPath)
@@ -127,24 +236,89 @@ func FindChecksumInFile(checksumsPath, targetFilename string) (string, error) {
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		// Format can be: "checksum  filename" or "checksum filename".
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			checksum := parts[0]
-			filename := parts[len(parts)-1]
+		algorithm, digest, filename := parseChecksumLine(line)
+		if filename == "" || filepath.Base(filepath.ToSlash(filename)) != targetFilename {
+			continue
+		}
 
-			// Handle paths in filename (extract basename).
-			filename = filepath.Base(filename)
+		return formatChecksum(algorithm, digest, targetFilename)
+	}
 
-			if filename == targetFilename {
-				return "sha256:" + checksum, nil
-			}
+	return "", fmt.Errorf("checksum not found for %s in checksums file", targetFilename)
+}
+
+// FindChecksumInSidecar reads the checksum from a per-asset sidecar file such
+// as "tool.tar.gz.sha256". Sidecars either hold a full checksums line or just
+// the bare hash.
+func FindChecksumInSidecar(sidecarPath, targetFilename string) (string, error) {
+	if checksum, err := FindChecksumInFile(sidecarPath, targetFilename); err == nil {
+		return checksum, nil
+	}
+
+	// #nosec G304 -- Reading checksums from temp directory
+	data, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file for %s is empty", targetFilename)
+	}
+	return formatChecksum("", fields[0], targetFilename)
+}
+
+// parseChecksumLine splits a checksums line into its algorithm (which is
+// empty unless the line names it), digest and filename.
+func parseChecksumLine(line string) (algorithm, digest, filename string) {
+	if m := bsdChecksumPattern.FindStringSubmatch(line); m != nil {
+		algorithm = strings.ToLower(strings.ReplaceAll(m[1], "-", ""))
+		return algorithm, m[3], m[2]
+	}
+
+	digest, rest, found := strings.Cut(line, " ")
+	if !found {
+		digest, rest, found = strings.Cut(line, "\t")
+		if !found {
+			return "", line, ""
 		}
 	}
 
-	return "", fmt.Errorf("checksum not found for %s in checksums file", targetFilename)
+	// GNU coreutils separates the hash from the name with a space and then a
+	// mode character: another space for text mode or "*" for binary mode.
+	filename = strings.TrimLeft(rest, " \t")
+	filename = strings.TrimPrefix(filename, "*")
+	return "", digest, filename
+}
+
+// formatChecksum validates a digest and returns it with its algorithm prefix.
+// If algorithm is empty it is deduced from the length of the digest.
+func formatChecksum(algorithm, digest, targetFilename string) (string, error) {
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("malformed checksum for %s: %q is not hexadecimal", targetFilename, digest)
+	}
+
+	var deduced string
+	switch len(digest) {
+	case 40:
+		deduced = AlgorithmSHA1
+	case 64:
+		deduced = AlgorithmSHA256
+	case 128:
+		deduced = AlgorithmSHA512
+	default:
+		return "", fmt.Errorf("malformed checksum for %s: unrecognised length %d", targetFilename, len(digest))
+	}
+
+	if algorithm != "" && algorithm != deduced {
+		return "", fmt.Errorf("malformed checksum for %s: %s hash has the length of a %s hash",
+			targetFilename, algorithm, deduced)
+	}
+
+	return deduced + ":" + digest, nil
 }
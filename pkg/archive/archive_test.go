@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractBinaryLimits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "archive-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "tool.tar.gz")
+	writeTarGz(t, archivePath, []tarEntry{
+		{name: "README.md", mode: 0644, content: strings.Repeat("r", 100)},
+		{name: "LICENSE", mode: 0644, content: strings.Repeat("l", 100)},
+		{name: "tool", mode: 0755, content: strings.Repeat("x", 1000)},
+	})
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		wantError bool
+	}{
+		{name: "Default limits", limits: DefaultLimits},
+		{name: "Unlimited", limits: Limits{}},
+		{name: "Entry too large", limits: Limits{MaxEntrySize: 999}, wantError: true},
+		{name: "Total too large", limits: Limits{MaxTotalSize: 1199}, wantError: true},
+		{name: "Too many entries", limits: Limits{MaxEntries: 2}, wantError: true},
+		{name: "Exactly at limits", limits: Limits{MaxTotalSize: 1200, MaxEntrySize: 1000, MaxEntries: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destPath := filepath.Join(tmpDir, "tool")
+			err := ExtractBinary(archivePath, destPath, tt.limits)
+
+			if tt.wantError {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("ExtractBinary() error = %v, want ErrLimitExceeded", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ExtractBinary() unexpected error: %v", err)
+			}
+			info, err := os.Stat(destPath)
+			if err != nil {
+				t.Fatalf("extracted binary missing: %v", err)
+			}
+			if info.Size() != 1000 {
+				t.Errorf("extracted binary is %d bytes, want 1000", info.Size())
+			}
+		})
+	}
+}
+
+// tarEntry describes a file to be written into a test archive.
+type tarEntry struct {
+	name    string
+	mode    int64
+	content string
+}
+
+// writeTarGz creates a tar.gz archive containing the given entries in order.
+func writeTarGz(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+}
+
+func TestFindChecksumInFile(t *testing.T) {
+	sha1Hex := strings.Repeat("a", 40)
+	sha256Hex := strings.Repeat("b", 64)
+	sha512Hex := strings.Repeat("c", 128)
+
+	tests := []struct {
+		name      string
+		content   string
+		target    string
+		want      string
+		wantError bool
+	}{
+		{name: "GNU two spaces", content: sha256Hex + "  tool.tar.gz\n", target: "tool.tar.gz",
+			want: "sha256:" + sha256Hex},
+		{name: "GNU binary marker", content: sha256Hex + " *tool.tar.gz\n", target: "tool.tar.gz",
+			want: "sha256:" + sha256Hex},
+		{name: "Path in filename", content: sha256Hex + "  ./dist/tool.tar.gz\n", target: "tool.tar.gz",
+			want: "sha256:" + sha256Hex},
+		{name: "SHA512 by length", content: sha512Hex + "  tool.tar.gz\n", target: "tool.tar.gz",
+			want: "sha512:" + sha512Hex},
+		{name: "SHA1 by length", content: sha1Hex + "  tool.tar.gz\n", target: "tool.tar.gz",
+			want: "sha1:" + sha1Hex},
+		{name: "BSD style", content: "SHA256 (tool.tar.gz) = " + strings.ToUpper(sha256Hex) + "\n",
+			target: "tool.tar.gz", want: "sha256:" + sha256Hex},
+		{name: "BSD SHA512", content: "SHA512 (tool.tar.gz) = " + sha512Hex + "\n", target: "tool.tar.gz",
+			want: "sha512:" + sha512Hex},
+		{name: "Several entries", content: sha1Hex + "  other.zip\n" + sha512Hex + "  tool.tar.gz\n",
+			target: "tool.tar.gz", want: "sha512:" + sha512Hex},
+		{name: "Not listed", content: sha256Hex + "  other.zip\n", target: "tool.tar.gz", wantError: true},
+		{name: "Not hexadecimal", content: strings.Repeat("z", 64) + "  tool.tar.gz\n", target: "tool.tar.gz",
+			wantError: true},
+		{name: "Unknown length", content: strings.Repeat("d", 32) + "  tool.tar.gz\n", target: "tool.tar.gz",
+			wantError: true},
+		{name: "BSD algorithm disagrees with length", content: "SHA512 (tool.tar.gz) = " + sha256Hex + "\n",
+			target: "tool.tar.gz", wantError: true},
+	}
+
+	tmpDir, err := os.MkdirTemp("", "archive-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "checksums.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write checksums: %v", err)
+			}
+
+			got, err := FindChecksumInFile(path, tt.target)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("FindChecksumInFile() = %q, expected error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindChecksumInFile() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FindChecksumInFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksumAlgorithms(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "archive-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(path, []byte("hello\n"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// Sidecar containing only a bare SHA512 hash.
+	sidecar := filepath.Join(tmpDir, "file.sha512")
+	sha512Hex := "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931" +
+		"f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629"
+	if err := os.WriteFile(sidecar, []byte(sha512Hex+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write sidecar: %v", err)
+	}
+
+	expected, err := FindChecksumInSidecar(sidecar, "file")
+	if err != nil {
+		t.Fatalf("FindChecksumInSidecar() unexpected error: %v", err)
+	}
+	if ChecksumAlgorithm(expected) != AlgorithmSHA512 {
+		t.Errorf("ChecksumAlgorithm(%q) = %q, want sha512", expected, ChecksumAlgorithm(expected))
+	}
+	if err := VerifyChecksum(path, expected); err != nil {
+		t.Errorf("VerifyChecksum() with SHA512: %v", err)
+	}
+	if err := VerifyChecksum(path, "sha1:f572d396fae9206628714fb2ce00f72e94f2258f"); err != nil {
+		t.Errorf("VerifyChecksum() with SHA1: %v", err)
+	}
+	if err := VerifyChecksum(path, "sha256:"+strings.Repeat("0", 64)); err == nil {
+		t.Error("VerifyChecksum() with wrong SHA256 expected error")
+	}
+}
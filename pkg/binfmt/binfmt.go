@@ -0,0 +1,212 @@
+// Package binfmt inspects executable file headers to determine which
+// operating system and architecture an executable was built for.
+package binfmt
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Executable formats.
+const (
+	FormatELF   = "elf"
+	FormatMachO = "macho"
+	FormatPE    = "pe"
+)
+
+// ErrUnknownFormat is returned for files that are not ELF, Mach-O or PE
+// executables, such as shell scripts.
+var ErrUnknownFormat = errors.New("unrecognised executable format")
+
+// Info describes an executable. OS and Arch use Go's GOOS and GOARCH names.
+// A universal Mach-O binary has one entry in Arches per architecture.
+type Info struct {
+	Format string
+	OS     string
+	Arches []string
+}
+
+// String returns a short description such as "elf linux/amd64".
+func (i *Info) String() string {
+	return fmt.Sprintf("%s %s/%s", i.Format, i.OS, strings.Join(i.Arches, ","))
+}
+
+// Detect reads the header of the executable at path.
+func Detect(path string) (*Info, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return &Info{Format: FormatELF, OS: elfOS(f.OSABI), Arches: []string{elfArch(f)}}, nil
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return &Info{Format: FormatMachO, OS: "darwin", Arches: []string{machoArch(f.Cpu)}}, nil
+	}
+
+	if f, err := macho.OpenFat(path); err == nil {
+		defer f.Close()
+		info := &Info{Format: FormatMachO, OS: "darwin"}
+		for _, a := range f.Arches {
+			info.Arches = append(info.Arches, machoArch(a.Cpu))
+		}
+		return info, nil
+	}
+
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		return &Info{Format: FormatPE, OS: "windows", Arches: []string{peArch(f.Machine)}}, nil
+	}
+
+	// Distinguish unreadable files from files in a format we do not know.
+	// #nosec G304 -- Checking a file that execman has just extracted
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read executable: %w", err)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Check detects the format of the executable at path and applies a platform
+// check policy of "off", "warn" or "require". Under "require" a mismatch is
+// returned as an error; under "warn" it is passed to warn instead. Files in an
+// unknown format, such as scripts, cannot be checked and are only ever warned
+// about. The detected Info is nil if the format is unknown.
+func Check(path, goos, goarch, policy string, warn func(error)) (*Info, error) {
+	if policy == "off" {
+		info, _ := Detect(path)
+		return info, nil
+	}
+
+	info, err := Detect(path)
+	if errors.Is(err, ErrUnknownFormat) {
+		warn(fmt.Errorf("cannot verify platform: %w", err))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := info.CheckPlatform(goos, goarch); err != nil {
+		if policy == "warn" {
+			warn(err)
+			return info, nil
+		}
+		return info, err
+	}
+
+	return info, nil
+}
+
+// CheckPlatform returns an error if the executable does not target the given
+// operating system and architecture.
+func (i *Info) CheckPlatform(goos, goarch string) error {
+	if i.OS != goos {
+		return fmt.Errorf("executable is a %s binary for %s, not %s/%s", i.Format, i.OS, goos, goarch)
+	}
+	for _, a := range i.Arches {
+		if a == goarch {
+			return nil
+		}
+	}
+	return fmt.Errorf("executable is a %s binary for %s/%s, not %s/%s",
+		i.Format, i.OS, strings.Join(i.Arches, ","), goos, goarch)
+}
+
+// elfOS maps an ELF OS/ABI to a GOOS. Most Linux toolchains, including Go's,
+// leave the OS/ABI as System V, so that is taken to mean Linux.
+func elfOS(abi elf.OSABI) string {
+	switch abi {
+	case elf.ELFOSABI_NONE, elf.ELFOSABI_LINUX:
+		return "linux"
+	case elf.ELFOSABI_FREEBSD:
+		return "freebsd"
+	case elf.ELFOSABI_NETBSD:
+		return "netbsd"
+	case elf.ELFOSABI_OPENBSD:
+		return "openbsd"
+	case elf.ELFOSABI_SOLARIS:
+		return "solaris"
+	default:
+		return strings.ToLower(strings.TrimPrefix(abi.String(), "ELFOSABI_"))
+	}
+}
+
+// elfArch maps an ELF machine to a GOARCH. Some machines cover several
+// GOARCHes, which the ELF class and byte order tell apart.
+func elfArch(f *elf.File) string {
+	is64 := f.Class == elf.ELFCLASS64
+	littleEndian := f.ByteOrder == binary.LittleEndian
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		if is64 {
+			return "riscv64"
+		}
+		return "riscv"
+	case elf.EM_PPC64:
+		if littleEndian {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_S390:
+		if is64 {
+			return "s390x"
+		}
+		return "s390"
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_MIPS, elf.EM_MIPS_RS3_LE:
+		arch := "mips"
+		if is64 {
+			arch = "mips64"
+		}
+		if littleEndian {
+			arch += "le"
+		}
+		return arch
+	default:
+		return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+}
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	default:
+		return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+	}
+}
+
+func peArch(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	default:
+		return fmt.Sprintf("machine-0x%04x", machine)
+	}
+}
@@ -0,0 +1,103 @@
+package binfmt
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDetectSelf(t *testing.T) {
+	// The test binary is itself an executable for the host platform.
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find test executable: %v", err)
+	}
+
+	info, err := Detect(self)
+	if err != nil {
+		t.Fatalf("Detect returned error: %v", err)
+	}
+	if err := info.CheckPlatform(runtime.GOOS, runtime.GOARCH); err != nil {
+		t.Errorf("CheckPlatform on test binary: %v (detected %s)", err, info)
+	}
+}
+
+func TestDetectScript(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "binfmt-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "script")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho hello\n"), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	if _, err := Detect(path); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Detect(script) error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      Info
+		goos      string
+		goarch    string
+		wantError bool
+	}{
+		{name: "Matching ELF", info: Info{Format: FormatELF, OS: "linux", Arches: []string{"amd64"}},
+			goos: "linux", goarch: "amd64"},
+		{name: "Wrong architecture", info: Info{Format: FormatELF, OS: "linux", Arches: []string{"arm64"}},
+			goos: "linux", goarch: "amd64", wantError: true},
+		{name: "Darwin binary on Linux", info: Info{Format: FormatMachO, OS: "darwin", Arches: []string{"amd64"}},
+			goos: "linux", goarch: "amd64", wantError: true},
+		{name: "Universal binary", info: Info{Format: FormatMachO, OS: "darwin", Arches: []string{"amd64", "arm64"}},
+			goos: "darwin", goarch: "arm64"},
+		{name: "Windows binary", info: Info{Format: FormatPE, OS: "windows", Arches: []string{"amd64"}},
+			goos: "windows", goarch: "amd64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.info.CheckPlatform(tt.goos, tt.goarch)
+			if (err != nil) != tt.wantError {
+				t.Errorf("CheckPlatform() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestElfArch(t *testing.T) {
+	tests := []struct {
+		machine elf.Machine
+		class   elf.Class
+		order   binary.ByteOrder
+		want    string
+	}{
+		{elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian, "amd64"},
+		{elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian, "mips"},
+		{elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian, "mipsle"},
+		{elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian, "mips64"},
+		{elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian, "mips64le"},
+		{elf.EM_RISCV, elf.ELFCLASS64, binary.LittleEndian, "riscv64"},
+		{elf.EM_RISCV, elf.ELFCLASS32, binary.LittleEndian, "riscv"},
+		{elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian, "ppc64le"},
+		{elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian, "ppc64"},
+		{elf.EM_S390, elf.ELFCLASS64, binary.BigEndian, "s390x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			f := &elf.File{FileHeader: elf.FileHeader{Class: tt.class, ByteOrder: tt.order, Machine: tt.machine}}
+			if got := elfArch(f); got != tt.want {
+				t.Errorf("elfArch(%v, %v, %v) = %q, want %q", tt.machine, tt.class, tt.order, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package cache provides a content-addressed cache of downloaded release
+// assets, shared by every install location, so that reinstalling or rolling
+// back does not download the same asset again.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/github"
+)
+
+// Entry records a cached asset. Entries are keyed by the asset URL and refer
+// to a blob named after the checksum of its contents.
+type Entry struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Checksum string    `json:"checksum"`
+	Size     int64     `json:"size"`
+	CachedAt time.Time `json:"cached_at"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Cache is a directory of downloaded assets together with an index.
+type Cache struct {
+	// MaxSize is the total size in bytes above which least recently used
+	// entries are evicted. Zero or negative means unlimited.
+	MaxSize int64
+	entries map[string]*Entry
+	dir     string
+}
+
+// index is the on-disk form of the cache index.
+type index struct {
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// DefaultDir returns the default cache directory.
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "execman"), nil
+}
+
+// Open opens the cache in the default location.
+func Open(maxSize int64) (*Cache, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenAt(dir, maxSize)
+}
+
+// OpenAt opens the cache in a specific directory.
+func OpenAt(dir string, maxSize int64) (*Cache, error) {
+	c := &Cache{
+		MaxSize: maxSize,
+		entries: make(map[string]*Entry),
+		dir:     dir,
+	}
+
+	// #nosec G304 -- Reading cache index from trusted path
+	data, err := os.ReadFile(c.indexPath())
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache index: %w", err)
+	}
+
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse cache index: %w", err)
+	}
+	if idx.Entries != nil {
+		c.entries = idx.Entries
+	}
+
+	return c, nil
+}
+
+// Dir returns the directory holding the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Fetch returns the path of a cached copy of an asset and its checksum,
+// downloading it first if it is not cached. If expectedChecksum is not empty,
+// a cached copy with a different checksum is ignored and downloaded again.
+// The returned checksum is always SHA256, whatever the expected algorithm.
+// The third result reports whether the cache already held the asset.
+func (c *Cache) Fetch(asset *github.Asset, expectedChecksum string, opts github.DownloadOptions) (string, string, bool, error) {
+	url := asset.BrowserDownloadURL
+	if entry, ok := c.entries[url]; ok {
+		path := c.blobPath(entry.Checksum)
+		// Verify the blob, since anything could have happened to it on disk.
+		if c.matches(path, entry.Checksum, expectedChecksum) {
+			entry.LastUsed = time.Now()
+			if err := c.save(); err != nil {
+				return "", "", false, err
+			}
+			return path, entry.Checksum, true, nil
+		}
+		c.evict(url)
+	}
+
+	// Partial downloads are kept per URL so an interrupted download can be
+	// resumed by a later run.
+	partialDir := filepath.Join(c.dir, "partial", urlKey(url))
+	if err := os.MkdirAll(partialDir, 0700); err != nil {
+		return "", "", false, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	partialPath := filepath.Join(partialDir, filepath.Base(asset.Name))
+
+	opts.Resume = true
+	checksum, err := github.DownloadAsset(asset, partialPath, opts)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	blob := c.blobPath(checksum)
+	if err := os.MkdirAll(filepath.Dir(blob), 0700); err != nil {
+		return "", "", false, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.Rename(partialPath, blob); err != nil {
+		return "", "", false, fmt.Errorf("failed to add download to cache: %w", err)
+	}
+	_ = os.RemoveAll(partialDir)
+
+	info, err := os.Stat(blob)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to stat cached download: %w", err)
+	}
+
+	now := time.Now()
+	c.entries[url] = &Entry{
+		URL:      url,
+		Name:     asset.Name,
+		Checksum: checksum,
+		Size:     info.Size(),
+		CachedAt: now,
+		LastUsed: now,
+	}
+	c.enforceMaxSize(url)
+
+	if err := c.save(); err != nil {
+		return "", "", false, err
+	}
+
+	return blob, checksum, false, nil
+}
+
+// matches reports whether the blob at path still has the checksum recorded
+// for it and, if expectedChecksum is not empty, also matches that. The
+// expected checksum may use a different algorithm from the recorded one.
+func (c *Cache) matches(path, recorded, expectedChecksum string) bool {
+	if actual, err := archive.CalculateChecksum(path); err != nil || actual != recorded {
+		return false
+	}
+	if expectedChecksum == "" || expectedChecksum == recorded {
+		return true
+	}
+	return archive.ChecksumAlgorithm(expectedChecksum) != archive.ChecksumAlgorithm(recorded) &&
+		archive.VerifyChecksum(path, expectedChecksum) == nil
+}
+
+// List returns the cache entries, most recently used first.
+func (c *Cache) List() []*Entry {
+	entries := make([]*Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries
+}
+
+// TotalSize returns the combined size of all cached blobs.
+func (c *Cache) TotalSize() int64 {
+	var total int64
+	seen := make(map[string]bool)
+	for _, e := range c.entries {
+		// Identical content downloaded from two URLs is stored once.
+		if !seen[e.Checksum] {
+			seen[e.Checksum] = true
+			total += e.Size
+		}
+	}
+	return total
+}
+
+// Prune removes entries not used within olderThan (if positive), entries
+// whose blobs are missing, abandoned partial downloads, and then least
+// recently used entries until the cache fits within MaxSize. It returns the
+// number of entries removed.
+func (c *Cache) Prune(olderThan time.Duration) (int, error) {
+	before := len(c.entries)
+	cutoff := time.Now().Add(-olderThan)
+	for url, e := range c.entries {
+		if olderThan > 0 && e.LastUsed.Before(cutoff) {
+			c.evict(url)
+			continue
+		}
+		if _, err := os.Stat(c.blobPath(e.Checksum)); os.IsNotExist(err) {
+			delete(c.entries, url)
+		}
+	}
+	c.enforceMaxSize("")
+	c.removeOrphanBlobs()
+
+	if err := os.RemoveAll(filepath.Join(c.dir, "partial")); err != nil {
+		return before - len(c.entries), fmt.Errorf("failed to remove partial downloads: %w", err)
+	}
+
+	return before - len(c.entries), c.save()
+}
+
+// Clear removes everything from the cache.
+func (c *Cache) Clear() error {
+	for _, sub := range []string{"blobs", "partial", "run"} {
+		if err := os.RemoveAll(filepath.Join(c.dir, sub)); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+	c.entries = make(map[string]*Entry)
+	return c.save()
+}
+
+// enforceMaxSize evicts least recently used entries until the cache fits
+// within MaxSize. The entry for keepURL is never evicted, so that an asset
+// larger than the cap can still be used by the operation that fetched it.
+func (c *Cache) enforceMaxSize(keepURL string) {
+	if c.MaxSize <= 0 {
+		return
+	}
+	entries := c.List()
+	for i := len(entries) - 1; i >= 0 && c.TotalSize() > c.MaxSize; i-- {
+		if entries[i].URL != keepURL {
+			c.evict(entries[i].URL)
+		}
+	}
+}
+
+// removeOrphanBlobs deletes blobs that no entry refers to, such as those left
+// behind if the index could not be saved, and executables extracted from
+// assets that are no longer cached.
+func (c *Cache) removeOrphanBlobs() {
+	referenced := make(map[string]bool)
+	for _, e := range c.entries {
+		referenced[c.blobPath(e.Checksum)] = true
+		referenced[filepath.Dir(c.ExtractedPath(e.Checksum, "executable"))] = true
+	}
+	_ = filepath.WalkDir(filepath.Join(c.dir, "blobs"), func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !referenced[path] {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+
+	algos, _ := os.ReadDir(filepath.Join(c.dir, "run"))
+	for _, algo := range algos {
+		dirs, _ := os.ReadDir(filepath.Join(c.dir, "run", algo.Name()))
+		for _, d := range dirs {
+			path := filepath.Join(c.dir, "run", algo.Name(), d.Name())
+			if !referenced[path] {
+				_ = os.RemoveAll(path)
+			}
+		}
+	}
+}
+
+// ExtractedPath returns where 'execman run' keeps the executable called name
+// extracted from the cached asset with the given checksum, for example
+// run/sha256/abc123/tool for "sha256:abc123". It is removed with the asset.
+func (c *Cache) ExtractedPath(checksum, name string) string {
+	algo, digest, found := strings.Cut(checksum, ":")
+	if !found {
+		algo, digest = "sha256", checksum
+	}
+	return filepath.Join(c.dir, "run", algo, digest, name)
+}
+
+// evict removes an entry, and its blob if no other entry shares it.
+func (c *Cache) evict(url string) {
+	entry, ok := c.entries[url]
+	if !ok {
+		return
+	}
+	delete(c.entries, url)
+	for _, e := range c.entries {
+		if e.Checksum == entry.Checksum {
+			return
+		}
+	}
+	_ = os.Remove(c.blobPath(entry.Checksum))
+}
+
+// save writes the index atomically.
+func (c *Cache) save() error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(index{Entries: c.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache index: %w", err)
+	}
+
+	tmpPath := c.indexPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.indexPath()); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+// blobPath returns where content with the given checksum is stored, for
+// example blobs/sha256/abc123 for "sha256:abc123".
+func (c *Cache) blobPath(checksum string) string {
+	algo, digest, found := strings.Cut(checksum, ":")
+	if !found {
+		algo, digest = "sha256", checksum
+	}
+	return filepath.Join(c.dir, "blobs", algo, digest)
+}
+
+// urlKey returns a short, filesystem-safe key for a URL.
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/github"
+)
+
+func TestFetchUsesCache(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "cache-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := OpenAt(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenAt returned error: %v", err)
+	}
+
+	asset := &github.Asset{Name: "tool.tar.gz", BrowserDownloadURL: server.URL + "/content"}
+	path, checksum, cached, err := c.Fetch(asset, "", github.DownloadOptions{})
+	if err != nil {
+		t.Fatalf("Fetch returned error: %v", err)
+	}
+	if cached {
+		t.Error("first fetch should not be a cache hit")
+	}
+	if want := checksumOf("content"); checksum != want {
+		t.Errorf("checksum = %q, want %q", checksum, want)
+	}
+
+	// Reopen to check the index was persisted.
+	c, err = OpenAt(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenAt returned error: %v", err)
+	}
+	path2, _, cached, err := c.Fetch(asset, checksum, github.DownloadOptions{})
+	if err != nil {
+		t.Fatalf("Fetch returned error: %v", err)
+	}
+	if !cached || path2 != path || requests != 1 {
+		t.Errorf("second fetch: cached=%v path=%q requests=%d, want hit at %q with 1 request", cached, path2, requests, path)
+	}
+
+	// A different expected checksum forces a fresh download.
+	if _, _, cached, err = c.Fetch(asset, "sha256:other", github.DownloadOptions{}); err != nil || cached {
+		t.Errorf("fetch with different checksum: cached=%v err=%v, want a fresh download", cached, err)
+	}
+
+	// A tampered blob is detected and downloaded again.
+	if err := os.WriteFile(path, []byte("tampered"), 0600); err != nil {
+		t.Fatalf("failed to tamper with blob: %v", err)
+	}
+	if _, checksum, cached, err = c.Fetch(asset, "", github.DownloadOptions{}); err != nil || cached {
+		t.Errorf("fetch after tampering: cached=%v err=%v, want a fresh download", cached, err)
+	}
+	if checksum != checksumOf("content") {
+		t.Errorf("checksum after tampering = %q, want original content", checksum)
+	}
+}
+
+func TestMaxSizeAndClear(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(r.URL.Path, 10)))
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "cache-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each download is 20 bytes, so only two fit.
+	c, err := OpenAt(dir, 45)
+	if err != nil {
+		t.Fatalf("OpenAt returned error: %v", err)
+	}
+	for _, name := range []string{"/a", "/b", "/c"} {
+		asset := &github.Asset{Name: name[1:], BrowserDownloadURL: server.URL + name}
+		if _, _, _, err := c.Fetch(asset, "", github.DownloadOptions{}); err != nil {
+			t.Fatalf("Fetch returned error: %v", err)
+		}
+	}
+
+	entries := c.List()
+	if len(entries) != 2 || entries[0].Name != "c" || entries[1].Name != "b" {
+		t.Errorf("expected the least recently used entry to be evicted, got %+v", entries)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Clear returned error: %v", err)
+	}
+	if len(c.List()) != 0 || c.TotalSize() != 0 {
+		t.Error("expected cache to be empty after Clear")
+	}
+}
+
+func TestPruneRemovesOrphanedExtractions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "cache-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := OpenAt(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenAt returned error: %v", err)
+	}
+	asset := &github.Asset{Name: "tool.tar.gz", BrowserDownloadURL: server.URL + "/tool.tar.gz"}
+	_, checksum, _, err := c.Fetch(asset, "", github.DownloadOptions{})
+	if err != nil {
+		t.Fatalf("Fetch returned error: %v", err)
+	}
+
+	kept := c.ExtractedPath(checksum, "tool")
+	orphan := c.ExtractedPath(checksumOf("evicted"), "tool")
+	for _, path := range []string{kept, orphan} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("executable"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Prune(0); err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected the extraction of a cached asset to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(orphan)); !os.IsNotExist(err) {
+		t.Errorf("expected the extraction of an uncached asset to be removed")
+	}
+}
+
+func checksumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/progress"
+	"github.com/spf13/cobra"
+)
+
+// NewCacheCommand creates the cache command and its subcommands.
+func NewCacheCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the download cache",
+		Long: `Manage the cache of downloaded release assets. Assets are cached by URL and
+checksum so that reinstalling or installing into another directory does not
+download them again.`,
+	}
+
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newPruneCommand())
+	cmd.AddCommand(newClearCommand())
+
+	return cmd
+}
+
+func newListCommand() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List cached downloads",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := openFromConfig()
+			if err != nil {
+				return err
+			}
+
+			entries := c.List()
+			if jsonOutput {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("The download cache is empty.")
+				return nil
+			}
+
+			for _, e := range entries {
+				fmt.Printf("  %-40s %10s  used %s\n", e.Name, progress.FormatBytes(e.Size), e.LastUsed.Format("2006-01-02"))
+				fmt.Printf("  %-40s %10s  %s\n", "", "", e.URL)
+			}
+			fmt.Println()
+			fmt.Printf("%d cached downloads, %s in %s\n", len(entries), progress.FormatBytes(c.TotalSize()), c.Dir())
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+func newPruneCommand() *cobra.Command {
+	var olderThan time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove stale cached downloads",
+		Long: `Remove cached downloads not used within --older-than, abandoned partial
+downloads, and least recently used downloads beyond the configured size cap.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := openFromConfig()
+			if err != nil {
+				return err
+			}
+
+			before := c.TotalSize()
+			removed, err := c.Prune(olderThan)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d cached downloads, freeing %s.\n", removed, progress.FormatBytes(before-c.TotalSize()))
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "Also remove downloads not used within this duration (e.g. 720h)")
+
+	return cmd
+}
+
+func newClearCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached downloads",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := openFromConfig()
+			if err != nil {
+				return err
+			}
+
+			size := c.TotalSize()
+			if err := c.Clear(); err != nil {
+				return err
+			}
+			fmt.Printf("Cache cleared, freeing %s.\n", progress.FormatBytes(size))
+			return nil
+		},
+	}
+}
+
+// openFromConfig opens the cache with the configured size cap.
+func openFromConfig() (*Cache, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return Open(cfg.CacheMaxSize)
+}
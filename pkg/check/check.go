@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"sort"
+	"path/filepath"
 
 	"github.com/sfkleach/execman/pkg/archive"
-	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/dircheck"
 	"github.com/sfkleach/execman/pkg/github"
-	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/list"
+	"github.com/sfkleach/execman/pkg/scope"
+	"github.com/sfkleach/execman/pkg/store"
 	"github.com/spf13/cobra"
 )
 
@@ -19,15 +21,21 @@ type CheckOutput struct {
 	UpdatesAvailable int                `json:"updates_available"`
 	Missing          int                `json:"missing"`
 	Modified         int                `json:"modified"`
+	Warnings         int                `json:"warnings"`
 }
 
 // ExecutableStatus represents the update status of an executable.
 type ExecutableStatus struct {
 	Name            string `json:"name"`
+	Scope           string `json:"scope"`
+	Location        string `json:"location,omitempty"`
 	CurrentVersion  string `json:"current_version"`
 	LatestVersion   string `json:"latest_version,omitempty"`
 	UpdateAvailable bool   `json:"update_available"`
 	Status          string `json:"status"` // "ok", "missing", "modified"
+	// Issues are problems with the install location, such as a directory
+	// other users can write to or another file of the same name on PATH.
+	Issues []dircheck.Issue `json:"issues,omitempty"`
 }
 
 // NewCheckCommand creates the check command.
@@ -36,18 +44,21 @@ func NewCheckCommand() *cobra.Command {
 	var includePrereleases bool
 	var noSkip bool
 	var verify bool
+	var userOnly bool
 
 	cmd := &cobra.Command{
 		Use:   "check [executable]",
 		Short: "Check for available updates and integrity",
-		Long:  "Check if updates are available for managed executables and verify file integrity.",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Check if updates are available for managed executables and verify file integrity.
+Executables in the system-wide registry are checked alongside the user's, unless
+--user or --system is given.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var name string
 			if len(args) > 0 {
 				name = args[0]
 			}
-			return runCheck(name, jsonOutput, includePrereleases, noSkip, verify)
+			return runCheck(name, jsonOutput, includePrereleases, noSkip, verify, userOnly)
 		},
 	}
 
@@ -55,52 +66,81 @@ func NewCheckCommand() *cobra.Command {
 	cmd.Flags().BoolVar(&includePrereleases, "include-prereleases", false, "Include prerelease versions in check")
 	cmd.Flags().BoolVar(&noSkip, "no-skip", false, "Show all executables, including up-to-date ones")
 	cmd.Flags().BoolVar(&verify, "verify", false, "Verify checksums of installed executables")
+	cmd.Flags().BoolVar(&userOnly, "user", false, "Check only the user's executables")
 
 	return cmd
 }
 
-func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool) error {
-	// Load registry.
-	reg, err := registry.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load registry: %w", err)
-	}
+// entry is an executable to check, with the scope it is managed in.
+type entry struct {
+	scope *list.Scope
+	name  string
+	label string
+}
 
-	// Load config for prerelease default.
-	cfg, err := config.Load()
+func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify, userOnly bool) error {
+	// Load registries.
+	all, err := list.LoadScopes(userOnly)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	if !includePrereleases {
-		includePrereleases = cfg.IncludePrereleases
+	// Get executables to check, leaving out empty scopes.
+	var scopes []*list.Scope
+	for _, s := range all {
+		if name != "" {
+			// Check specific executable.
+			if _, ok := s.Registry.Get(name); ok {
+				s.Names = []string{name}
+			} else {
+				s.Names = nil
+			}
+		}
+		if len(s.Names) > 0 {
+			scopes = append(scopes, s)
+		}
 	}
-
-	// Get executables to check.
-	var names []string
-	if name != "" {
-		// Check specific executable.
-		if _, ok := reg.Get(name); !ok {
+	if len(scopes) == 0 {
+		if name != "" {
 			return fmt.Errorf("executable %q is not managed by execman", name)
 		}
-		names = []string{name}
-	} else {
-		// Check all executables.
-		names = reg.List()
-		if len(names) == 0 {
-			if jsonOutput {
-				output := CheckOutput{Executables: []ExecutableStatus{}, UpdatesAvailable: 0}
-				encoder := json.NewEncoder(os.Stdout)
-				encoder.SetIndent("", "  ")
-				return encoder.Encode(output)
+		if jsonOutput {
+			output := CheckOutput{Executables: []ExecutableStatus{}, UpdatesAvailable: 0}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(output)
+		}
+		fmt.Println("No managed executables.")
+		return nil
+	}
+
+	// Order by scope, then by install location, then by name, labelling
+	// each location with its scope when more than one scope is shown.
+	var entries []entry
+	labels := map[string]bool{}
+	for _, s := range scopes {
+		for _, group := range list.GroupByLocation(s.Config, s.Registry, s.Names) {
+			label := group.Label
+			if len(scopes) > 1 {
+				label = fmt.Sprintf("%s (%s)", label, s.Name)
+			}
+			labels[label] = true
+			for _, n := range group.Names {
+				entries = append(entries, entry{scope: s, name: n, label: label})
 			}
-			fmt.Println("No managed executables.")
-			return nil
 		}
 	}
 
-	// Sort by name for consistent output.
-	sort.Strings(names)
+	// printLine prints a line about an executable, headed by its location
+	// when executables are installed in more than one.
+	lastLabel := ""
+	printLine := func(e entry, format string, args ...any) {
+		if len(labels) > 1 && e.label != lastLabel {
+			lastLabel = e.label
+			fmt.Printf("%s:\n", lastLabel)
+		}
+		fmt.Printf(format, args...)
+	}
 
 	// Check each executable.
 	if !jsonOutput {
@@ -108,18 +148,49 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 		fmt.Println()
 	}
 
-	statuses := make([]ExecutableStatus, 0, len(names))
+	statuses := make([]ExecutableStatus, 0, len(entries))
 	updatesAvailable := 0
 	upToDateCount := 0
 	missingCount := 0
 	modifiedCount := 0
+	warningCount := 0
+	dirIssues := map[string][]dircheck.Issue{}
+	var warnings []string
+
+	// Versions from the store that a project's tools file puts first on PATH
+	// shadow the installed executables deliberately.
+	var storeRoots []string
+	for _, s := range []string{scope.User, scope.System} {
+		if root, err := store.ScopeRoot(s); err == nil {
+			storeRoots = append(storeRoots, root)
+		}
+	}
 
-	for _, n := range names {
-		exec, ok := reg.Get(n)
+	for _, e := range entries {
+		n, cfg := e.name, e.scope.Config
+		exec, ok := e.scope.Registry.Get(n)
 		if !ok {
 			continue
 		}
 
+		// Check the install location, once per directory.
+		dir := filepath.Dir(exec.Path)
+		if _, ok := dirIssues[dir]; !ok {
+			dirIssues[dir], _ = dircheck.Dir(dir)
+		}
+		issues := append([]dircheck.Issue{}, dirIssues[dir]...)
+		for _, issue := range dircheck.Shadowed(exec.Path) {
+			if !inStore(storeRoots, issue.Path) {
+				issues = append(issues, issue)
+			}
+		}
+		if len(issues) > 0 {
+			warningCount++
+		}
+		for _, issue := range issues {
+			warnings = append(warnings, fmt.Sprintf("  %-15s %s", n, issue))
+		}
+
 		// Check file integrity first.
 		fileStatus := "ok"
 		if _, err := os.Stat(exec.Path); os.IsNotExist(err) {
@@ -138,16 +209,19 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 		if fileStatus != "ok" {
 			status := ExecutableStatus{
 				Name:           n,
+				Scope:          e.scope.Name,
+				Location:       cfg.LocationName(exec.Location, exec.Path),
 				CurrentVersion: exec.Version,
 				Status:         fileStatus,
+				Issues:         issues,
 			}
 			statuses = append(statuses, status)
 
 			if !jsonOutput {
 				if fileStatus == "missing" {
-					fmt.Printf("  %-15s %-9s          MISSING\n", n, exec.Version)
+					printLine(e, "  %-15s %-9s          MISSING\n", n, exec.Version)
 				} else {
-					fmt.Printf("  %-15s %-9s          MODIFIED\n", n, exec.Version)
+					printLine(e, "  %-15s %-9s          MODIFIED\n", n, exec.Version)
 				}
 			}
 			continue
@@ -157,16 +231,16 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 		owner, repo, _, err := github.ParseSource(exec.Source)
 		if err != nil {
 			if !jsonOutput {
-				fmt.Printf("  %-15s error: %v\n", n, err)
+				printLine(e, "  %-15s error: %v\n", n, err)
 			}
 			continue
 		}
 
 		// Fetch latest release.
-		release, err := github.GetLatestRelease(owner, repo, includePrereleases)
+		release, err := github.GetLatestRelease(owner, repo, includePrereleases || cfg.IncludePrereleases)
 		if err != nil {
 			if !jsonOutput {
-				fmt.Printf("  %-15s error: %v\n", n, err)
+				printLine(e, "  %-15s error: %v\n", n, err)
 			}
 			continue
 		}
@@ -182,18 +256,21 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 
 		status := ExecutableStatus{
 			Name:            n,
+			Scope:           e.scope.Name,
+			Location:        cfg.LocationName(exec.Location, exec.Path),
 			CurrentVersion:  exec.Version,
 			LatestVersion:   latestVersion,
 			UpdateAvailable: updateAvailable,
 			Status:          "ok",
+			Issues:          issues,
 		}
 		statuses = append(statuses, status)
 
 		if !jsonOutput {
 			if updateAvailable {
-				fmt.Printf("  %-15s %s → %-9s update available\n", n, exec.Version, latestVersion)
+				printLine(e, "  %-15s %s → %-9s update available\n", n, exec.Version, latestVersion)
 			} else if noSkip {
-				fmt.Printf("  %-15s %-9s          up to date\n", n, exec.Version)
+				printLine(e, "  %-15s %-9s          up to date\n", n, exec.Version)
 			}
 		}
 	}
@@ -204,12 +281,22 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 			UpdatesAvailable: updatesAvailable,
 			Missing:          missingCount,
 			Modified:         modifiedCount,
+			Warnings:         warningCount,
 		}
 		encoder := json.NewEncoder(os.Stdout)
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(output)
 	}
 
+	// Install location warnings.
+	if len(warnings) > 0 {
+		fmt.Println()
+		fmt.Println("Install location warnings:")
+		for _, warning := range warnings {
+			fmt.Println(warning)
+		}
+	}
+
 	// Text summary.
 	fmt.Println()
 
@@ -221,6 +308,9 @@ func runCheck(name string, jsonOutput, includePrereleases, noSkip, verify bool)
 	if modifiedCount > 0 {
 		parts = append(parts, fmt.Sprintf("%d modified", modifiedCount))
 	}
+	if warningCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d with warnings", warningCount))
+	}
 	parts = append(parts, fmt.Sprintf("%d up to date", upToDateCount))
 	if updatesAvailable == 1 {
 		parts = append(parts, "1 update available")
@@ -250,3 +340,13 @@ func joinParts(parts []string) string {
 	}
 	return result
 }
+
+// inStore reports whether path lies in one of the versioned stores.
+func inStore(roots []string, path string) bool {
+	for _, root := range roots {
+		if store.Contains(root, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+// Package companion installs the shell completions, man pages and licenses
+// that release archives often ship alongside the executable itself.
+package companion
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+// Kinds of companion file.
+const (
+	KindBashCompletion = "bash-completion"
+	KindZshCompletion  = "zsh-completion"
+	KindFishCompletion = "fish-completion"
+	KindManPage        = "man"
+	KindLicense        = "license"
+)
+
+var (
+	manPagePattern = regexp.MustCompile(`\.([1-9])[a-z]*(\.gz)?$`)
+	licensePattern = regexp.MustCompile(`(?i)^(licen[cs]e|copying|notice)([._-].*)?$`)
+)
+
+// DataDir returns the directory a scope's companion files are installed
+// under: the XDG data directory, defaulting to ~/.local/share, or
+// /usr/local/share for the system.
+func DataDir(s string) (string, error) {
+	if s == scope.System {
+		if runtime.GOOS == "windows" {
+			return filepath.Join(os.Getenv("ProgramData"), "execman", "share"), nil
+		}
+		return filepath.Join("/usr", "local", "share"), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "share"), nil
+}
+
+// Classify determines the kind of companion file an archive entry is, if any,
+// for the executable called execName. The second result is false if the entry
+// is not a companion file. A shell script is only taken for a completion if
+// it is in a completions directory or named after the executable, since
+// archives also ship scripts such as "scripts/env.zsh".
+func Classify(entryName, execName string) (string, bool) {
+	entryName = filepath.ToSlash(entryName)
+	base := filepath.Base(entryName)
+	lowerPath := strings.ToLower(entryName)
+	lowerBase := strings.ToLower(base)
+
+	if licensePattern.MatchString(base) {
+		return KindLicense, true
+	}
+
+	inCompletions := false
+	for _, part := range strings.Split(lowerPath, "/") {
+		switch part {
+		case "completions", "completion", "complete", "autocomplete", "shell-completions":
+			inCompletions = true
+		}
+	}
+
+	for _, suffix := range []struct{ ext, kind string }{
+		{".fish", KindFishCompletion},
+		{".zsh", KindZshCompletion},
+		{".bash", KindBashCompletion},
+		{".bash-completion", KindBashCompletion},
+	} {
+		stem, ok := strings.CutSuffix(lowerBase, suffix.ext)
+		if !ok {
+			continue
+		}
+		if inCompletions || strings.TrimPrefix(stem, "_") == strings.ToLower(execName) {
+			return suffix.kind, true
+		}
+		return "", false
+	}
+
+	if inCompletions {
+		switch {
+		case strings.HasPrefix(base, "_"), strings.Contains(lowerPath, "zsh"):
+			return KindZshCompletion, true
+		case strings.Contains(lowerPath, "fish"):
+			return KindFishCompletion, true
+		case strings.Contains(lowerPath, "bash"), filepath.Ext(base) == "":
+			return KindBashCompletion, true
+		}
+		return "", false
+	}
+
+	if manPagePattern.MatchString(lowerBase) {
+		return KindManPage, true
+	}
+
+	return "", false
+}
+
+// TargetPath returns where a companion file of the given kind should be
+// installed for the named executable.
+func TargetPath(dataDir, kind, entryName, execName string) string {
+	base := filepath.Base(filepath.ToSlash(entryName))
+	switch kind {
+	case KindBashCompletion:
+		// Bash-completion loads completions lazily by command name.
+		return filepath.Join(dataDir, "bash-completion", "completions", execName)
+	case KindZshCompletion:
+		return filepath.Join(dataDir, "zsh", "site-functions", "_"+execName)
+	case KindFishCompletion:
+		return filepath.Join(dataDir, "fish", "vendor_completions.d", execName+".fish")
+	case KindManPage:
+		section := manPagePattern.FindStringSubmatch(strings.ToLower(base))[1]
+		return filepath.Join(dataDir, "man", "man"+section, base)
+	default:
+		return filepath.Join(dataDir, "licenses", execName, base)
+	}
+}
+
+// Install extracts the companion files from an archive into the current
+// scope's data directory and returns records of the files that were
+// installed. A file that already exists belongs to another executable or to
+// the system, since callers remove the executable's own companion files
+// first, so it is left alone with a warning.
+func Install(archivePath, execName string, limits archive.Limits) ([]registry.CompanionFile, error) {
+	dataDir, err := DataDir(scope.Current())
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []registry.CompanionFile
+	seen := make(map[string]bool)
+	err = archive.WalkFiles(archivePath, limits, func(name string, mode int64, r io.Reader) error {
+		kind, ok := Classify(name, execName)
+		if !ok {
+			return nil
+		}
+		// An executable whose name happens to end in a digit is not a man page.
+		if kind == KindManPage && mode&0111 != 0 {
+			return nil
+		}
+
+		target := TargetPath(dataDir, kind, name, execName)
+		// Archives sometimes contain the same completion in several places,
+		// so only the first one found is installed.
+		if seen[target] {
+			return nil
+		}
+		seen[target] = true
+
+		if err := writeFile(target, r); errors.Is(err, fs.ErrExist) {
+			fmt.Printf("Warning: %s already exists and is not %s's, so it was left alone\n", target, execName)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		checksum, err := archive.CalculateChecksum(target)
+		if err != nil {
+			return err
+		}
+
+		installed = append(installed, registry.CompanionFile{
+			Kind:     kind,
+			Path:     target,
+			Checksum: checksum,
+		})
+		return nil
+	})
+	if err != nil {
+		return installed, err
+	}
+
+	return installed, nil
+}
+
+// Remove deletes previously installed companion files. Files that no longer
+// exist are ignored. The first error encountered is returned after attempting
+// to remove every file.
+func Remove(files []registry.CompanionFile) error {
+	var firstErr error
+	for _, f := range files {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove %s: %w", f.Path, err)
+		}
+		// Licenses live in a per-executable folder which should not be left behind.
+		if f.Kind == KindLicense {
+			_ = os.Remove(filepath.Dir(f.Path))
+		}
+	}
+	return firstErr
+}
+
+// writeFile writes the contents of r to a new file at path, creating parent
+// directories. It fails with fs.ErrExist if the file already exists.
+func writeFile(path string, r io.Reader) error {
+	// #nosec G301 -- Completion and man page directories must be readable by shells and man
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	// #nosec G302 G304 -- Companion files are documentation and must be world-readable
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer out.Close()
+
+	// #nosec G110 -- Entry size is bounded by the archive limits
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package companion
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		entry    string
+		wantKind string
+		wantOK   bool
+	}{
+		{"tool_1.0_linux_amd64/completions/tool.bash", KindBashCompletion, true},
+		{"completions/tool", KindBashCompletion, true},
+		{"completions/_tool", KindZshCompletion, true},
+		{"contrib/completion/zsh/_tool", KindZshCompletion, true},
+		{"completions/tool.fish", KindFishCompletion, true},
+		{"tool.zsh", KindZshCompletion, true},
+		{"tool-1.0/_tool.zsh", KindZshCompletion, true},
+		{"tool.bash-completion", KindBashCompletion, true},
+		{"scripts/env.zsh", "", false},
+		{"contrib/install.bash", "", false},
+		{"other.fish", "", false},
+		{"man/tool.1", KindManPage, true},
+		{"doc/tool.5.gz", KindManPage, true},
+		{"LICENSE", KindLicense, true},
+		{"dist/LICENSE-MIT", KindLicense, true},
+		{"COPYING.txt", KindLicense, true},
+		{"README.md", "", false},
+		{"tool", "", false},
+		{"completions/tool.ps1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			kind, ok := Classify(tt.entry, "tool")
+			if ok != tt.wantOK || kind != tt.wantKind {
+				t.Errorf("Classify(%q) = (%q, %v), want (%q, %v)", tt.entry, kind, ok, tt.wantKind, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	xdgDataHome := filepath.Join(os.TempDir(), "share")
+	t.Setenv("XDG_DATA_HOME", xdgDataHome)
+
+	user, err := DataDir(scope.User)
+	if err != nil {
+		t.Fatalf("DataDir(user) error: %v", err)
+	}
+	if user != xdgDataHome {
+		t.Errorf("DataDir(user) = %q, want $XDG_DATA_HOME", user)
+	}
+
+	system, err := DataDir(scope.System)
+	if err != nil {
+		t.Fatalf("DataDir(system) error: %v", err)
+	}
+	if system == user {
+		t.Errorf("DataDir(system) = %q, the user's data directory", system)
+	}
+	if runtime.GOOS != "windows" && system != "/usr/local/share" {
+		t.Errorf("DataDir(system) = %q, want /usr/local/share", system)
+	}
+}
+
+func TestInstallAndRemove(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "companion-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataDir := filepath.Join(tmpDir, "share")
+	t.Setenv("XDG_DATA_HOME", dataDir)
+
+	archivePath := filepath.Join(tmpDir, "tool.tar.gz")
+	writeTarGz(t, archivePath, map[string]string{
+		"tool":                  "#!/bin/sh\n",
+		"completions/tool.bash": "complete -F _tool tool\n",
+		"completions/_tool":     "#compdef tool\n",
+		"man/tool.1":            ".TH TOOL 1\n",
+		"LICENSE":               "MIT\n",
+		"README.md":             "readme\n",
+	})
+
+	files, err := Install(archivePath, "tool", archive.DefaultLimits)
+	if err != nil {
+		t.Fatalf("Install returned error: %v", err)
+	}
+
+	want := []string{
+		filepath.Join(dataDir, "bash-completion", "completions", "tool"),
+		filepath.Join(dataDir, "zsh", "site-functions", "_tool"),
+		filepath.Join(dataDir, "man", "man1", "tool.1"),
+		filepath.Join(dataDir, "licenses", "tool", "LICENSE"),
+	}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d companion files, got %d: %+v", len(want), len(files), files)
+	}
+	for _, path := range want {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+
+	if err := Remove(files); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	for _, path := range want {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "licenses", "tool")); !os.IsNotExist(err) {
+		t.Error("expected license directory to be removed")
+	}
+}
+
+func TestInstallLeavesOtherFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "companion-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataDir := filepath.Join(tmpDir, "share")
+	t.Setenv("XDG_DATA_HOME", dataDir)
+
+	// Another tool, or the system, already has a man page of the same name.
+	manPage := filepath.Join(dataDir, "man", "man1", "tool.1")
+	if err := os.MkdirAll(filepath.Dir(manPage), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manPage, []byte("theirs\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(tmpDir, "tool.tar.gz")
+	writeTarGz(t, archivePath, map[string]string{
+		"tool":                  "#!/bin/sh\n",
+		"completions/tool.bash": "complete -F _tool tool\n",
+		"man/tool.1":            ".TH TOOL 1\n",
+	})
+
+	files, err := Install(archivePath, "tool", archive.DefaultLimits)
+	if err != nil {
+		t.Fatalf("Install returned error: %v", err)
+	}
+	if len(files) != 1 || files[0].Kind != KindBashCompletion {
+		t.Fatalf("Install() = %+v, want only the completion", files)
+	}
+	if err := Remove(files); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if data, err := os.ReadFile(manPage); err != nil || string(data) != "theirs\n" {
+		t.Errorf("%s reads %q (%v), want it left alone", manPage, data, err)
+	}
+}
+
+// writeTarGz creates a tar.gz archive containing the given files. The file
+// named "tool" is marked executable.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		mode := int64(0644)
+		if name == "tool" {
+			mode = 0755
+		}
+		hdr := &tar.Header{Name: name, Mode: mode, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+}
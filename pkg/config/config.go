@@ -5,45 +5,143 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/scope"
 )
 
 // Config represents the execman configuration.
 type Config struct {
 	DefaultInstallDir  string `json:"default_install_dir,omitempty"`
 	IncludePrereleases bool   `json:"include_prereleases"`
-	path               string // internal, not serialized
+	InstallCompanions  bool   `json:"install_companions,omitempty"`
+	// Locations names install directories, such as "work" for "~/work/bin",
+	// so that they can be chosen with "--into @work".
+	Locations map[string]string `json:"locations,omitempty"`
+	// MaxDownloadSize caps the size of any single download in bytes.
+	MaxDownloadSize int64 `json:"max_download_size,omitempty"`
+	// ExtractionLimits caps the resources that extracting an archive may use.
+	ExtractionLimits archive.Limits `json:"extraction_limits"`
+	// CacheMaxSize caps the size of the download cache in bytes.
+	CacheMaxSize int64 `json:"cache_max_size,omitempty"`
+	// PlatformCheck controls what happens when an extracted binary does not
+	// target the host platform.
+	PlatformCheck string `json:"platform_check,omitempty"`
+	// InstallDirCheck controls what happens when an install directory can be
+	// written by other users.
+	InstallDirCheck string `json:"install_dir_check,omitempty"`
+	// ChecksumPolicy controls whether downloads must be verified against a
+	// published checksum. Executables may override it individually.
+	ChecksumPolicy string `json:"checksum_policy,omitempty"`
+	// SignaturePolicy controls whether downloads must carry a signature by a
+	// trusted signer. Sources and executables may override it individually.
+	SignaturePolicy string `json:"signature_policy,omitempty"`
+	// SigstoreRoots names a PEM file of the Sigstore root and intermediate
+	// certificates that keyless signing certificates must chain to.
+	SigstoreRoots string `json:"sigstore_roots,omitempty"`
+	// RekorPublicKey names a PEM file holding the transparency log's public
+	// key. Keyless signatures and provenance must have been logged, so they
+	// cannot be verified without it.
+	RekorPublicKey string `json:"rekor_public_key,omitempty"`
+	// TrustedBuilders are prefixes of the workflow identities trusted to sign
+	// build provenance for any source, in addition to the SLSA GitHub
+	// generator and each source's own workflows.
+	TrustedBuilders []string `json:"trusted_builders,omitempty"`
+	// Sources configures verification for individual sources, keyed by
+	// "github.com/owner/repo".
+	Sources   map[string]*SourceTrust `json:"sources,omitempty"`
+	path      string                  // internal, not serialized
+	scopeName string                  // internal, not serialized
+}
+
+// SourceTrust configures who is trusted to sign a source's releases.
+type SourceTrust struct {
+	// SignaturePolicy overrides the configured signature policy for the source.
+	SignaturePolicy string `json:"signature_policy,omitempty"`
+	// CosignIdentity is the certificate identity expected of keyless
+	// signatures, such as a GitHub Actions workflow URI.
+	CosignIdentity string `json:"cosign_identity,omitempty"`
+	// CosignIdentityRegexp matches the certificate identity instead.
+	CosignIdentityRegexp string `json:"cosign_identity_regexp,omitempty"`
+	// CosignIssuer is the OIDC issuer expected of keyless signatures.
+	CosignIssuer string `json:"cosign_issuer,omitempty"`
+	// CosignPublicKey names a PEM file holding the key for key-based signatures.
+	CosignPublicKey string `json:"cosign_public_key,omitempty"`
+	// MinisignPublicKey and GPGPublicKey name files holding the publisher's
+	// keys. When unset, the key is trusted on first use and pinned.
+	MinisignPublicKey string `json:"minisign_public_key,omitempty"`
+	GPGPublicKey      string `json:"gpg_public_key,omitempty"`
 }
 
-// DefaultConfigPath returns the default config file path.
+// Policy levels for checks that can be disabled, reported or enforced.
+const (
+	PolicyOff     = "off"
+	PolicyWarn    = "warn"
+	PolicyRequire = "require"
+)
+
+// DefaultMaxDownloadSize is the download size limit used when none is configured.
+const DefaultMaxDownloadSize = 1 << 30
+
+// DefaultCacheMaxSize is the download cache size cap used when none is configured.
+const DefaultCacheMaxSize = 1 << 30
+
+// DefaultConfigPath returns the config file path of the current scope.
 func DefaultConfigPath() (string, error) {
-	configDir, err := os.UserConfigDir()
+	return ScopeConfigPath(scope.Current())
+}
+
+// ScopeConfigPath returns the config file path of a scope.
+func ScopeConfigPath(s string) (string, error) {
+	configDir, err := scope.ConfigDir(s)
 	if err != nil {
-		return "", fmt.Errorf("failed to get user config directory: %w", err)
+		return "", err
 	}
-	return filepath.Join(configDir, "execman", "config.json"), nil
+	return filepath.Join(configDir, "config.json"), nil
 }
 
-// Load loads the config from the default location.
+// Load loads the config of the current scope.
 func Load() (*Config, error) {
-	path, err := DefaultConfigPath()
+	return LoadScope(scope.Current())
+}
+
+// LoadScope loads the config of a scope.
+func LoadScope(s string) (*Config, error) {
+	path, err := ScopeConfigPath(s)
 	if err != nil {
 		return nil, err
 	}
-	return LoadFrom(path)
+	return loadFrom(path, s)
 }
 
 // LoadFrom loads the config from a specific path.
 func LoadFrom(path string) (*Config, error) {
+	return loadFrom(path, scope.Current())
+}
+
+// loadFrom loads the config from a specific path, using the defaults of a
+// scope.
+func loadFrom(path, s string) (*Config, error) {
 	// If file doesn't exist, return a new config with defaults.
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		homeDir, err := os.UserHomeDir()
+		installDir, err := scope.DefaultInstallDir(s)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+			return nil, err
 		}
 		return &Config{
-			DefaultInstallDir:  filepath.Join(homeDir, ".local", "bin"),
+			DefaultInstallDir:  installDir,
 			IncludePrereleases: false,
+			MaxDownloadSize:    DefaultMaxDownloadSize,
+			ExtractionLimits:   archive.DefaultLimits,
+			CacheMaxSize:       DefaultCacheMaxSize,
+			PlatformCheck:      PolicyRequire,
+			InstallDirCheck:    PolicyWarn,
+			ChecksumPolicy:     PolicyWarn,
+			SignaturePolicy:    PolicyWarn,
 			path:               path,
+			scopeName:          s,
 		}, nil
 	}
 
@@ -59,24 +157,224 @@ func LoadFrom(path string) (*Config, error) {
 	}
 
 	cfg.path = path
+	cfg.scopeName = s
 
 	// Set defaults if not specified.
 	if cfg.DefaultInstallDir == "" {
-		homeDir, err := os.UserHomeDir()
+		installDir, err := scope.DefaultInstallDir(s)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+			return nil, err
+		}
+		cfg.DefaultInstallDir = installDir
+	}
+
+	// Unset limits take their defaults; a negative value disables a limit.
+	if cfg.MaxDownloadSize == 0 {
+		cfg.MaxDownloadSize = DefaultMaxDownloadSize
+	}
+	if cfg.ExtractionLimits.MaxTotalSize == 0 {
+		cfg.ExtractionLimits.MaxTotalSize = archive.DefaultLimits.MaxTotalSize
+	}
+	if cfg.ExtractionLimits.MaxEntrySize == 0 {
+		cfg.ExtractionLimits.MaxEntrySize = archive.DefaultLimits.MaxEntrySize
+	}
+	if cfg.ExtractionLimits.MaxEntries == 0 {
+		cfg.ExtractionLimits.MaxEntries = archive.DefaultLimits.MaxEntries
+	}
+	if cfg.CacheMaxSize == 0 {
+		cfg.CacheMaxSize = DefaultCacheMaxSize
+	}
+
+	if cfg.PlatformCheck == "" {
+		cfg.PlatformCheck = PolicyRequire
+	}
+	if err := ValidatePolicy(cfg.PlatformCheck); err != nil {
+		return nil, fmt.Errorf("invalid platform_check: %w", err)
+	}
+
+	for name, dir := range cfg.Locations {
+		if name == "" || strings.ContainsAny(name, "@/\\") {
+			return nil, fmt.Errorf("invalid location name %q", name)
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("location %q has no directory", name)
+		}
+	}
+
+	if cfg.InstallDirCheck == "" {
+		cfg.InstallDirCheck = PolicyWarn
+	}
+	if err := ValidatePolicy(cfg.InstallDirCheck); err != nil {
+		return nil, fmt.Errorf("invalid install_dir_check: %w", err)
+	}
+
+	if cfg.ChecksumPolicy == "" {
+		cfg.ChecksumPolicy = PolicyWarn
+	}
+	if err := ValidatePolicy(cfg.ChecksumPolicy); err != nil {
+		return nil, fmt.Errorf("invalid checksum_policy: %w", err)
+	}
+
+	if cfg.SignaturePolicy == "" {
+		cfg.SignaturePolicy = PolicyWarn
+	}
+	if err := ValidatePolicy(cfg.SignaturePolicy); err != nil {
+		return nil, fmt.Errorf("invalid signature_policy: %w", err)
+	}
+	for source, trust := range cfg.Sources {
+		if trust != nil && trust.SignaturePolicy != "" {
+			if err := ValidatePolicy(trust.SignaturePolicy); err != nil {
+				return nil, fmt.Errorf("invalid signature_policy for %s: %w", source, err)
+			}
 		}
-		cfg.DefaultInstallDir = filepath.Join(homeDir, ".local", "bin")
 	}
 
 	return &cfg, nil
 }
 
+// ValidatePolicy returns an error if policy is not one of the policy levels.
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case PolicyOff, PolicyWarn, PolicyRequire:
+		return nil
+	default:
+		return fmt.Errorf("%q is not one of %s, %s or %s", policy, PolicyOff, PolicyWarn, PolicyRequire)
+	}
+}
+
+// WeakerPolicy reports whether policy a checks less than policy b. An empty
+// policy is the default, "warn".
+func WeakerPolicy(a, b string) bool {
+	return policyRank(a) < policyRank(b)
+}
+
+// StricterPolicy returns the stricter of an override and the configured
+// policy. An empty override leaves the configured policy in force.
+func StricterPolicy(override, configured string) string {
+	if override == "" || WeakerPolicy(override, configured) {
+		return configured
+	}
+	return override
+}
+
+// policyRank orders the policy levels from the weakest.
+func policyRank(policy string) int {
+	switch policy {
+	case PolicyOff:
+		return 0
+	case PolicyRequire:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// TrustFor returns the verification settings for a source, given as a URL
+// such as "https://github.com/owner/repo". It never returns nil.
+func (c *Config) TrustFor(source string) *SourceTrust {
+	key := strings.TrimPrefix(strings.TrimPrefix(source, "https://"), "http://")
+	key = strings.TrimSuffix(key, "/")
+	for name, trust := range c.Sources {
+		if trust != nil && strings.EqualFold(name, key) {
+			return trust
+		}
+	}
+	return &SourceTrust{}
+}
+
+// ResolveInstallDir returns the directory that an "--into" argument names,
+// and the name of the location it belongs to, if any. The argument is either
+// "@name" for a configured location, a directory, or empty for the default
+// install directory.
+func (c *Config) ResolveInstallDir(into string) (string, string, error) {
+	if name, ok := strings.CutPrefix(into, "@"); ok {
+		dir, found := c.Locations[name]
+		if !found {
+			return "", "", fmt.Errorf("unknown location %q; configured locations are: %s", into, c.locationNames())
+		}
+		dir, err := ExpandPath(dir)
+		if err != nil {
+			return "", "", err
+		}
+		return dir, name, nil
+	}
+
+	if into == "" {
+		into = c.DefaultInstallDir
+	}
+	dir, err := ExpandPath(into)
+	if err != nil {
+		return "", "", err
+	}
+	return dir, c.LocationOf(dir), nil
+}
+
+// LocationOf returns the name of the configured location whose directory is
+// dir, or "" if there is none.
+func (c *Config) LocationOf(dir string) string {
+	dir = filepath.Clean(dir)
+	for _, name := range sortedNames(c.Locations) {
+		if locationDir, err := ExpandPath(c.Locations[name]); err == nil && locationDir == dir {
+			return name
+		}
+	}
+	return ""
+}
+
+// LocationName returns the name of the location an executable installed at
+// path belongs to: the location recorded for it, or else the configured
+// location of its directory.
+func (c *Config) LocationName(recorded, path string) string {
+	if recorded != "" {
+		return recorded
+	}
+	return c.LocationOf(filepath.Dir(path))
+}
+
+// locationNames lists the configured location names for messages.
+func (c *Config) locationNames() string {
+	names := sortedNames(c.Locations)
+	if len(names) == 0 {
+		return "none"
+	}
+	for i, name := range names {
+		names[i] = "@" + name
+	}
+	return strings.Join(names, ", ")
+}
+
+// sortedNames returns the keys of a map in order.
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandPath expands a leading "~" to the user's home directory and makes
+// the path absolute.
+func ExpandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	return abs, nil
+}
+
 // Save saves the config to disk.
 func (c *Config) Save() error {
 	// Ensure directory exists.
 	dir := filepath.Dir(c.path)
-	if err := os.MkdirAll(dir, 0750); err != nil {
+	if err := os.MkdirAll(dir, scope.DirMode(c.scopeName)); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
@@ -85,8 +383,9 @@ func (c *Config) Save() error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	// Use 0600 permissions for config file (user read/write only).
-	if err := os.WriteFile(c.path, data, 0600); err != nil {
+	// The user's config is private to them; the system's is readable by
+	// every user.
+	if err := os.WriteFile(c.path, data, scope.FileMode(c.scopeName)); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+func TestResolveInstallDir(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-config-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &Config{
+		DefaultInstallDir: filepath.Join(homeDir, ".local", "bin"),
+		Locations: map[string]string{
+			"user":   "~/.local/bin",
+			"shared": tmpDir,
+		},
+	}
+
+	tests := []struct {
+		name         string
+		into         string
+		wantDir      string
+		wantLocation string
+		wantErr      bool
+	}{
+		{name: "default", into: "", wantDir: filepath.Join(homeDir, ".local", "bin"), wantLocation: "user"},
+		{name: "named location", into: "@shared", wantDir: tmpDir, wantLocation: "shared"},
+		{name: "directory of a location", into: tmpDir + string(filepath.Separator), wantDir: tmpDir, wantLocation: "shared"},
+		{name: "other directory", into: filepath.Join(tmpDir, "other"), wantDir: filepath.Join(tmpDir, "other")},
+		{name: "unknown location", into: "@work", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, location, err := cfg.ResolveInstallDir(tt.into)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ResolveInstallDir() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveInstallDir() error: %v", err)
+			}
+			if dir != tt.wantDir || location != tt.wantLocation {
+				t.Errorf("ResolveInstallDir() = %q, %q; want %q, %q", dir, location, tt.wantDir, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestLoadScopeDefaults(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-config-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	missing := filepath.Join(tmpDir, "config.json")
+	for _, s := range []string{scope.User, scope.System} {
+		t.Run(s, func(t *testing.T) {
+			want, err := scope.DefaultInstallDir(s)
+			if err != nil {
+				t.Skip("no default install directory")
+			}
+			cfg, err := loadFrom(missing, s)
+			if err != nil {
+				t.Fatalf("loadFrom() error: %v", err)
+			}
+			if cfg.DefaultInstallDir != want {
+				t.Errorf("DefaultInstallDir = %q, want %q", cfg.DefaultInstallDir, want)
+			}
+		})
+	}
+
+	user, _ := scope.DefaultInstallDir(scope.User)
+	system, _ := scope.DefaultInstallDir(scope.System)
+	if user == system {
+		t.Errorf("user and system scopes share the install directory %q", user)
+	}
+}
+
+func TestSaveScopePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-config-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		scope    string
+		wantDir  os.FileMode
+		wantFile os.FileMode
+	}{
+		{scope: scope.User, wantDir: 0750, wantFile: 0600},
+		{scope: scope.System, wantDir: 0755, wantFile: 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.scope, "config.json")
+			cfg, err := loadFrom(path, tt.scope)
+			if err != nil {
+				t.Fatalf("loadFrom() error: %v", err)
+			}
+			if err := cfg.Save(); err != nil {
+				t.Fatalf("Save() error: %v", err)
+			}
+
+			// The umask may only take permissions away.
+			dirInfo, err := os.Stat(filepath.Dir(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileInfo, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dirInfo.Mode().Perm()&^tt.wantDir != 0 || fileInfo.Mode().Perm()&^tt.wantFile != 0 {
+				t.Errorf("modes = %v, %v, want at most %v, %v", dirInfo.Mode().Perm(), fileInfo.Mode().Perm(), tt.wantDir, tt.wantFile)
+			}
+			if tt.scope == scope.System && fileInfo.Mode().Perm()&0004 == 0 {
+				t.Errorf("system config mode %v is not readable by other users", fileInfo.Mode().Perm())
+			}
+		})
+	}
+}
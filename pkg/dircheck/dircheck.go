@@ -0,0 +1,220 @@
+// Package dircheck checks that a directory is a safe place to install
+// executables into, and that executables installed there are the ones found
+// on PATH.
+package dircheck
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrUnsafeDir is returned when an install directory is refused as unsafe.
+var ErrUnsafeDir = errors.New("unsafe install directory")
+
+// Kinds of issue.
+const (
+	// KindWorldWritable means any user can replace files in the directory.
+	KindWorldWritable = "world-writable"
+	// KindForeignOwner means the directory belongs to another user.
+	KindForeignOwner = "foreign-owner"
+	// KindNotOnPath means executables in the directory are not found by name.
+	KindNotOnPath = "not-on-path"
+	// KindShadowed means another file of the same name is found first on PATH.
+	KindShadowed = "shadowed"
+)
+
+// Issue is a problem with an install directory or an installed executable.
+type Issue struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	// Path is the shadowing file, for KindShadowed.
+	Path string `json:"path,omitempty"`
+}
+
+// Unsafe reports whether the issue lets another user tamper with the
+// executables, rather than merely making them hard to run.
+func (i Issue) Unsafe() bool {
+	return i.Kind == KindWorldWritable || i.Kind == KindForeignOwner
+}
+
+// String returns the issue's message.
+func (i Issue) String() string {
+	return i.Message
+}
+
+// Dir checks a directory that executables are, or are about to be, installed
+// into. A directory that does not exist yet is judged by its nearest existing
+// ancestor, which is where it will be created.
+func Dir(dir string) ([]Issue, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	existing := abs
+	for {
+		_, err := os.Stat(existing)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to check %s: %w", existing, err)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	issues, err := permissionIssues(existing)
+	if err != nil {
+		return nil, err
+	}
+	if pathIndex(abs, searchPath()) < 0 {
+		issues = append(issues, Issue{
+			Kind:    KindNotOnPath,
+			Message: fmt.Sprintf("%s is not on PATH, so executables installed there must be run by their full path", abs),
+		})
+	}
+	return issues, nil
+}
+
+// Shadowed returns an issue for each file that would be run instead of the
+// executable at path when it is run by name: files of the same name in
+// directories earlier on PATH, or anywhere on PATH if its own directory is not
+// on PATH.
+func Shadowed(path string) []Issue {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	dirs := searchPath()
+	limit := pathIndex(filepath.Dir(abs), dirs)
+	if limit < 0 {
+		limit = len(dirs)
+	}
+
+	var issues []Issue
+	seen := map[string]bool{}
+	for _, dir := range dirs[:limit] {
+		for _, name := range candidateNames(filepath.Base(abs)) {
+			candidate := filepath.Join(dir, name)
+			if seen[candidate] || sameFile(candidate, abs) || !isExecutable(candidate) {
+				continue
+			}
+			seen[candidate] = true
+			issues = append(issues, Issue{
+				Kind:    KindShadowed,
+				Message: fmt.Sprintf("%s is found on PATH before %s", candidate, abs),
+				Path:    candidate,
+			})
+		}
+	}
+	return issues
+}
+
+// Preflight checks the directory an executable is about to be installed into
+// at path, and applies a policy of "off", "warn" or "require". Under
+// "require" an unsafe directory is returned as an error; otherwise its issues
+// are passed to warn. A directory that is not on PATH, or another file of the
+// same name earlier on PATH, is only ever warned about, since the install
+// itself is sound.
+func Preflight(path, policy string, warn func(Issue)) error {
+	if policy == "off" {
+		return nil
+	}
+
+	issues, err := Dir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	issues = append(issues, Shadowed(path)...)
+
+	var unsafe []string
+	for _, issue := range issues {
+		if policy == "require" && issue.Unsafe() {
+			unsafe = append(unsafe, issue.Message)
+			continue
+		}
+		warn(issue)
+	}
+	if len(unsafe) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnsafeDir, strings.Join(unsafe, "; "))
+	}
+	return nil
+}
+
+// searchPath returns the directories on PATH, cleaned and made absolute.
+// Relative entries are dropped, since they depend on the working directory.
+func searchPath() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs
+}
+
+// pathIndex returns the position of dir on PATH, or -1. Directories are
+// compared after resolving symlinks, so that a symlinked bin directory is
+// recognized.
+func pathIndex(dir string, dirs []string) int {
+	for i, candidate := range dirs {
+		if sameDir(candidate, dir) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameDir reports whether two directory paths name the same directory.
+func sameDir(a, b string) bool {
+	if equalPaths(a, b) {
+		return true
+	}
+	ra, errA := filepath.EvalSymlinks(a)
+	rb, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && equalPaths(ra, rb)
+}
+
+// sameFile reports whether two paths name the same existing file.
+func sameFile(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
+}
+
+// equalPaths compares cleaned paths, ignoring case on Windows.
+func equalPaths(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// candidateNames returns the file names that running name would look for. On
+// Windows a name without an extension is tried with each of PATHEXT.
+func candidateNames(name string) []string {
+	if runtime.GOOS != "windows" || filepath.Ext(name) != "" {
+		return []string{name}
+	}
+	exts := os.Getenv("PATHEXT")
+	if exts == "" {
+		exts = ".COM;.EXE;.BAT;.CMD"
+	}
+	names := []string{}
+	for _, ext := range strings.Split(exts, ";") {
+		if ext != "" {
+			names = append(names, name+strings.ToLower(ext))
+		}
+	}
+	return names
+}
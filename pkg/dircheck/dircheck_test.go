@@ -0,0 +1,168 @@
+package dircheck
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeExecutable creates an executable file named name in dir.
+func writeExecutable(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func kinds(issues []Issue) string {
+	var result []string
+	for _, issue := range issues {
+		result = append(result, issue.Kind)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestShadowed(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-dircheck-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	name := "tool"
+	if runtime.GOOS == "windows" {
+		name = "tool.exe"
+	}
+	stale := filepath.Join(tmpDir, "stale")
+	managed := filepath.Join(tmpDir, "managed")
+	other := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{stale, managed, other} {
+		if err := os.Mkdir(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stalePath := writeExecutable(t, stale, name)
+	managedPath := writeExecutable(t, managed, name)
+
+	tests := []struct {
+		name     string
+		path     []string
+		wantPath string
+	}{
+		{name: "stale copy first", path: []string{stale, managed}, wantPath: stalePath},
+		{name: "managed copy first", path: []string{managed, stale}},
+		{name: "unrelated directory first", path: []string{other, managed}},
+		{name: "managed directory not on PATH", path: []string{other, stale}, wantPath: stalePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATH", strings.Join(tt.path, string(os.PathListSeparator)))
+			issues := Shadowed(managedPath)
+			if tt.wantPath == "" {
+				if len(issues) != 0 {
+					t.Errorf("Shadowed() = %v, want no issues", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Kind != KindShadowed || issues[0].Path != tt.wantPath {
+				t.Errorf("Shadowed() = %v, want %s shadowing", issues, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-dircheck-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bin := filepath.Join(tmpDir, "bin")
+	shared := filepath.Join(tmpDir, "shared")
+	for _, dir := range []string{bin, shared} {
+		if err := os.Mkdir(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// #nosec G302 -- Deliberately unsafe directory under test
+	if err := os.Chmod(shared, 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", strings.Join([]string{bin, shared}, string(os.PathListSeparator)))
+
+	tests := []struct {
+		name      string
+		dir       string
+		wantKinds string
+		unixOnly  bool
+	}{
+		{name: "safe directory on PATH", dir: bin},
+		{name: "directory not on PATH", dir: tmpDir, wantKinds: KindNotOnPath},
+		{name: "directory yet to be created", dir: filepath.Join(bin, "sub"), wantKinds: KindNotOnPath},
+		{name: "world-writable directory", dir: shared, wantKinds: KindWorldWritable, unixOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("file modes do not reflect Windows permissions")
+			}
+			issues, err := Dir(tt.dir)
+			if err != nil {
+				t.Fatalf("Dir() error: %v", err)
+			}
+			if got := kinds(issues); got != tt.wantKinds {
+				t.Errorf("Dir() issues = %q, want %q", got, tt.wantKinds)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not reflect Windows permissions")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-dircheck-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// #nosec G302 -- Deliberately unsafe directory under test
+	if err := os.Chmod(tmpDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir)
+	target := filepath.Join(tmpDir, "tool")
+
+	tests := []struct {
+		policy       string
+		wantErr      bool
+		wantWarnings int
+	}{
+		{policy: "off"},
+		{policy: "warn", wantWarnings: 1},
+		{policy: "require", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			warnings := 0
+			err := Preflight(target, tt.policy, func(Issue) { warnings++ })
+			if tt.wantErr != errors.Is(err, ErrUnsafeDir) {
+				t.Errorf("Preflight() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if warnings != tt.wantWarnings {
+				t.Errorf("Preflight() warned %d times, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package dircheck
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// permissionIssues reports whether a directory is writable by other users,
+// either because it is world-writable or because another user owns it.
+func permissionIssues(dir string) ([]Issue, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", dir, err)
+	}
+
+	var issues []Issue
+	if info.Mode().Perm()&0002 != 0 {
+		issues = append(issues, Issue{
+			Kind:    KindWorldWritable,
+			Message: fmt.Sprintf("%s is world-writable, so any user can replace executables in it", dir),
+		})
+	}
+	if uid, foreign := ForeignOwner(info); foreign {
+		issues = append(issues, Issue{
+			Kind:    KindForeignOwner,
+			Message: fmt.Sprintf("%s is owned by another user (uid %d), who can replace executables in it", dir, uid),
+		})
+	}
+	return issues, nil
+}
+
+// ForeignOwner reports whether a file belongs to a user other than the
+// current user and root, and returns the owner's user id. Files owned by root
+// are not foreign, since root can replace anything.
+func ForeignOwner(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), int(stat.Uid) != os.Getuid() && stat.Uid != 0
+}
+
+// isExecutable reports whether path is a file that can be executed.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
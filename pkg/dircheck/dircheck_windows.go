@@ -0,0 +1,24 @@
+//go:build windows
+
+package dircheck
+
+import "os"
+
+// permissionIssues reports nothing on Windows, where access is governed by
+// ACLs that file modes do not reflect.
+func permissionIssues(dir string) ([]Issue, error) {
+	return nil, nil
+}
+
+// isExecutable reports whether path is a file. Windows decides what is
+// executable by extension, which the candidate names already carry.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// ForeignOwner reports nothing on Windows, where ownership is not exposed
+// through file info.
+func ForeignOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,124 @@
+// Package export implements the export and import commands, which move the
+// managed executables from one machine to another.
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/list"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// NewExportCommand creates the export command.
+func NewExportCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write a portable description of the managed executables",
+		Long: `Write the managed executables, with their sources, versions, names, install
+locations, policies and pinned publisher keys, as a manifest that
+'execman import' (or 'execman sync') can reinstall on another machine.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return RunExport(output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of standard output")
+
+	return cmd
+}
+
+// RunExport executes the export command.
+func RunExport(output string) error {
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	m, err := Export(reg, cfg)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return m.Write(os.Stdout)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", output, err)
+	}
+	if err := m.Write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d executables to %s\n", len(m.Tools), output)
+	return nil
+}
+
+// Export describes the executables in a registry as a manifest pinning each
+// to its installed version. Install directories are given as named
+// locations where possible, and otherwise relative to the home directory, so
+// that the manifest can be used on other machines.
+func Export(reg *registry.Registry, cfg *config.Config) (*manifest.Manifest, error) {
+	homeDir, _ := os.UserHomeDir()
+	m := &manifest.Manifest{Tools: []manifest.Tool{}}
+
+	names := reg.List()
+	sort.Strings(names)
+	for _, name := range names {
+		exec, ok := reg.Get(name)
+		if !ok {
+			continue
+		}
+		owner, repo, _, err := github.ParseSource(exec.Source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		tool := manifest.Tool{
+			Source:          strings.TrimPrefix(exec.Source, "https://"),
+			Version:         exec.Version,
+			Prerelease:      exec.Prerelease,
+			ChecksumPolicy:  exec.ChecksumPolicy,
+			SignaturePolicy: exec.SignaturePolicy,
+		}
+		if name != repo {
+			tool.Name = name
+		}
+		if location := cfg.LocationName(exec.Location, exec.Path); location != "" {
+			tool.Location = "@" + location
+		} else if dir := filepath.Dir(exec.Path); dir != cfg.DefaultInstallDir {
+			tool.Location = list.DisplayPath(dir, homeDir)
+		}
+		m.Tools = append(m.Tools, tool)
+
+		if key, ok := reg.GetKey(exec.Source); ok {
+			if m.Keys == nil {
+				m.Keys = map[string]*registry.PinnedKey{}
+			}
+			m.Keys[github.ToURL(owner, repo)] = key
+		}
+	}
+	return m, nil
+}
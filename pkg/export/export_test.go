@@ -0,0 +1,99 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/sync"
+)
+
+func TestExport(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-export-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binDir := filepath.Join(tmpDir, "bin")
+	workDir := filepath.Join(tmpDir, "work")
+	otherDir := filepath.Join(tmpDir, "other")
+	cfg := &config.Config{DefaultInstallDir: binDir, Locations: map[string]string{"work": workDir}}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Add("tool", &registry.Executable{Source: "https://github.com/owner/tool", Version: "v1.2.3", Path: filepath.Join(binDir, "tool")})
+	reg.Add("gh", &registry.Executable{Source: "https://github.com/cli/cli", Version: "v2.40.0", Path: filepath.Join(workDir, "gh"), Location: "work"})
+	reg.Add("beta", &registry.Executable{Source: "https://github.com/owner/beta", Version: "v2.0.0-rc.1", Path: filepath.Join(otherDir, "beta"), Prerelease: true, SignaturePolicy: config.PolicyRequire})
+	key := &registry.PinnedKey{Type: "minisign", ID: "ABCD", PublicKey: "key", PinnedAt: time.Now().UTC()}
+	reg.PinKey("https://github.com/owner/tool", key)
+
+	m, err := Export(reg, cfg)
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+
+	// Write the export and read it back as a manifest.
+	exportPath := filepath.Join(tmpDir, "tools.json")
+	file, err := os.Create(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write(file); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	file.Close()
+	m, err = manifest.Load(exportPath)
+	if err != nil {
+		t.Fatalf("Load() of export error: %v", err)
+	}
+
+	want := map[string]manifest.Tool{
+		"beta": {Source: "https://github.com/owner/beta", Version: "v2.0.0-rc.1", Location: otherDir, Prerelease: true, SignaturePolicy: config.PolicyRequire},
+		"gh":   {Source: "https://github.com/cli/cli", Version: "v2.40.0", Location: "@work"},
+		"tool": {Source: "https://github.com/owner/tool", Version: "v1.2.3"},
+	}
+	if len(m.Tools) != len(want) {
+		t.Fatalf("Export() wrote %d tools, want %d", len(m.Tools), len(want))
+	}
+	for _, tool := range m.Tools {
+		w := want[tool.Name]
+		if tool.Source != w.Source || tool.Version != w.Version || tool.Location != w.Location ||
+			tool.Prerelease != w.Prerelease || tool.SignaturePolicy != w.SignaturePolicy {
+			t.Errorf("tool %s = %+v, want %+v", tool.Name, tool, w)
+		}
+	}
+	if got := m.Keys["https://github.com/owner/tool"]; got == nil || got.ID != key.ID {
+		t.Errorf("Keys = %v, want the pinned key of owner/tool", m.Keys)
+	}
+
+	// Importing into an empty registry installs every tool at its exported
+	// version, and pins the exported keys.
+	fresh, err := registry.LoadFrom(filepath.Join(tmpDir, "fresh.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions, err := sync.Plan(m, fresh, cfg, false, nil, func(tool *manifest.Tool) (string, error) {
+		return tool.Version, nil
+	})
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	for _, a := range actions {
+		if a.Kind != sync.ActionInstall || a.To != want[a.Name].Version {
+			t.Errorf("action for %s = %s %s, want install %s", a.Name, a.Kind, a.To, want[a.Name].Version)
+		}
+	}
+	if err := sync.PinKeys(m, fresh); err != nil {
+		t.Fatalf("PinKeys() error: %v", err)
+	}
+	if got, ok := fresh.GetKey("https://github.com/owner/tool"); !ok || got.ID != key.ID {
+		t.Errorf("PinKeys() did not pin the exported key")
+	}
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/sync"
+	"github.com/spf13/cobra"
+)
+
+// ImportOptions represents the import command options.
+type ImportOptions struct {
+	File string
+	// Latest installs the newest release of each executable rather than the
+	// exported version.
+	Latest bool
+	DryRun bool
+	Yes    bool
+}
+
+// NewImportCommand creates the import command.
+func NewImportCommand() *cobra.Command {
+	var latest bool
+	var dryRun bool
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Reinstall the executables described by an export",
+		Long: `Reinstall the executables in a file written by 'execman export', at their
+exported versions or, with --latest, at their newest releases. The plan,
+including the download chosen for this platform, is shown before anything
+is installed. Executables already installed at a matching version are left
+alone.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return RunImport(ImportOptions{
+				File:   args[0],
+				Latest: latest,
+				DryRun: dryRun,
+				Yes:    yes,
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&latest, "latest", false, "Install the latest releases instead of the exported versions")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Show the plan without installing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+
+	return cmd
+}
+
+// RunImport executes the import command.
+func RunImport(opts ImportOptions) error {
+	m, err := manifest.Load(opts.File)
+	if err != nil {
+		return err
+	}
+	if opts.Latest {
+		for i := range m.Tools {
+			m.Tools[i].Version = ""
+		}
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pol, err := policy.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	fmt.Printf("Resolving %d executables from %s...\n", len(m.Tools), opts.File)
+	actions, err := sync.Plan(m, reg, cfg, false, nil, func(tool *manifest.Tool) (string, error) {
+		includePrereleases := (tool.Prerelease || cfg.IncludePrereleases) && !pol.ForbidsPrereleases()
+		return tool.Resolve(includePrereleases)
+	})
+	if err != nil {
+		return err
+	}
+	resolveAssets(actions)
+
+	changes := sync.PrintPlan("Import plan", actions)
+	if changes == 0 || opts.DryRun {
+		return nil
+	}
+
+	if !opts.Yes {
+		fmt.Print("\nProceed? (Y/n): ")
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response == "n" || response == "no" {
+			fmt.Println("Import cancelled.")
+			return nil
+		}
+	}
+
+	if err := sync.PinKeys(m, reg); err != nil {
+		return err
+	}
+	return sync.Apply(actions)
+}
+
+// resolveAssets looks up the download for this platform of each executable
+// to be installed, so that the plan can show it. Executables with no
+// download for this platform are skipped.
+func resolveAssets(actions []sync.Action) {
+	for i := range actions {
+		a := &actions[i]
+		if !a.Changes() || a.Kind == sync.ActionRemove {
+			continue
+		}
+		asset, err := findAsset(a.Source, a.To)
+		if err != nil {
+			a.Kind = sync.ActionSkip
+			a.Note = err.Error()
+			continue
+		}
+		a.Asset = asset
+	}
+}
+
+// findAsset returns the name of the download for this platform in a release.
+func findAsset(source, version string) (string, error) {
+	owner, repo, _, err := github.ParseSource(source)
+	if err != nil {
+		return "", err
+	}
+	release, err := github.GetRelease(owner, repo, version)
+	if err != nil {
+		return "", err
+	}
+	asset, err := github.FindAsset(release.Assets, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", fmt.Errorf("%s has no download for %s/%s", version, runtime.GOOS, runtime.GOARCH)
+	}
+	return asset.Name, nil
+}
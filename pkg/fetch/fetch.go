@@ -0,0 +1,311 @@
+// Package fetch downloads release assets through the download cache and
+// verifies them according to the checksum and signature policies. Every
+// command that installs an executable goes through here so that the policies
+// are applied the same way.
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/cache"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/progress"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// ErrChecksumMismatch is returned when a download does not match its
+// published checksum.
+var ErrChecksumMismatch = errors.New("checksum verification failed")
+
+// ErrSignatureRequired is returned when the "require" signature policy is in
+// force and no signature of a download could be verified.
+var ErrSignatureRequired = errors.New("signature verification is required")
+
+// Result describes a downloaded asset.
+type Result struct {
+	// ArchivePath is the location of the asset in the download cache.
+	ArchivePath string
+	// Checksum is the checksum of the downloaded asset.
+	Checksum string
+	// Verified reports whether the checksum matched a published checksum.
+	Verified bool
+	// Signature records the signature the asset was verified against, if any.
+	Signature *registry.Signature
+	// Provenance records the verified build provenance of the asset, if it
+	// was checked.
+	Provenance *registry.Provenance
+	// Key is the publisher key to pin for the source, if the signature was
+	// made with a minisign or GPG key.
+	Key *registry.PinnedKey
+}
+
+// Options controls how a downloaded asset is verified.
+type Options struct {
+	ChecksumPolicy  string
+	SignaturePolicy string
+	// Source is the URL of the source the release belongs to.
+	Source string
+	// Trust describes who is trusted to sign the source's releases.
+	Trust *config.SourceTrust
+	// PinnedKey is the publisher key pinned for the source, if any.
+	PinnedKey *registry.PinnedKey
+	// TrustKey names a key file to trust in place of the pinned key.
+	TrustKey string
+	// VerifyProvenance requires SLSA provenance showing that the asset was
+	// built from Source by a trusted builder.
+	VerifyProvenance bool
+	// Output receives progress messages and warnings. It defaults to
+	// standard output.
+	Output io.Writer
+}
+
+// output returns the writer that progress messages go to.
+func (o Options) output() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
+	}
+	return o.Output
+}
+
+// EffectivePolicy picks the checksum policy to apply: an explicit override
+// (e.g. from a command-line flag) wins over the executable's own policy,
+// which wins over the configured default.
+func EffectivePolicy(override, executable string, cfg *config.Config) string {
+	switch {
+	case override != "":
+		return override
+	case executable != "":
+		return executable
+	default:
+		return cfg.ChecksumPolicy
+	}
+}
+
+// EffectiveSignaturePolicy picks the signature policy to apply: an explicit
+// override wins over the executable's own policy, then the source's, then
+// the configured default.
+func EffectiveSignaturePolicy(override, executable string, trust *config.SourceTrust, cfg *config.Config) string {
+	switch {
+	case override != "":
+		return override
+	case executable != "":
+		return executable
+	case trust != nil && trust.SignaturePolicy != "":
+		return trust.SignaturePolicy
+	default:
+		return cfg.SignaturePolicy
+	}
+}
+
+// Asset downloads an asset from a release, reusing a cached copy if there is
+// one, and verifies it against the release's published checksums and
+// signatures.
+//
+// Under the "require" policy, a missing, unreadable or unparseable checksum
+// is an error. Under "warn", such problems are reported and the download is
+// used unverified. Under "off", no checksum is looked for. A checksum that is
+// found but does not match is an error unless the policy is "off". The
+// signature policy is applied in the same way to signatures.
+func Asset(cfg *config.Config, release *github.Release, asset *github.Asset, opts Options) (*Result, error) {
+	policy := opts.ChecksumPolicy
+	if err := config.ValidatePolicy(policy); err != nil {
+		return nil, fmt.Errorf("invalid checksum policy: %w", err)
+	}
+	if err := config.ValidatePolicy(opts.SignaturePolicy); err != nil {
+		return nil, fmt.Errorf("invalid signature policy: %w", err)
+	}
+
+	downloadCache, err := cache.Open(cfg.CacheMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open download cache: %w", err)
+	}
+	out := opts.output()
+
+	// Look up the expected checksum first, so that a stale cached copy of the
+	// asset is not used.
+	var expected string
+	var checksums signedFile
+	if policy != config.PolicyOff {
+		expected, checksums, err = expectedChecksum(cfg, downloadCache, release, asset, out)
+		if err != nil {
+			if policy == config.PolicyRequire {
+				return nil, fmt.Errorf("checksum verification is required but %w", err)
+			}
+			fmt.Fprintf(out, "Warning: %v; the download will not be verified\n", err)
+		}
+	}
+
+	fmt.Fprintf(out, "\nDownloading %s...\n", asset.Name)
+	bar := progress.NewTerminalBar(out)
+	archivePath, checksum, cached, err := downloadCache.Fetch(asset, expected, github.DownloadOptions{
+		MaxSize:  cfg.MaxDownloadSize,
+		Retries:  github.DefaultRetries,
+		Progress: bar.Update,
+	})
+	bar.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		fmt.Fprintln(out, "Using cached download.")
+	} else {
+		fmt.Fprintln(out, "Download complete.")
+	}
+
+	result := &Result{ArchivePath: archivePath, Checksum: checksum}
+	if expected != "" {
+		fmt.Fprintln(out, "Verifying checksum...")
+		if err := verifyChecksum(archivePath, checksum, expected); err != nil {
+			return nil, fmt.Errorf("%w for %s: %v", ErrChecksumMismatch, asset.Name, err)
+		}
+		fmt.Fprintln(out, "Checksum verified.")
+		result.Verified = true
+	}
+
+	if opts.SignaturePolicy != config.PolicyOff {
+		// A signed checksums file vouches for the download once the download
+		// has been verified against it.
+		files := []signedFile{{asset: asset, path: archivePath}}
+		if result.Verified {
+			files = append(files, checksums)
+		}
+		result.Signature, result.Key, err = verifySignature(cfg, downloadCache, release, files, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.VerifyProvenance {
+		fmt.Fprintln(out, "Verifying build provenance...")
+		result.Provenance, err = verifyProvenance(cfg, downloadCache, release, asset, checksum, opts.Source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", asset.Name, err)
+		}
+		fmt.Fprintf(out, "Provenance verified: built from %s by %s.\n", result.Provenance.SourceRepo, result.Provenance.Signer)
+	}
+
+	return result, nil
+}
+
+// verifyChecksum checks a download against its expected checksum. The SHA256
+// checksum computed while downloading is reused when possible.
+func verifyChecksum(path, sha256Checksum, expected string) error {
+	if archive.ChecksumAlgorithm(expected) == archive.AlgorithmSHA256 {
+		if sha256Checksum != expected {
+			return fmt.Errorf("expected %s, got %s", expected, sha256Checksum)
+		}
+		return nil
+	}
+	return archive.VerifyChecksum(path, expected)
+}
+
+// signatureSuffixes identify signatures and certificates, which must not be
+// mistaken for checksums files even when named e.g. "checksums.txt.sig".
+var signatureSuffixes = []string{".sig", ".asc", ".minisig", ".pem", ".crt", ".cert", ".bundle", ".sigstore", ".sigstore.json", ".intoto.jsonl"}
+
+// checksumSuffixes identify per-asset checksum sidecars such as
+// "tool.tar.gz.sha256".
+var checksumSuffixes = []string{".sha256", ".sha512", ".sha1", ".sha256sum", ".sha512sum", ".sha1sum"}
+
+// expectedChecksum finds the published checksum of an asset and the file it
+// was found in. A sidecar file for the asset is preferred; otherwise every
+// checksums file in the release is searched, since some projects publish one
+// per platform.
+func expectedChecksum(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, asset *github.Asset, out io.Writer) (string, signedFile, error) {
+	sidecars, lists := findChecksumAssets(release.Assets, asset.Name)
+	if len(sidecars) == 0 && len(lists) == 0 {
+		return "", signedFile{}, fmt.Errorf("release %s has no checksums file", release.TagName)
+	}
+
+	var problems []string
+	var path string
+	try := func(candidate *github.Asset, find func(path, target string) (string, error)) string {
+		fmt.Fprintf(out, "\nDownloading %s...\n", candidate.Name)
+		var err error
+		path, _, _, err = downloadCache.Fetch(candidate, "", github.DownloadOptions{
+			MaxSize: cfg.MaxDownloadSize,
+			Retries: github.DefaultRetries,
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s could not be downloaded: %v", candidate.Name, err))
+			return ""
+		}
+		checksum, err := find(path, asset.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s could not be used: %v", candidate.Name, err))
+			return ""
+		}
+		return checksum
+	}
+
+	for _, sidecar := range sidecars {
+		if checksum := try(sidecar, archive.FindChecksumInSidecar); checksum != "" {
+			return checksum, signedFile{asset: sidecar, path: path}, nil
+		}
+	}
+	for _, list := range lists {
+		if checksum := try(list, archive.FindChecksumInFile); checksum != "" {
+			return checksum, signedFile{asset: list, path: path}, nil
+		}
+	}
+
+	return "", signedFile{}, fmt.Errorf("no checksum for %s could be found (%s)", asset.Name, strings.Join(problems, "; "))
+}
+
+// findChecksumAssets returns the sidecar checksum files for the named asset
+// and the general checksums files in a release. Sidecars for other assets and
+// signature files are ignored.
+func findChecksumAssets(assets []github.Asset, assetName string) (sidecars, lists []*github.Asset) {
+	names := make(map[string]bool, len(assets))
+	for _, a := range assets {
+		names[a.Name] = true
+	}
+
+	for i := range assets {
+		a := &assets[i]
+		lower := strings.ToLower(a.Name)
+		if hasAnySuffix(lower, signatureSuffixes) {
+			continue
+		}
+
+		suffix := matchingSuffix(lower, checksumSuffixes)
+		if suffix != "" {
+			base := a.Name[:len(a.Name)-len(suffix)]
+			if base == assetName {
+				sidecars = append(sidecars, a)
+				continue
+			}
+			if names[base] {
+				// A sidecar belonging to some other asset.
+				continue
+			}
+		}
+
+		if suffix != "" || strings.Contains(lower, "checksum") || strings.Contains(lower, "sums") {
+			lists = append(lists, a)
+		}
+	}
+
+	return sidecars, lists
+}
+
+// hasAnySuffix reports whether s ends with any of the suffixes.
+func hasAnySuffix(s string, suffixes []string) bool {
+	return matchingSuffix(s, suffixes) != ""
+}
+
+// matchingSuffix returns the first of the suffixes that s ends with, if any.
+func matchingSuffix(s string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
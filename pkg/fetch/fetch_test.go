@@ -0,0 +1,412 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/signature"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestAssetChecksumPolicy(t *testing.T) {
+	content := "archive content"
+	sum := sha256.Sum256([]byte(content))
+	goodChecksums := hex.EncodeToString(sum[:]) + "  tool_linux_amd64.tar.gz\n"
+	badChecksums := "0000000000000000000000000000000000000000000000000000000000000000  tool_linux_amd64.tar.gz\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/checksums.txt":
+			_, _ = w.Write([]byte(goodChecksums))
+		case "/bad/checksums.txt":
+			_, _ = w.Write([]byte(badChecksums))
+		case "/other/checksums.txt":
+			_, _ = w.Write([]byte("abc  something-else.tar.gz\n"))
+		default:
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	// Keep the download cache out of the real user cache directory.
+	tmpDir, err := os.MkdirTemp("", "fetch-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("LocalAppData", tmpDir)
+
+	cfg := &config.Config{ChecksumPolicy: config.PolicyWarn}
+
+	release := func(checksums string) *github.Release {
+		r := &github.Release{TagName: "v1.0.0", Assets: []github.Asset{
+			{Name: "tool_linux_amd64.tar.gz", BrowserDownloadURL: server.URL + "/" + checksums + "/tool.tar.gz"},
+		}}
+		if checksums != "" {
+			r.Assets = append(r.Assets, github.Asset{
+				Name:               "checksums.txt",
+				BrowserDownloadURL: server.URL + "/" + checksums + "/checksums.txt",
+			})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name         string
+		checksums    string
+		policy       string
+		wantVerified bool
+		wantMismatch bool
+		wantError    bool
+	}{
+		{name: "Require with valid checksum", checksums: "good", policy: config.PolicyRequire, wantVerified: true},
+		{name: "Warn with valid checksum", checksums: "good", policy: config.PolicyWarn, wantVerified: true},
+		{name: "Require without checksums file", checksums: "", policy: config.PolicyRequire, wantError: true},
+		{name: "Warn without checksums file", checksums: "", policy: config.PolicyWarn},
+		{name: "Require with asset not listed", checksums: "other", policy: config.PolicyRequire, wantError: true},
+		{name: "Warn with asset not listed", checksums: "other", policy: config.PolicyWarn},
+		{name: "Warn with mismatch", checksums: "bad", policy: config.PolicyWarn, wantMismatch: true},
+		{name: "Off ignores mismatch", checksums: "bad", policy: config.PolicyOff},
+		{name: "Invalid policy", checksums: "good", policy: "sometimes", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := release(tt.checksums)
+			result, err := Asset(cfg, r, &r.Assets[0], Options{ChecksumPolicy: tt.policy, SignaturePolicy: config.PolicyOff})
+
+			if tt.wantMismatch {
+				if !errors.Is(err, ErrChecksumMismatch) {
+					t.Errorf("Asset() error = %v, want ErrChecksumMismatch", err)
+				}
+				return
+			}
+			if tt.wantError {
+				if err == nil {
+					t.Error("Asset() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Asset() unexpected error: %v", err)
+			}
+			if result.Verified != tt.wantVerified {
+				t.Errorf("Asset() Verified = %v, want %v", result.Verified, tt.wantVerified)
+			}
+		})
+	}
+
+	// Progress messages and warnings go to the writer given.
+	var out bytes.Buffer
+	r := release("")
+	if _, err := Asset(cfg, r, &r.Assets[0], Options{ChecksumPolicy: config.PolicyWarn, SignaturePolicy: config.PolicyOff, Output: &out}); err != nil {
+		t.Fatalf("Asset() unexpected error: %v", err)
+	}
+	for _, want := range []string{"Warning:", "Downloading tool_linux_amd64.tar.gz"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Asset() output = %q, want %q", out.String(), want)
+		}
+	}
+}
+
+func TestAssetSignaturePolicy(t *testing.T) {
+	content := "archive content"
+	sum := sha256.Sum256([]byte(content))
+	checksums := hex.EncodeToString(sum[:]) + "  tool_linux_amd64.tar.gz\n"
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksumsSum := sha256.Sum256([]byte(checksums))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, checksumsSum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/checksums.txt":
+			_, _ = w.Write([]byte(checksums))
+		case "/checksums.txt.sig":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(sig)))
+		default:
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "fetch-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("LocalAppData", tmpDir)
+
+	writeKey := func(name string, k *ecdsa.PrivateKey) string {
+		der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	trusted := &config.SourceTrust{CosignPublicKey: writeKey("trusted.pub", key)}
+	untrusted := &config.SourceTrust{CosignPublicKey: writeKey("other.pub", otherKey)}
+
+	cfg := &config.Config{}
+	release := func(signed bool) *github.Release {
+		r := &github.Release{TagName: "v1.0.0", Assets: []github.Asset{
+			{Name: "tool_linux_amd64.tar.gz", BrowserDownloadURL: server.URL + "/tool.tar.gz"},
+			{Name: "checksums.txt", BrowserDownloadURL: server.URL + "/checksums.txt"},
+		}}
+		if signed {
+			r.Assets = append(r.Assets, github.Asset{Name: "checksums.txt.sig", BrowserDownloadURL: server.URL + "/checksums.txt.sig"})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		signed     bool
+		policy     string
+		trust      *config.SourceTrust
+		wantSigned bool
+		wantError  bool
+	}{
+		{name: "Require with trusted key", signed: true, policy: config.PolicyRequire, trust: trusted, wantSigned: true},
+		{name: "Warn with untrusted key", signed: true, policy: config.PolicyWarn, trust: untrusted, wantError: true},
+		{name: "Warn without configured key", signed: true, policy: config.PolicyWarn},
+		{name: "Require without configured key", signed: true, policy: config.PolicyRequire, wantError: true},
+		{name: "Require without signature", signed: false, policy: config.PolicyRequire, trust: trusted, wantError: true},
+		{name: "Warn without signature", signed: false, policy: config.PolicyWarn, trust: trusted},
+		{name: "Off ignores untrusted key", signed: true, policy: config.PolicyOff, trust: untrusted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := release(tt.signed)
+			result, err := Asset(cfg, r, &r.Assets[0], Options{
+				ChecksumPolicy:  config.PolicyRequire,
+				SignaturePolicy: tt.policy,
+				Trust:           tt.trust,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Asset() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Asset() unexpected error: %v", err)
+			}
+			if (result.Signature != nil) != tt.wantSigned {
+				t.Fatalf("Asset() Signature = %+v, want signed %v", result.Signature, tt.wantSigned)
+			}
+			if tt.wantSigned && (result.Signature.Artifact != "checksums.txt" || result.Signature.Method != signature.MethodCosignKey) {
+				t.Errorf("Asset() Signature = %+v", result.Signature)
+			}
+		})
+	}
+}
+
+// minisignKey generates a minisign key pair, returning the public key file
+// and a function that signs content as "minisign -S" does.
+func minisignKey(t *testing.T) ([]byte, func(content []byte) []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	key := "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...)) + "\n"
+
+	sign := func(content []byte) []byte {
+		sum := blake2b.Sum512(content)
+		sig := ed25519.Sign(priv, sum[:])
+		comment := "timestamp:1700000000"
+		global := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+		return []byte("untrusted comment: signature\n" +
+			base64.StdEncoding.EncodeToString(append(append([]byte("ED"), id...), sig...)) + "\n" +
+			"trusted comment: " + comment + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+	return []byte(key), sign
+}
+
+func TestAssetPinnedKey(t *testing.T) {
+	content := "archive content"
+	sum := sha256.Sum256([]byte(content))
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  tool_linux_amd64.tar.gz\n")
+
+	originalKey, originalSign := minisignKey(t)
+	newKey, newSign := minisignKey(t)
+	files := map[string][]byte{
+		"/v1/checksums.txt":         checksums,
+		"/v1/checksums.txt.minisig": originalSign(checksums),
+		"/v1/minisign.pub":          originalKey,
+		"/v2/checksums.txt":         checksums,
+		"/v2/checksums.txt.minisig": newSign(checksums),
+		"/v2/minisign.pub":          newKey,
+		// v3 is unsigned, and v4 carries only a cosign bundle.
+		"/v3/checksums.txt":               checksums,
+		"/v4/checksums.txt":               checksums,
+		"/v4/checksums.txt.sigstore.json": []byte(`{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json"}`),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := files[r.URL.Path]; ok {
+			_, _ = w.Write(data)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "fetch-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("LocalAppData", tmpDir)
+
+	newKeyPath := filepath.Join(tmpDir, "new.pub")
+	if err := os.WriteFile(newKeyPath, newKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	fetchRelease := func(version string, pinned *registry.PinnedKey, trustKey string) (*Result, error) {
+		r := &github.Release{TagName: version, Assets: []github.Asset{
+			{Name: "tool_linux_amd64.tar.gz", BrowserDownloadURL: server.URL + "/" + version + "/tool_linux_amd64.tar.gz"},
+		}}
+		for _, name := range []string{"checksums.txt", "checksums.txt.minisig", "checksums.txt.sigstore.json", "minisign.pub"} {
+			if _, ok := files["/"+version+"/"+name]; ok {
+				r.Assets = append(r.Assets, github.Asset{Name: name, BrowserDownloadURL: server.URL + "/" + version + "/" + name})
+			}
+		}
+		return Asset(cfg, r, &r.Assets[0], Options{
+			ChecksumPolicy:  config.PolicyRequire,
+			SignaturePolicy: config.PolicyWarn,
+			PinnedKey:       pinned,
+			TrustKey:        trustKey,
+		})
+	}
+
+	// The first install trusts the key published with the release.
+	first, err := fetchRelease("v1", nil, "")
+	if err != nil {
+		t.Fatalf("first install: %v", err)
+	}
+	if first.Key == nil || first.Signature == nil || first.Signature.Method != signature.MethodMinisign {
+		t.Fatalf("first install: Key = %+v, Signature = %+v", first.Key, first.Signature)
+	}
+
+	// Later releases must be signed with the pinned key.
+	again, err := fetchRelease("v1", first.Key, "")
+	if err != nil {
+		t.Fatalf("update with pinned key: %v", err)
+	}
+	if again.Key != first.Key {
+		t.Errorf("update with pinned key re-pinned %+v", again.Key)
+	}
+
+	if _, err := fetchRelease("v2", first.Key, ""); !errors.Is(err, signature.ErrKeyChanged) {
+		t.Fatalf("update with changed key: error = %v, want ErrKeyChanged", err)
+	}
+
+	// A release that stops being signed with the pinned key is refused, even
+	// under the "warn" policy.
+	for _, version := range []string{"v3", "v4"} {
+		if _, err := fetchRelease(version, first.Key, ""); !errors.Is(err, ErrSignatureRequired) {
+			t.Errorf("update to %s without a signature by the pinned key: error = %v, want ErrSignatureRequired", version, err)
+		}
+	}
+
+	// Trusting the new key explicitly allows the update and pins the new key.
+	replaced, err := fetchRelease("v2", first.Key, newKeyPath)
+	if err != nil {
+		t.Fatalf("update with --trust-key: %v", err)
+	}
+	if replaced.Key == nil || replaced.Key.ID == first.Key.ID {
+		t.Errorf("update with --trust-key: Key = %+v", replaced.Key)
+	}
+}
+
+func TestEffectivePolicy(t *testing.T) {
+	cfg := &config.Config{ChecksumPolicy: config.PolicyWarn}
+
+	if got := EffectivePolicy("", "", cfg); got != config.PolicyWarn {
+		t.Errorf("default policy = %q, want %q", got, config.PolicyWarn)
+	}
+	if got := EffectivePolicy("", config.PolicyRequire, cfg); got != config.PolicyRequire {
+		t.Errorf("executable policy = %q, want %q", got, config.PolicyRequire)
+	}
+	if got := EffectivePolicy(config.PolicyOff, config.PolicyRequire, cfg); got != config.PolicyOff {
+		t.Errorf("override policy = %q, want %q", got, config.PolicyOff)
+	}
+}
+
+func TestFindChecksumAssets(t *testing.T) {
+	assets := []github.Asset{
+		{Name: "tool_linux_amd64.tar.gz"},
+		{Name: "tool_darwin_arm64.tar.gz"},
+		{Name: "tool_darwin_arm64.tar.gz.sha256"},
+		{Name: "tool_linux_amd64.tar.gz.sha512"},
+		{Name: "checksums.txt"},
+		{Name: "checksums.txt.sig"},
+		{Name: "checksums.txt.pem"},
+		{Name: "SHA256SUMS"},
+	}
+
+	sidecars, lists := findChecksumAssets(assets, "tool_linux_amd64.tar.gz")
+
+	if len(sidecars) != 1 || sidecars[0].Name != "tool_linux_amd64.tar.gz.sha512" {
+		t.Errorf("sidecars = %v, want only tool_linux_amd64.tar.gz.sha512", assetNames(sidecars))
+	}
+	if len(lists) != 2 || lists[0].Name != "checksums.txt" || lists[1].Name != "SHA256SUMS" {
+		t.Errorf("lists = %v, want [checksums.txt SHA256SUMS]", assetNames(lists))
+	}
+}
+
+func assetNames(assets []*github.Asset) []string {
+	names := make([]string, 0, len(assets))
+	for _, a := range assets {
+		names = append(names, a.Name)
+	}
+	return names
+}
@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/cache"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/provenance"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/signature"
+)
+
+// attestationSuffixes name release assets that may hold provenance
+// attestations for any of the release's assets.
+var attestationSuffixes = []string{".intoto.jsonl", ".intoto.json", ".build.slsa"}
+
+// verifyProvenance checks that SLSA provenance shows the asset, whose SHA256
+// checksum is given, was built from source by a trusted builder. Provenance
+// attached to the release is used if there is any; otherwise the source's
+// GitHub artifact attestations are fetched.
+func verifyProvenance(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, asset *github.Asset, checksum, source string) (*registry.Provenance, error) {
+	if cfg.SigstoreRoots == "" {
+		return nil, fmt.Errorf("%w: no Sigstore root certificates are configured", signature.ErrNotConfigured)
+	}
+	roots, err := signature.LoadCertificates(cfg.SigstoreRoots)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sigstore_roots: %w", err)
+	}
+	if cfg.RekorPublicKey == "" {
+		return nil, fmt.Errorf("%w: no transparency log key is configured", signature.ErrNotConfigured)
+	}
+	rekorKey, err := signature.LoadPublicKey(cfg.RekorPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rekor_public_key: %w", err)
+	}
+	builders := append(append([]string{}, provenance.DefaultBuilders...), cfg.TrustedBuilders...)
+
+	digest, ok := strings.CutPrefix(checksum, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("unexpected checksum %s", checksum)
+	}
+
+	var problems []string
+	for i := range release.Assets {
+		candidate := &release.Assets[i]
+		lower := strings.ToLower(candidate.Name)
+		if !hasAnySuffix(lower, attestationSuffixes) &&
+			candidate.Name != asset.Name+".sigstore.json" && candidate.Name != asset.Name+".sigstore" {
+			continue
+		}
+
+		data, err := fetchSmall(cfg, downloadCache, candidate)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		docs, err := provenance.SplitDocuments(data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", candidate.Name, err))
+			continue
+		}
+		result, err := provenance.Verify(docs, digest, source, roots, rekorKey, builders)
+		if errors.Is(err, provenance.ErrNoProvenance) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newProvenance(result, candidate.Name), nil
+	}
+
+	owner, repo, _, err := github.ParseSource(source)
+	if err != nil {
+		return nil, err
+	}
+	bundles, err := github.GetAttestations(owner, repo, digest)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(bundles) > 0 {
+		docs := make([][]byte, 0, len(bundles))
+		for _, b := range bundles {
+			docs = append(docs, b)
+		}
+		result, err := provenance.Verify(docs, digest, source, roots, rekorKey, builders)
+		if err == nil {
+			return newProvenance(result, "GitHub attestations"), nil
+		}
+		if !errors.Is(err, provenance.ErrNoProvenance) {
+			return nil, err
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w (%s)", provenance.ErrNoProvenance, strings.Join(problems, "; "))
+	}
+	return nil, provenance.ErrNoProvenance
+}
+
+// newProvenance converts a verification result into its registry record.
+func newProvenance(result *provenance.Result, attestation string) *registry.Provenance {
+	return &registry.Provenance{
+		PredicateType: result.PredicateType,
+		Builder:       result.Builder,
+		Signer:        result.Signer,
+		SourceRepo:    result.SourceRepo,
+		Attestation:   attestation,
+		VerifiedAt:    time.Now(),
+	}
+}
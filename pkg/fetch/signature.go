@@ -0,0 +1,383 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/cache"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/signature"
+)
+
+// signedFile is a downloaded release asset that may have been signed.
+type signedFile struct {
+	asset *github.Asset
+	path  string
+}
+
+// foundSignature is a signature published for a release asset.
+type foundSignature struct {
+	asset *github.Asset
+	// method is signature.MethodMinisign or signature.MethodGPG for detached
+	// signatures, or "" for cosign.
+	method string
+	data   []byte
+	cosign signature.CosignMaterial
+}
+
+// cosignBundleSuffixes name the bundle files cosign and other Sigstore
+// clients publish next to a signed asset, in order of preference.
+var cosignBundleSuffixes = []string{".sigstore.json", ".sigstore", ".bundle"}
+
+// cosignCertificateSuffixes name the signing certificate published next to a
+// signed asset's ".sig" file.
+var cosignCertificateSuffixes = []string{".pem", ".crt", ".cert"}
+
+// keySuffixes name release assets that may hold the publisher's public key.
+var keySuffixes = []string{".pub", ".asc", ".gpg", ".pgp", ".key"}
+
+// verifySignature looks for a signature of any of the files and verifies the
+// first one found. A signature that does not verify, or that was made by a
+// key other than the one pinned for the source, is always an error.
+// Otherwise, under the "require" policy, failing to find or check a signature
+// is an error; under "warn" it is reported, unless the release is unsigned
+// and no signer is configured or pinned for the source, when there is
+// nothing to say. Once a key is pinned for the source, only minisign and GPG
+// signatures are looked for and the policy is always "require", so that a
+// release cannot shed its signature unnoticed.
+func verifySignature(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, files []signedFile, opts Options) (*registry.Signature, *registry.PinnedKey, error) {
+	trust := opts.Trust
+	if trust == nil {
+		trust = &config.SourceTrust{}
+	}
+	out := opts.output()
+	policy := opts.SignaturePolicy
+	if opts.PinnedKey != nil {
+		policy = config.PolicyRequire
+	}
+
+	var problems []string
+	found := false
+	for _, file := range files {
+		sig, err := findSignature(cfg, downloadCache, release, file.asset.Name, opts.PinnedKey != nil)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if sig == nil {
+			continue
+		}
+		found = true
+
+		fmt.Fprintf(out, "Verifying signature of %s...\n", file.asset.Name)
+		var record *registry.Signature
+		var key *registry.PinnedKey
+		if sig.method == "" {
+			record, err = verifyCosign(cfg, trust, file, sig)
+		} else {
+			record, key, err = verifyDetached(cfg, downloadCache, release, file, sig, opts)
+		}
+		if errors.Is(err, signature.ErrKeyChanged) {
+			return nil, nil, fmt.Errorf("%s: %w; if the publisher has replaced their key, use --trust-key to trust the new one", file.asset.Name, err)
+		}
+		if errors.Is(err, signature.ErrUntrusted) {
+			return nil, nil, fmt.Errorf("%s: %w", file.asset.Name, err)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file.asset.Name, err))
+			continue
+		}
+
+		fmt.Fprintln(out, "Signature verified.")
+		return record, key, nil
+	}
+
+	var err error
+	switch {
+	case len(problems) > 0:
+		err = fmt.Errorf("the signature could not be verified (%s)", strings.Join(problems, "; "))
+	case opts.PinnedKey != nil:
+		err = fmt.Errorf("release %s has no signature for %s by the pinned %s key %s", release.TagName, files[0].asset.Name, opts.PinnedKey.Type, opts.PinnedKey.ID)
+	default:
+		err = fmt.Errorf("release %s has no signature for %s", release.TagName, files[0].asset.Name)
+	}
+	if policy == config.PolicyRequire {
+		return nil, nil, fmt.Errorf("%w but %w", ErrSignatureRequired, err)
+	}
+	if found || len(problems) > 0 || trustConfigured(trust, opts) {
+		fmt.Fprintf(out, "Warning: %v; the download's signer is not verified\n", err)
+	}
+	return nil, nil, nil
+}
+
+// trustConfigured reports whether a signer is configured or pinned for a
+// source, in which case an unsigned release is worth a warning.
+func trustConfigured(trust *config.SourceTrust, opts Options) bool {
+	return trust.CosignIdentity != "" || trust.CosignIdentityRegexp != "" || trust.CosignPublicKey != "" ||
+		trust.MinisignPublicKey != "" || trust.GPGPublicKey != "" ||
+		opts.PinnedKey != nil || opts.TrustKey != ""
+}
+
+// findSignature downloads the signature published for the named asset, if
+// there is one. Cosign bundles are preferred, then minisign and GPG
+// signatures; a ".sig" file may hold any of the three. If detachedOnly is
+// set, cosign signatures are not looked for.
+func findSignature(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, name string, detachedOnly bool) (*foundSignature, error) {
+	if bundle := findAsset(release.Assets, name, cosignBundleSuffixes); bundle != nil && !detachedOnly {
+		data, err := fetchSmall(cfg, downloadCache, bundle)
+		if err != nil {
+			return nil, err
+		}
+		return &foundSignature{asset: bundle, cosign: signature.CosignMaterial{Bundle: data}}, nil
+	}
+
+	sigAsset := findAsset(release.Assets, name, []string{".minisig", ".asc", ".sig"})
+	if sigAsset == nil {
+		return nil, nil
+	}
+	data, err := fetchSmall(cfg, downloadCache, sigAsset)
+	if err != nil {
+		return nil, err
+	}
+	if method := signature.DetachedType(data); method != "" {
+		return &foundSignature{asset: sigAsset, method: method, data: data}, nil
+	}
+	if detachedOnly || !strings.HasSuffix(sigAsset.Name, ".sig") {
+		return nil, fmt.Errorf("%s is not a minisign or GPG signature", sigAsset.Name)
+	}
+
+	// Anything else in a ".sig" file is taken to be a cosign signature.
+	sig := &foundSignature{asset: sigAsset, cosign: signature.CosignMaterial{Signature: data}}
+	if cert := findAsset(release.Assets, name, cosignCertificateSuffixes); cert != nil {
+		data, err := fetchSmall(cfg, downloadCache, cert)
+		if err != nil {
+			return nil, err
+		}
+		sig.cosign.Certificate = data
+	}
+	return sig, nil
+}
+
+// verifyCosign verifies a cosign signature against the source's configured
+// signer.
+func verifyCosign(cfg *config.Config, trust *config.SourceTrust, file signedFile, sig *foundSignature) (*registry.Signature, error) {
+	cosignTrust, err := loadCosignTrust(cfg, trust)
+	if err != nil {
+		return nil, err
+	}
+	result, err := signature.VerifyCosign(file.path, sig.cosign, cosignTrust)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.Signature{
+		Method:     result.Method,
+		Artifact:   file.asset.Name,
+		Identity:   result.Identity,
+		Issuer:     result.Issuer,
+		KeyID:      result.KeyID,
+		VerifiedAt: time.Now(),
+	}, nil
+}
+
+// verifyDetached verifies a minisign or GPG signature against the key trusted
+// for the source, and returns the key to pin for the source.
+func verifyDetached(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, file signedFile, sig *foundSignature, opts Options) (*registry.Signature, *registry.PinnedKey, error) {
+	key, origin, err := trustedKey(cfg, downloadCache, release, sig, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := signature.VerifyDetached(file.path, sig.data, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pinned := opts.PinnedKey
+	if pinned == nil || pinned.Type != signer.Type || pinned.ID != signer.ID() {
+		encoded, err := signer.Encode()
+		if err != nil {
+			return nil, nil, err
+		}
+		pinned = &registry.PinnedKey{
+			Type:      signer.Type,
+			ID:        signer.ID(),
+			PublicKey: encoded,
+			PinnedAt:  time.Now(),
+		}
+		fmt.Fprintf(opts.output(), "Trusting %s key %s from %s.\n", signer.Type, signer.ID(), origin)
+	}
+
+	return &registry.Signature{
+		Method:     sig.method,
+		Artifact:   file.asset.Name,
+		KeyID:      signer.ID(),
+		VerifiedAt: time.Now(),
+	}, pinned, nil
+}
+
+// trustedKey returns the key a detached signature must have been made with,
+// and where it came from. A key named with --trust-key wins, then a key in
+// the config, then the key pinned for the source. If there is none of these,
+// the key is looked for in the release and, for GPG, in the owner's GitHub
+// account, and trusted on first use.
+func trustedKey(cfg *config.Config, downloadCache *cache.Cache, release *github.Release, sig *foundSignature, opts Options) (*signature.PublicKey, string, error) {
+	if opts.TrustKey != "" {
+		key, err := loadKey(opts.TrustKey)
+		if err != nil {
+			return nil, "", err
+		}
+		return key, opts.TrustKey, nil
+	}
+
+	trust := opts.Trust
+	if trust == nil {
+		trust = &config.SourceTrust{}
+	}
+	configured := trust.MinisignPublicKey
+	if sig.method == signature.MethodGPG {
+		configured = trust.GPGPublicKey
+	}
+	if configured != "" {
+		key, err := loadKey(configured)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid %s public key in config: %w", sig.method, err)
+		}
+		return key, configured, nil
+	}
+
+	if opts.PinnedKey != nil {
+		key, err := signature.ParsePublicKey([]byte(opts.PinnedKey.PublicKey))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid pinned key: %w", err)
+		}
+		return key, "the registry", nil
+	}
+
+	for i := range release.Assets {
+		candidate := &release.Assets[i]
+		if candidate == sig.asset || !isKeyAsset(release.Assets, candidate.Name) {
+			continue
+		}
+		data, err := fetchSmall(cfg, downloadCache, candidate)
+		if err != nil {
+			continue
+		}
+		if key, err := signature.ParsePublicKey(data); err == nil && key.Type == sig.method {
+			return key, candidate.Name + " on first use", nil
+		}
+	}
+
+	if sig.method == signature.MethodGPG && opts.Source != "" {
+		owner, _, _, err := github.ParseSource(opts.Source)
+		if err == nil {
+			if data, err := github.GetUserGPGKeys(owner); err == nil {
+				if key, err := signature.ParsePublicKey(data); err == nil && key.Type == signature.MethodGPG {
+					return key, "the GitHub account of " + owner + " on first use", nil
+				}
+			}
+		}
+	}
+
+	return nil, "", fmt.Errorf("%w: no %s public key was found", signature.ErrNotConfigured, sig.method)
+}
+
+// isKeyAsset reports whether a release asset may hold a public key rather
+// than a signature of another asset.
+func isKeyAsset(assets []github.Asset, name string) bool {
+	if name == "KEYS" {
+		return true
+	}
+	suffix := matchingSuffix(strings.ToLower(name), keySuffixes)
+	if suffix == "" {
+		return false
+	}
+	signed := name[:len(name)-len(suffix)]
+	for _, a := range assets {
+		if a.Name == signed {
+			return false
+		}
+	}
+	return true
+}
+
+// loadKey reads a minisign or GPG public key from a file.
+func loadKey(path string) (*signature.PublicKey, error) {
+	// #nosec G304 -- Reading a key file named by the user
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	key, err := signature.ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// findAsset returns the first asset named name plus one of the suffixes.
+func findAsset(assets []github.Asset, name string, suffixes []string) *github.Asset {
+	for _, suffix := range suffixes {
+		for i := range assets {
+			if assets[i].Name == name+suffix {
+				return &assets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// fetchSmall downloads a small asset, such as a signature, through the cache
+// and returns its contents.
+func fetchSmall(cfg *config.Config, downloadCache *cache.Cache, asset *github.Asset) ([]byte, error) {
+	path, _, _, err := downloadCache.Fetch(asset, "", github.DownloadOptions{
+		MaxSize: cfg.MaxDownloadSize,
+		Retries: github.DefaultRetries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be downloaded: %v", asset.Name, err)
+	}
+	// #nosec G304 -- Reading a downloaded file from the cache
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read: %v", asset.Name, err)
+	}
+	return data, nil
+}
+
+// loadCosignTrust reads the keys and certificates that a source's cosign
+// signatures are verified against.
+func loadCosignTrust(cfg *config.Config, trust *config.SourceTrust) (signature.CosignTrust, error) {
+	cosignTrust := signature.CosignTrust{
+		Identity:       trust.CosignIdentity,
+		IdentityRegexp: trust.CosignIdentityRegexp,
+		Issuer:         trust.CosignIssuer,
+	}
+
+	if trust.CosignPublicKey != "" {
+		key, err := signature.LoadPublicKey(trust.CosignPublicKey)
+		if err != nil {
+			return cosignTrust, fmt.Errorf("invalid cosign_public_key: %w", err)
+		}
+		cosignTrust.PublicKey = key
+	}
+	if cfg.SigstoreRoots != "" {
+		roots, err := signature.LoadCertificates(cfg.SigstoreRoots)
+		if err != nil {
+			return cosignTrust, fmt.Errorf("invalid sigstore_roots: %w", err)
+		}
+		cosignTrust.Roots = roots
+	}
+	if cfg.RekorPublicKey != "" {
+		key, err := signature.LoadPublicKey(cfg.RekorPublicKey)
+		if err != nil {
+			return cosignTrust, fmt.Errorf("invalid rekor_public_key: %w", err)
+		}
+		cosignTrust.RekorKey = key
+	}
+	return cosignTrust, nil
+}
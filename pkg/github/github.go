@@ -1,7 +1,10 @@
 package github
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -61,9 +64,89 @@ func ToURL(owner, repo string) string {
 	return fmt.Sprintf("https://github.com/%s/%s", owner, repo)
 }
 
+// maxMetadataSize caps the size of a user's published GPG keys and of a
+// repository's attestations.
+const maxMetadataSize = 1 << 20
+
+// GetUserGPGKeys fetches the GPG public keys that a GitHub user has added to
+// their account, in armored form.
+func GetUserGPGKeys(owner string) ([]byte, error) {
+	url := fmt.Sprintf("https://github.com/%s.gpg", owner)
+
+	// #nosec G107 -- URL is constructed from a validated GitHub owner
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch GPG keys of %s: %w", owner, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch GPG keys of %s: status %d", owner, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GPG keys of %s: %w", owner, err)
+	}
+	return data, nil
+}
+
+// GetAttestations fetches the Sigstore bundles of the artifact attestations
+// that a repository has published for an artifact, identified by its SHA256
+// digest in hex.
+func GetAttestations(owner, repo, digest string) ([]json.RawMessage, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/attestations/sha256:%s", owner, repo, digest)
+
+	// #nosec G107 -- URL is constructed from validated GitHub repo components
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attestations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch attestations: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Attestations []struct {
+			Bundle json.RawMessage `json:"bundle"`
+		} `json:"attestations"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse attestations: %w", err)
+	}
+
+	bundles := make([]json.RawMessage, 0, len(result.Attestations))
+	for _, a := range result.Attestations {
+		bundles = append(bundles, a.Bundle)
+	}
+	return bundles, nil
+}
+
 // GetLatestRelease fetches the latest release from GitHub.
 func GetLatestRelease(owner, repo string, includePrereleases bool) (*Release, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", owner, repo)
+	releases, err := ListReleases(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the first non-prerelease (or first release if includePrereleases).
+	for _, release := range releases {
+		if !release.Prerelease || includePrereleases {
+			return &release, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no suitable releases found for %s/%s", owner, repo)
+}
+
+// ListReleases fetches the most recent releases from GitHub, newest first.
+func ListReleases(owner, repo string) ([]Release, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases?per_page=100", owner, repo)
 
 	// #nosec G107 -- URL is constructed from validated GitHub repo components
 	resp, err := http.Get(url)
@@ -95,14 +178,7 @@ func GetLatestRelease(owner, repo string, includePrereleases bool) (*Release, er
 		return nil, fmt.Errorf("no releases found for %s/%s", owner, repo)
 	}
 
-	// Find the first non-prerelease (or first release if includePrereleases).
-	for _, release := range releases {
-		if !release.Prerelease || includePrereleases {
-			return &release, nil
-		}
-	}
-
-	return nil, fmt.Errorf("no suitable releases found for %s/%s", owner, repo)
+	return releases, nil
 }
 
 // GetRelease fetches a specific release by tag from GitHub.
@@ -166,27 +242,248 @@ func FindAsset(assets []Asset, osName, arch string) (*Asset, error) {
 	return nil, fmt.Errorf("no matching asset found for %s/%s", osName, arch)
 }
 
-// DownloadAsset downloads an asset from GitHub.
-func DownloadAsset(asset *Asset, dest string) error {
-	resp, err := http.Get(asset.BrowserDownloadURL)
+// ErrTooLarge is returned when a download exceeds its size limit.
+var ErrTooLarge = errors.New("download exceeds size limit")
+
+// DefaultRetries is the number of times an interrupted download is resumed
+// before giving up.
+const DefaultRetries = 3
+
+// ProgressFunc is called as a download proceeds with the number of bytes
+// received so far and the expected total, which is zero or negative if
+// unknown.
+type ProgressFunc func(done, total int64)
+
+// DownloadOptions controls how an asset is downloaded.
+type DownloadOptions struct {
+	// MaxSize refuses downloads larger than this many bytes, if positive.
+	MaxSize int64
+	// Retries is the number of times an interrupted download is resumed.
+	Retries int
+	// Resume continues from a partial download left by an earlier attempt.
+	Resume bool
+	// Progress, if not nil, is called as data arrives.
+	Progress ProgressFunc
+}
+
+// retryableError marks failures that are worth resuming after, such as a
+// connection dropping part way through the body.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// DownloadAsset streams an asset from GitHub to dest, hashing it as it goes,
+// and returns its SHA256 checksum. Data is written to dest+".part" and only
+// renamed to dest once complete. If the connection drops, the download is
+// resumed with an HTTP Range request, made conditional with If-Range so that
+// an asset changed in the meantime is downloaded afresh; with opts.Resume, a
+// partial file left by an earlier run is resumed too, even one that is
+// already complete. If opts.MaxSize is positive, downloads larger than that
+// are refused, both up front using the advertised sizes and while streaming
+// in case those sizes are missing or wrong.
+func DownloadAsset(asset *Asset, dest string, opts DownloadOptions) (string, error) {
+	if opts.MaxSize > 0 && asset.Size > opts.MaxSize {
+		return "", fmt.Errorf("%w: %s is %d bytes (limit %d)", ErrTooLarge, asset.Name, asset.Size, opts.MaxSize)
+	}
+
+	partPath := dest + ".part"
+	if !opts.Resume {
+		for _, path := range []string{partPath, validatorPath(partPath)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to remove partial download: %w", err)
+			}
+		}
+	}
+
+	var checksum string
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		checksum, err = downloadToPart(asset, partPath, opts)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(partPath, dest); err != nil {
+		return "", fmt.Errorf("failed to move download into place: %w", err)
+	}
+	_ = os.Remove(validatorPath(partPath))
+
+	return checksum, nil
+}
+
+// validatorPath returns the file beside a partial download that records the
+// ETag or Last-Modified date of the response it came from.
+func validatorPath(partPath string) string {
+	return partPath + ".validator"
+}
+
+// downloadToPart makes one attempt to complete the partial download at
+// partPath, returning the checksum of the complete file.
+func downloadToPart(asset *Asset, partPath string, opts DownloadOptions) (string, error) {
+	// Use 0600 permissions for downloaded file (temp file).
+	// #nosec G304 -- Destination is in a directory controlled by execman
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file for asset: %w", err)
+	}
+	defer out.Close()
+
+	// Hash whatever was already downloaded so the final checksum covers the
+	// whole file.
+	hash := sha256.New()
+	offset, err := io.Copy(hash, out)
+	if err != nil {
+		return "", fmt.Errorf("failed to read partial download: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, asset.BrowserDownloadURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download request: %w", err)
+	}
+	if offset > 0 {
+		// Only resume if the server can confirm that the asset is unchanged:
+		// with If-Range, a changed asset is sent whole rather than spliced
+		// onto the old bytes. Without a validator, start over.
+		// #nosec G304 -- Reading a file beside the partial download
+		validator, _ := os.ReadFile(validatorPath(partPath))
+		if len(validator) > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", string(validator))
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download asset: %w", err)
+		return "", &retryableError{fmt.Errorf("failed to download asset: %w", err)}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && req.Header.Get("Range") != "":
+		// The server is resuming where we left off.
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored or was not sent a Range header, or the asset
+		// has changed, so start over.
+		if err := saveValidator(partPath, resp.Header); err != nil {
+			return "", err
+		}
+		if offset > 0 {
+			if err := out.Truncate(0); err != nil {
+				return "", fmt.Errorf("failed to restart download: %w", err)
+			}
+			if _, err := out.Seek(0, io.SeekStart); err != nil {
+				return "", fmt.Errorf("failed to restart download: %w", err)
+			}
+			hash.Reset()
+			offset = 0
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// With If-Range, the range is only applied to an unchanged asset, so
+		// a partial file that is already the whole asset has nothing left to
+		// fetch.
+		if req.Header.Get("If-Range") != "" && resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+		}
+		// The partial file does not match what the server has, so discard it.
+		if err := out.Truncate(0); err != nil {
+			return "", fmt.Errorf("failed to restart download: %w", err)
+		}
+		return "", &retryableError{fmt.Errorf("partial download of %s could not be resumed", asset.Name)}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return "", &retryableError{fmt.Errorf("download failed with status %d", resp.StatusCode)}
+	default:
+		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
 	}
 
-	out, err := io.ReadAll(resp.Body)
+	total := asset.Size
+	if resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+	if opts.MaxSize > 0 && total > opts.MaxSize {
+		return "", fmt.Errorf("%w: %s is %d bytes (limit %d)", ErrTooLarge, asset.Name, total, opts.MaxSize)
+	}
+
+	// Read one byte beyond the limit so that an oversized body can be detected.
+	var body io.Reader = &progressReader{r: resp.Body, done: offset, total: total, progress: opts.Progress}
+	if opts.MaxSize > 0 {
+		body = io.LimitReader(body, opts.MaxSize-offset+1)
+	}
+
+	written, err := io.Copy(io.MultiWriter(out, hash), body)
 	if err != nil {
-		return fmt.Errorf("failed to read asset data: %w", err)
+		var readErr *bodyReadError
+		if errors.As(err, &readErr) {
+			return "", &retryableError{fmt.Errorf("download of %s interrupted: %w", asset.Name, readErr.err)}
+		}
+		return "", fmt.Errorf("failed to write asset to file: %w", err)
 	}
 
-	// Use 0600 permissions for downloaded file (temp file).
-	if err := os.WriteFile(dest, out, 0600); err != nil {
-		return fmt.Errorf("failed to write asset to file: %w", err)
+	if opts.MaxSize > 0 && offset+written > opts.MaxSize {
+		out.Close()
+		_ = os.Remove(partPath)
+		return "", fmt.Errorf("%w: %s is larger than %d bytes", ErrTooLarge, asset.Name, opts.MaxSize)
 	}
 
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// saveValidator records what identifies the version of the asset in a
+// response, so that resuming can check that it has not changed: a strong
+// ETag, or else the Last-Modified date.
+func saveValidator(partPath string, header http.Header) error {
+	validator := header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		// If-Range requires a strong validator.
+		validator = ""
+	}
+	if validator == "" {
+		validator = header.Get("Last-Modified")
+	}
+	path := validatorPath(partPath)
+	if validator == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove partial download: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(validator), 0600); err != nil {
+		return fmt.Errorf("failed to record download validator: %w", err)
+	}
 	return nil
 }
+
+// bodyReadError distinguishes network failures while reading a response body
+// from failures writing to disk.
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string { return e.err.Error() }
+
+// progressReader reports progress as a response body is read.
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.done += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.done, p.total)
+	}
+	if err != nil && err != io.EOF {
+		return n, &bodyReadError{err}
+	}
+	return n, err
+}
@@ -1,7 +1,18 @@
 package github
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFindAsset(t *testing.T) {
@@ -224,3 +235,255 @@ func TestParseSource(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadAssetSizeLimit(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Omit Content-Length on request so the streaming check is exercised.
+		if r.URL.Query().Get("chunked") == "1" {
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "github-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name      string
+		asset     Asset
+		maxSize   int64
+		wantError bool
+	}{
+		{name: "Within limit", asset: Asset{Name: "a", BrowserDownloadURL: server.URL}, maxSize: 1000},
+		{name: "Unlimited", asset: Asset{Name: "a", BrowserDownloadURL: server.URL}, maxSize: 0},
+		{name: "Advertised size too large", asset: Asset{Name: "a", BrowserDownloadURL: server.URL, Size: 5000},
+			maxSize: 1000, wantError: true},
+		{name: "Content-Length too large", asset: Asset{Name: "a", BrowserDownloadURL: server.URL},
+			maxSize: 999, wantError: true},
+		{name: "Streamed body too large", asset: Asset{Name: "a", BrowserDownloadURL: server.URL + "?chunked=1"},
+			maxSize: 999, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(tmpDir, "download")
+			_, err := DownloadAsset(&tt.asset, dest, DownloadOptions{MaxSize: tt.maxSize})
+
+			if tt.wantError {
+				if !errors.Is(err, ErrTooLarge) {
+					t.Errorf("DownloadAsset() error = %v, want ErrTooLarge", err)
+				}
+				if _, statErr := os.Stat(dest); statErr == nil && tt.asset.Size == 0 {
+					t.Errorf("expected oversized download to be removed")
+				}
+				_ = os.Remove(dest)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DownloadAsset() unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatalf("failed to read download: %v", err)
+			}
+			if string(data) != body {
+				t.Errorf("downloaded %d bytes, want %d", len(data), len(body))
+			}
+		})
+	}
+}
+
+func TestDownloadAssetResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	var requests int
+	var sawRange bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if requests == 1 {
+			// Promise the whole body, send half of it, then drop the connection.
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		sawRange = r.Header.Get("Range") != ""
+		http.ServeContent(w, r, "asset", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "github-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var lastDone, lastTotal int64
+	asset := &Asset{Name: "asset", BrowserDownloadURL: server.URL, Size: int64(len(content))}
+	dest := filepath.Join(tmpDir, "asset")
+	checksum, err := DownloadAsset(asset, dest, DownloadOptions{
+		Retries:  1,
+		Progress: func(done, total int64) { lastDone, lastTotal = done, total },
+	})
+	if err != nil {
+		t.Fatalf("DownloadAsset() unexpected error: %v", err)
+	}
+
+	if !sawRange {
+		t.Error("expected the retry to send a Range header")
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read download: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("resumed download does not match original content")
+	}
+	sum := sha256.Sum256(content)
+	if want := "sha256:" + hex.EncodeToString(sum[:]); checksum != want {
+		t.Errorf("DownloadAsset() checksum = %q, want %q", checksum, want)
+	}
+	if lastDone != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Errorf("final progress = %d/%d, want %d/%d", lastDone, lastTotal, len(content), len(content))
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Error("expected partial file to be renamed into place")
+	}
+}
+
+func TestDownloadAssetResumeChanged(t *testing.T) {
+	original := []byte(strings.Repeat("0123456789", 1000))
+	replaced := []byte(strings.Repeat("abcdefghij", 1000))
+	var requests int
+	var sawIfRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Send half of the original asset, then drop the connection.
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", fmt.Sprint(len(original)))
+			_, _ = w.Write(original[:len(original)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		// The asset has since been uploaded again.
+		sawIfRange = r.Header.Get("If-Range")
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "asset", time.Time{}, bytes.NewReader(replaced))
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "github-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	asset := &Asset{Name: "asset", BrowserDownloadURL: server.URL, Size: int64(len(original))}
+	dest := filepath.Join(tmpDir, "asset")
+	if _, err := DownloadAsset(asset, dest, DownloadOptions{Retries: 1}); err != nil {
+		t.Fatalf("DownloadAsset() unexpected error: %v", err)
+	}
+
+	if sawIfRange != `"v1"` {
+		t.Errorf("If-Range = %q, want the ETag of the partial download", sawIfRange)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read download: %v", err)
+	}
+	if !bytes.Equal(data, replaced) {
+		t.Errorf("download was spliced from two versions of the asset")
+	}
+	if _, err := os.Stat(dest + ".part.validator"); !os.IsNotExist(err) {
+		t.Error("expected the validator to be removed")
+	}
+}
+
+func TestDownloadAssetCompletePart(t *testing.T) {
+	current := []byte(strings.Repeat("0123456789", 1000))
+	stale := []byte(strings.Repeat("abcdefghij", 1000))
+
+	tests := []struct {
+		name      string
+		part      []byte
+		validator string
+		// wantBody is whether the asset is sent again.
+		wantBody bool
+	}{
+		// The part is the current asset, which the server confirms.
+		{name: "complete and unchanged", part: current, validator: `"v2"`},
+		// A part left from another asset of the same size is not trusted.
+		{name: "left from another asset", part: stale, validator: `"v1"`, wantBody: true},
+		{name: "without a validator", part: stale, wantBody: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, bodies int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("ETag", `"v2"`)
+				rec := &statusRecorder{ResponseWriter: w}
+				http.ServeContent(rec, r, "asset", time.Time{}, bytes.NewReader(current))
+				if rec.status == http.StatusOK {
+					bodies++
+				}
+			}))
+			defer server.Close()
+
+			tmpDir, err := os.MkdirTemp("", "github-test-*")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			dest := filepath.Join(tmpDir, "asset")
+			if err := os.WriteFile(dest+".part", tt.part, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.validator != "" {
+				if err := os.WriteFile(dest+".part.validator", []byte(tt.validator), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			asset := &Asset{Name: "asset", BrowserDownloadURL: server.URL, Size: int64(len(current))}
+			checksum, err := DownloadAsset(asset, dest, DownloadOptions{Retries: 1, Resume: true})
+			if err != nil {
+				t.Fatalf("DownloadAsset() unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatalf("failed to read download: %v", err)
+			}
+			if !bytes.Equal(data, current) {
+				t.Errorf("download does not match the current asset")
+			}
+			sum := sha256.Sum256(current)
+			if want := "sha256:" + hex.EncodeToString(sum[:]); checksum != want {
+				t.Errorf("DownloadAsset() checksum = %q, want %q", checksum, want)
+			}
+			if requests != 1 || (bodies == 1) != tt.wantBody {
+				t.Errorf("DownloadAsset() made %d requests with %d bodies, want one request, sent again %v", requests, bodies, tt.wantBody)
+			}
+		})
+	}
+}
+
+// statusRecorder records the status code a handler sends.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -2,29 +2,90 @@ package install
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/binfmt"
+	"github.com/sfkleach/execman/pkg/companion"
 	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/dircheck"
+	"github.com/sfkleach/execman/pkg/fetch"
 	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/policy"
 	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/remove"
+	"github.com/sfkleach/execman/pkg/store"
 )
 
+// ErrLockMismatch is returned when a download differs from the one recorded
+// in a lockfile.
+var ErrLockMismatch = errors.New("download does not match the lockfile")
+
+// ErrAborted is returned when the user aborts an install whose name is
+// taken by an executable from another source.
+var ErrAborted = errors.New("installation aborted")
+
 // Options represents the install command options.
 type Options struct {
 	Source             string
 	Into               string
 	Yes                bool
 	IncludePrereleases bool
+	Companions         bool
+	// Name is the name to install the executable as. It defaults to the
+	// repository name.
+	Name string
+	// Store installs the version into the versioned store, beside any other
+	// versions kept there, rather than into an install directory. The
+	// installed executable of the same name is left alone.
+	Store bool
+	// Aliases are further names for the executable, installed as symlinks
+	// beside it and removed with it.
+	Aliases []string
+	// Replace allows replacing an executable of the same name that was
+	// installed from a different source. Without it, that is only done when
+	// the user chooses it at a prompt.
+	Replace bool
+	// Locked is the download recorded in a lockfile for this platform. When
+	// set, installation fails unless exactly those bytes are installed.
+	Locked *manifest.LockedAsset
+	// ChecksumPolicy overrides the configured checksum policy and is recorded
+	// against the executable so that later updates apply it too.
+	ChecksumPolicy string
+	// SignaturePolicy overrides the configured signature policy in the same
+	// way.
+	SignaturePolicy string
+	// TrustKey names a minisign or GPG public key file to trust for the
+	// source, replacing any key pinned before.
+	TrustKey string
+	// VerifyProvenance requires SLSA provenance showing that the download
+	// was built from the source repository by a trusted builder.
+	VerifyProvenance bool
+	// Input supplies the answers to prompts. It defaults to standard input.
+	Input io.Reader
+}
+
+// input returns where the answers to prompts are read from.
+func (o Options) input() io.Reader {
+	if o.Input == nil {
+		return os.Stdin
+	}
+	return o.Input
 }
 
 // Run executes the install command.
 func Run(opts Options) error {
+	in := bufio.NewReader(opts.input())
+
 	// Load registry and config.
 	reg, err := registry.Load()
 	if err != nil {
@@ -36,19 +97,60 @@ func Run(opts Options) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	pol, err := policy.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	if opts.ChecksumPolicy != "" {
+		if err := config.ValidatePolicy(opts.ChecksumPolicy); err != nil {
+			return fmt.Errorf("invalid checksum policy: %w", err)
+		}
+	}
+	if opts.SignaturePolicy != "" {
+		if err := config.ValidatePolicy(opts.SignaturePolicy); err != nil {
+			return fmt.Errorf("invalid signature policy: %w", err)
+		}
+	}
+
 	// Parse source.
 	owner, repo, version, err := github.ParseSource(opts.Source)
 	if err != nil {
 		return err
 	}
 
-	// Use config defaults if not specified.
-	if opts.Into == "" {
-		opts.Into = cfg.DefaultInstallDir
+	if opts.Store && opts.Into != "" {
+		return fmt.Errorf("a version in the store cannot also be installed into %s", opts.Into)
+	}
+
+	// Resolve the install directory, which may be a named location. The
+	// versioned store needs the version, so its directory is found later.
+	var location string
+	if !opts.Store {
+		installDir, name, err := cfg.ResolveInstallDir(opts.Into)
+		if err != nil {
+			return err
+		}
+		opts.Into = installDir
+		location = name
 	}
+
+	// Use config defaults if not specified.
 	if !opts.IncludePrereleases {
 		opts.IncludePrereleases = cfg.IncludePrereleases
 	}
+	if !opts.Companions && !opts.Store {
+		opts.Companions = cfg.InstallCompanions
+	}
+
+	// Check the source against the policy before contacting it.
+	source := github.ToURL(owner, repo)
+	if err := pol.CheckSource(source); err != nil {
+		return err
+	}
+	if pol.ForbidsPrereleases() {
+		opts.IncludePrereleases = false
+	}
 
 	// Fetch release.
 	var release *github.Release
@@ -62,6 +164,9 @@ func Run(opts Options) error {
 	if err != nil {
 		return err
 	}
+	if err := pol.CheckRelease(source, release.TagName, release.Prerelease); err != nil {
+		return err
+	}
 
 	// Set version from release tag if we fetched the latest.
 	if version == "" {
@@ -70,13 +175,61 @@ func Run(opts Options) error {
 
 	// Check if already installed.
 	execName := repo
-	if existing, found := reg.Get(execName); found {
+	if opts.Name != "" {
+		execName = opts.Name
+	}
+	if err := registry.ValidateName(execName); err != nil {
+		return err
+	}
+	execName, replaced, err := chooseName(reg, execName, source, opts, in)
+	if err != nil {
+		return err
+	}
+	existing, found := reg.Get(execName)
+	if replaced != nil {
+		// Nothing is carried over from an executable of another source.
+		existing, found = nil, false
+	}
+	var aliases []string
+	if found && !opts.Store {
+		aliases = append(aliases, existing.Aliases...)
+	}
+	if opts.Store {
+		if len(opts.Aliases) > 0 {
+			return fmt.Errorf("a version in the store cannot have aliases")
+		}
+
+		// The store may only hold versions of the executable already known
+		// under this name.
+		for _, v := range reg.ListVersions(execName) {
+			if stored, _ := reg.GetVersion(execName, v); stored.Source != source {
+				return fmt.Errorf("the store already holds %s from %s", execName, stored.Source)
+			}
+		}
+		if found && existing.Version == version {
+			fmt.Printf("%s %s is already installed at %s\n", execName, version, existing.Path)
+			return nil
+		}
+		active := existing
+		existing, found = reg.GetVersion(execName, version)
+		if !found && active != nil {
+			// Policies set for the installed executable apply to its other
+			// versions too, and if it was signed they must be signed.
+			existing = &registry.Executable{ChecksumPolicy: active.ChecksumPolicy, SignaturePolicy: active.SignaturePolicy, Signature: active.Signature}
+		}
+
+		storeDir, err := store.Dir(execName, version)
+		if err != nil {
+			return err
+		}
+		opts.Into = storeDir
+	}
+	if found {
 		if existing.Version == version {
 			fmt.Printf("Warning: %s version %s is already installed at %s\n", execName, version, existing.Path)
 			if !opts.Yes {
 				fmt.Print("Reinstall? (y/N): ")
-				reader := bufio.NewReader(os.Stdin)
-				response, _ := reader.ReadString('\n')
+				response, _ := in.ReadString('\n')
 				response = strings.TrimSpace(strings.ToLower(response))
 				if response != "y" && response != "yes" {
 					fmt.Println("Installation cancelled.")
@@ -93,11 +246,48 @@ func Run(opts Options) error {
 	fmt.Printf("  Version:    %s\n", version)
 	fmt.Printf("  Platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	fmt.Printf("  Target:     %s\n", targetPath)
+	if location != "" {
+		fmt.Printf("  Location:   @%s\n", location)
+	}
+	if replaced != nil {
+		fmt.Printf("  Replaces:   %s %s from %s\n", execName, replaced.Version, replaced.Source)
+	}
+	aliasPaths, err := checkAliases(reg, execName, opts.Into, opts.Aliases)
+	if err != nil {
+		return err
+	}
+	if len(opts.Aliases) > 0 {
+		fmt.Printf("  Aliases:    %s\n", strings.Join(opts.Aliases, ", "))
+	}
+
+	// Never overwrite another managed executable, and only replace a file
+	// that execman does not manage with consent.
+	if !opts.Store {
+		for _, path := range append([]string{targetPath}, aliasPaths...) {
+			ok, err := Claim(reg, execName, path, opts.Yes, in)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("Installation cancelled.")
+				return nil
+			}
+		}
+	}
+
+	// Check the install directory before writing to it. The store is
+	// execman's own and is deliberately not on PATH, so it is not checked.
+	if !opts.Store {
+		if err := dircheck.Preflight(targetPath, cfg.InstallDirCheck, func(issue dircheck.Issue) {
+			fmt.Printf("Warning: %s\n", issue)
+		}); err != nil {
+			return fmt.Errorf("refusing to install into %s: %w", opts.Into, err)
+		}
+	}
 
 	if !opts.Yes {
 		fmt.Print("\nProceed with installation? (Y/n): ")
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
+		response, _ := in.ReadString('\n')
 		response = strings.TrimSpace(strings.ToLower(response))
 		if response == "n" || response == "no" {
 			fmt.Println("Installation cancelled.")
@@ -107,7 +297,15 @@ func Run(opts Options) error {
 
 	// Find matching asset.
 	fmt.Println("\nFinding matching asset...")
-	asset, err := github.FindAsset(release.Assets, runtime.GOOS, runtime.GOARCH)
+	var asset *github.Asset
+	if opts.Locked != nil {
+		asset, err = lockedAsset(release.Assets, opts.Locked)
+		if err != nil {
+			return err
+		}
+	} else {
+		asset, err = github.FindAsset(release.Assets, runtime.GOOS, runtime.GOARCH)
+	}
 	if err != nil {
 		fmt.Println("\nAvailable assets:")
 		for _, a := range release.Assets {
@@ -117,47 +315,41 @@ func Run(opts Options) error {
 	}
 	fmt.Printf("Found: %s\n", asset.Name)
 
-	// Create temp directory for download.
-	tempDir, err := os.MkdirTemp("", "execman-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+	// Download and verify the asset.
+	checksumPolicy := opts.ChecksumPolicy
+	if checksumPolicy == "" && existing != nil {
+		checksumPolicy = existing.ChecksumPolicy
 	}
-	defer os.RemoveAll(tempDir)
-
-	archivePath := filepath.Join(tempDir, asset.Name)
-
-	// Download asset.
-	fmt.Printf("\nDownloading %s...\n", asset.Name)
-	if err := github.DownloadAsset(asset, archivePath); err != nil {
+	signaturePolicy := opts.SignaturePolicy
+	if signaturePolicy == "" && existing != nil {
+		signaturePolicy = existing.SignaturePolicy
+	}
+	trust := cfg.TrustFor(source)
+	pinnedKey, _ := reg.GetKey(source)
+	effectiveSignaturePolicy := fetch.EffectiveSignaturePolicy(signaturePolicy, "", trust, cfg)
+	// A reinstall must be signed if the installed download was.
+	if pol.RequiresSignature(source) || (existing != nil && existing.Signature != nil) || pinnedKey != nil {
+		effectiveSignaturePolicy = config.PolicyRequire
+	}
+	fetched, err := fetch.Asset(cfg, release, asset, fetch.Options{
+		ChecksumPolicy:   fetch.EffectivePolicy(checksumPolicy, "", cfg),
+		SignaturePolicy:  effectiveSignaturePolicy,
+		Source:           source,
+		Trust:            trust,
+		PinnedKey:        pinnedKey,
+		TrustKey:         opts.TrustKey,
+		VerifyProvenance: opts.VerifyProvenance,
+	})
+	if errors.Is(err, fetch.ErrSignatureRequired) && pol.RequiresSignature(source) {
+		return policy.SignatureViolation(source, err)
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Println("Download complete.")
-
-	// Try to download and verify checksum (optional, won't fail if not available).
-	checksumPath := filepath.Join(tempDir, "checksums.txt")
-	var expectedChecksum string
-	for _, a := range release.Assets {
-		if strings.Contains(strings.ToLower(a.Name), "checksum") ||
-			strings.HasSuffix(strings.ToLower(a.Name), ".sha256") {
-			fmt.Println("\nDownloading checksums...")
-			if err := github.DownloadAsset(&a, checksumPath); err == nil {
-				checksum, err := archive.FindChecksumInFile(checksumPath, asset.Name)
-				if err == nil {
-					expectedChecksum = checksum
-					fmt.Println("Verifying checksum...")
-					archiveChecksum, err := archive.CalculateChecksum(archivePath)
-					if err != nil {
-						return fmt.Errorf("failed to calculate checksum: %w", err)
-					}
-					if archiveChecksum != expectedChecksum {
-						return fmt.Errorf("checksum verification failed")
-					}
-					fmt.Println("Checksum verified.")
-				}
-			}
-			break
-		}
+	if opts.Locked != nil && fetched.Checksum != opts.Locked.ArchiveChecksum {
+		return fmt.Errorf("%w: %s has checksum %s, locked %s", ErrLockMismatch, asset.Name, fetched.Checksum, opts.Locked.ArchiveChecksum)
 	}
+	archivePath := fetched.ArchivePath
 
 	// Ensure target directory exists.
 	// #nosec G301 -- Install directory needs 0755 for executables to be accessible
@@ -165,12 +357,83 @@ func Run(opts Options) error {
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	// Extract binary.
+	// Extract binary next to the target, so that it can be checked before
+	// atomically replacing any existing file.
 	fmt.Println("\nExtracting binary...")
-	if err := archive.ExtractBinary(archivePath, targetPath); err != nil {
+	stagingPath := filepath.Join(opts.Into, "."+execName+".execman-new")
+	if err := archive.ExtractBinary(archivePath, stagingPath, cfg.ExtractionLimits); err != nil {
+		_ = os.Remove(stagingPath)
 		return fmt.Errorf("failed to extract binary: %w", err)
 	}
 
+	// Verify the binary was built for this platform.
+	info, err := binfmt.Check(stagingPath, runtime.GOOS, runtime.GOARCH, cfg.PlatformCheck, func(err error) {
+		fmt.Printf("Warning: %v\n", err)
+	})
+	if err != nil {
+		_ = os.Remove(stagingPath)
+		return fmt.Errorf("refusing to install %s: %w", asset.Name, err)
+	}
+	var format string
+	if info != nil {
+		format = info.String()
+	}
+
+	if opts.Locked != nil {
+		checksum, err := archive.CalculateChecksum(stagingPath)
+		if err == nil && checksum != opts.Locked.BinaryChecksum {
+			err = fmt.Errorf("%w: the executable has checksum %s, locked %s", ErrLockMismatch, checksum, opts.Locked.BinaryChecksum)
+		}
+		if err != nil {
+			_ = os.Remove(stagingPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(stagingPath, targetPath); err != nil {
+		_ = os.Remove(stagingPath)
+		return fmt.Errorf("failed to install binary: %w", err)
+	}
+
+	// Clear away what the replaced executable leaves behind.
+	if replaced != nil {
+		remove.DeleteExtras(reg, execName, replaced)
+		if replaced.Path != targetPath {
+			if err := os.Remove(replaced.Path); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("Warning: failed to remove %s: %v\n", replaced.Path, err)
+			}
+		}
+	}
+
+	// Install companion files, replacing any left by a previous installation.
+	var companions []registry.CompanionFile
+	if found && len(existing.Companions) > 0 {
+		if err := companion.Remove(existing.Companions); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if opts.Companions {
+		fmt.Println("Installing companion files...")
+		companions, err = companion.Install(archivePath, execName, cfg.ExtractionLimits)
+		if err != nil {
+			fmt.Printf("Warning: failed to install companion files: %v\n", err)
+		}
+		for _, c := range companions {
+			fmt.Printf("  %-16s %s\n", c.Kind, c.Path)
+		}
+	}
+
+	// Link the aliases to the executable.
+	for _, aliasPath := range aliasPaths {
+		if err := linkAlias(aliasPath, execName); err != nil {
+			fmt.Printf("Warning: failed to create alias %s: %v\n", aliasPath, err)
+			continue
+		}
+		if !slices.Contains(aliases, aliasPath) {
+			aliases = append(aliases, aliasPath)
+		}
+	}
+
 	// Calculate checksum of installed binary.
 	fmt.Println("Calculating checksum of installed binary...")
 	checksum, err := archive.CalculateChecksum(targetPath)
@@ -181,14 +444,31 @@ func Run(opts Options) error {
 	// Register executable.
 	fmt.Println("Updating registry...")
 	platformStr := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
-	reg.Add(execName, &registry.Executable{
-		Source:      github.ToURL(owner, repo),
-		Version:     version,
-		InstalledAt: time.Now(),
-		Path:        targetPath,
-		Platform:    platformStr,
-		Checksum:    checksum,
-	})
+	record := &registry.Executable{
+		Source:          source,
+		Version:         version,
+		InstalledAt:     time.Now(),
+		Path:            targetPath,
+		Platform:        platformStr,
+		Checksum:        checksum,
+		Prerelease:      release.Prerelease,
+		Location:        location,
+		Format:          format,
+		Companions:      companions,
+		Aliases:         aliases,
+		ChecksumPolicy:  checksumPolicy,
+		SignaturePolicy: signaturePolicy,
+		Signature:       fetched.Signature,
+		Provenance:      fetched.Provenance,
+	}
+	if opts.Store {
+		reg.AddVersion(execName, record)
+	} else {
+		reg.Add(execName, record)
+	}
+	if fetched.Key != nil {
+		reg.PinKey(source, fetched.Key)
+	}
 
 	if err := reg.Save(); err != nil {
 		return fmt.Errorf("failed to save registry: %w", err)
@@ -197,3 +477,137 @@ func Run(opts Options) error {
 	fmt.Printf("\n✓ Successfully installed %s %s to %s\n", execName, version, targetPath)
 	return nil
 }
+
+// Claim checks that the executable called name may be written at path: the
+// path must not belong to another managed executable, and a file there that
+// execman does not manage is only replaced if the user agrees, or with yes.
+// It is shared by the commands that put executables on PATH.
+func Claim(reg *registry.Registry, name, path string, yes bool, in *bufio.Reader) (bool, error) {
+	if owner, ok := reg.Owner(path); ok {
+		if owner == name {
+			return true, nil
+		}
+		return false, fmt.Errorf("%s belongs to %s, which execman manages", path, owner)
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return true, nil
+	}
+
+	fmt.Printf("Warning: %s already exists and is not managed by execman\n", path)
+	if yes {
+		return true, nil
+	}
+	fmt.Print("Replace it? (y/N): ")
+	response, _ := in.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
+// checkAliases checks the aliases requested for the executable called name
+// and returns their paths in dir. An alias may not take the name of a managed
+// executable, including one that only has versions in the store.
+func checkAliases(reg *registry.Registry, name, dir string, aliases []string) ([]string, error) {
+	var paths []string
+	for _, alias := range aliases {
+		if err := registry.ValidateName(alias); err != nil {
+			return nil, fmt.Errorf("alias: %w", err)
+		}
+		if alias == name {
+			return nil, fmt.Errorf("alias %q is the executable's own name", alias)
+		}
+		if _, ok := reg.Get(alias); ok || len(reg.ListVersions(alias)) > 0 {
+			return nil, fmt.Errorf("alias %q is the name of another managed executable", alias)
+		}
+		paths = append(paths, filepath.Join(dir, alias))
+	}
+	return paths, nil
+}
+
+// chooseName returns the name to install an executable from source under,
+// and the executable from another source that it replaces, if any. An
+// executable from another source is never replaced without consent: the user
+// is asked unless --replace or --yes was given, and may choose another name.
+func chooseName(reg *registry.Registry, name, source string, opts Options, in *bufio.Reader) (string, *registry.Executable, error) {
+	for {
+		existing, found := reg.Get(name)
+		if !found || existing.Source == source {
+			return name, nil, nil
+		}
+		if opts.Store {
+			return "", nil, fmt.Errorf("%s is already installed from %s; choose another name with --name", name, existing.Source)
+		}
+		if opts.Replace {
+			return name, existing, nil
+		}
+		if opts.Yes {
+			return "", nil, fmt.Errorf("%s is already installed from %s; choose another name with --name, or replace it with --replace", name, existing.Source)
+		}
+		newName, replace := resolveConflict(name, existing, source, in)
+		if replace {
+			return name, existing, nil
+		}
+		if newName == "" {
+			return "", nil, ErrAborted
+		}
+		name = newName
+	}
+}
+
+// resolveConflict explains that name belongs to an executable from another
+// source and asks what to do. It returns another name to install under, or
+// replace true to replace the existing executable. It returns "" and false if
+// the user aborts.
+func resolveConflict(name string, existing *registry.Executable, source string, in *bufio.Reader) (string, bool) {
+	fmt.Printf("\n%s is already managed by execman, but from another source:\n\n", name)
+	fmt.Printf("  Installed:  %s %s at %s\n", existing.Source, existing.Version, existing.Path)
+	fmt.Printf("  Requested:  %s\n\n", source)
+	fmt.Println("These are different executables that share a name.")
+
+	for {
+		fmt.Printf("Install under another (n)ame, (r)eplace the installed %s, or (a)bort? [n/r/A]: ", name)
+		response, _ := in.ReadString('\n')
+		switch strings.TrimSpace(strings.ToLower(response)) {
+		case "n", "name":
+		case "r", "replace":
+			return "", true
+		default:
+			return "", false
+		}
+
+		fmt.Print("New name: ")
+		response, _ = in.ReadString('\n')
+		newName := strings.TrimSpace(response)
+		if err := registry.ValidateName(newName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if newName == name {
+			continue
+		}
+		return newName, false
+	}
+}
+
+// linkAlias makes path a symlink to the executable called name in the same
+// directory, replacing whatever was there.
+func linkAlias(path, name string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(name, path)
+}
+
+// lockedAsset finds the asset recorded in a lockfile among a release's
+// assets, checking that it is still published at the same URL.
+func lockedAsset(assets []github.Asset, locked *manifest.LockedAsset) (*github.Asset, error) {
+	for i := range assets {
+		if assets[i].Name != locked.Asset {
+			continue
+		}
+		if assets[i].BrowserDownloadURL != locked.URL {
+			return nil, fmt.Errorf("%w: %s is published at %s, locked %s", ErrLockMismatch, locked.Asset, assets[i].BrowserDownloadURL, locked.URL)
+		}
+		return &assets[i], nil
+	}
+	return nil, fmt.Errorf("%w: the release no longer has %s", ErrLockMismatch, locked.Asset)
+}
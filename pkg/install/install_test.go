@@ -0,0 +1,210 @@
+package install
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+func TestClaim(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-install-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Add("gh", &registry.Executable{
+		Source:  "https://github.com/cli/cli",
+		Path:    filepath.Join(tmpDir, "gh"),
+		Aliases: []string{filepath.Join(tmpDir, "github")},
+	})
+	unmanaged := filepath.Join(tmpDir, "unmanaged")
+	if err := os.WriteFile(unmanaged, []byte("mine"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		owner   string
+		path    string
+		wantErr bool
+	}{
+		{name: "free path", owner: "tool", path: filepath.Join(tmpDir, "tool")},
+		{name: "own file", owner: "gh", path: filepath.Join(tmpDir, "gh")},
+		{name: "own alias", owner: "gh", path: filepath.Join(tmpDir, "github")},
+		{name: "another executable's file", owner: "tool", path: filepath.Join(tmpDir, "gh"), wantErr: true},
+		{name: "another executable's alias", owner: "tool", path: filepath.Join(tmpDir, "github"), wantErr: true},
+		{name: "unmanaged file with --yes", owner: "tool", path: unmanaged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := Claim(reg, tt.owner, tt.path, true, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Claim() accepted %s for %s", tt.path, tt.owner)
+				}
+				return
+			}
+			if err != nil || !ok {
+				t.Errorf("Claim() = %v, %v; want true, nil", ok, err)
+			}
+		})
+	}
+}
+
+func TestCheckAliases(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-install-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Add("fd", &registry.Executable{Source: "https://github.com/sharkdp/fd", Path: filepath.Join(tmpDir, "fd")})
+	reg.AddVersion("terraform", &registry.Executable{Source: "https://github.com/hashicorp/terraform", Version: "v1.5.7"})
+
+	tests := []struct {
+		name    string
+		aliases []string
+		wantErr bool
+	}{
+		{name: "free names", aliases: []string{"ripgrep", "grep2"}},
+		{name: "own name", aliases: []string{"rg"}, wantErr: true},
+		{name: "installed executable", aliases: []string{"fd"}, wantErr: true},
+		{name: "executable only in the store", aliases: []string{"terraform"}, wantErr: true},
+		{name: "invalid name", aliases: []string{"a/b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := checkAliases(reg, "rg", tmpDir, tt.aliases)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("checkAliases(%v) accepted the aliases", tt.aliases)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkAliases(%v) error: %v", tt.aliases, err)
+			}
+			if len(paths) != len(tt.aliases) || paths[0] != filepath.Join(tmpDir, tt.aliases[0]) {
+				t.Errorf("checkAliases(%v) = %v", tt.aliases, paths)
+			}
+		})
+	}
+}
+
+func TestChooseName(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-install-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := &registry.Executable{Source: "https://github.com/owner/tool", Path: filepath.Join(tmpDir, "tool")}
+	reg.Add("tool", installed)
+	reg.Add("other", &registry.Executable{Source: "https://github.com/owner/other", Path: filepath.Join(tmpDir, "other")})
+	source := "https://github.com/someone/tool"
+	reg.Add("someone-tool", &registry.Executable{Source: source, Path: filepath.Join(tmpDir, "someone-tool")})
+
+	tests := []struct {
+		name         string
+		execName     string
+		opts         Options
+		input        string
+		want         string
+		wantReplaced bool
+		wantErr      error
+		wantErrText  string
+	}{
+		{name: "free name", execName: "free", want: "free"},
+		{name: "same source", execName: "someone-tool", opts: Options{Yes: true}, want: "someone-tool"},
+		{name: "rename", execName: "tool", input: "n\nmytool\n", want: "mytool"},
+		{name: "rename to an earlier install", execName: "tool", input: "n\nsomeone-tool\n", want: "someone-tool"},
+		{name: "rename to a taken name", execName: "tool", input: "n\nother\nname\nmytool\n", want: "mytool"},
+		{name: "rename to an invalid name", execName: "tool", input: "n\nmy/tool\nn\nmytool\n", want: "mytool"},
+		{name: "replace", execName: "tool", input: "r\n", want: "tool", wantReplaced: true},
+		{name: "abort", execName: "tool", input: "a\n", wantErr: ErrAborted},
+		{name: "abort by default", execName: "tool", input: "\n", wantErr: ErrAborted},
+		{name: "no input", execName: "tool", wantErr: ErrAborted},
+		{name: "--replace", execName: "tool", opts: Options{Replace: true}, want: "tool", wantReplaced: true},
+		{name: "--yes with --replace", execName: "tool", opts: Options{Yes: true, Replace: true}, want: "tool", wantReplaced: true},
+		{name: "--yes without --replace", execName: "tool", opts: Options{Yes: true}, input: "r\n", wantErrText: "--replace"},
+		{name: "store", execName: "tool", opts: Options{Store: true, Replace: true}, wantErrText: "--name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, replaced, err := chooseName(reg, tt.execName, source, tt.opts, bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr != nil || tt.wantErrText != "" {
+				if err == nil {
+					t.Fatalf("chooseName() = %q, want error", name)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("chooseName() error = %v, want %v", err, tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Errorf("chooseName() error = %v, want it to mention %s", err, tt.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("chooseName() error: %v", err)
+			}
+			if name != tt.want {
+				t.Errorf("chooseName() name = %q, want %q", name, tt.want)
+			}
+			if (replaced == installed) != tt.wantReplaced {
+				t.Errorf("chooseName() replaced = %v, want replacement %v", replaced, tt.wantReplaced)
+			}
+		})
+	}
+}
+
+func TestLinkAlias(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-install-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "rg"), []byte("ripgrep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	aliasPath := filepath.Join(tmpDir, "ripgrep")
+	if err := os.WriteFile(aliasPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The alias replaces the file there with a relative symlink.
+	if err := linkAlias(aliasPath, "rg"); err != nil {
+		t.Fatalf("linkAlias() error: %v", err)
+	}
+	if target, err := os.Readlink(aliasPath); err != nil || target != "rg" {
+		t.Errorf("alias links to %q (%v), want rg", target, err)
+	}
+	if data, err := os.ReadFile(aliasPath); err != nil || string(data) != "ripgrep" {
+		t.Errorf("alias reads %q (%v), want the executable", data, err)
+	}
+}
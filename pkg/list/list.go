@@ -9,7 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/manifest"
 	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/scope"
 	"github.com/spf13/cobra"
 )
 
@@ -20,12 +23,33 @@ type ListOutput struct {
 
 // ExecutableInfo represents information about a single executable.
 type ExecutableInfo struct {
-	Name        string `json:"name"`
-	Source      string `json:"source"`
-	Version     string `json:"version"`
-	Path        string `json:"path"`
-	Platform    string `json:"platform,omitempty"`
-	Checksum    string `json:"checksum,omitempty"`
+	Name        string   `json:"name"`
+	Scope       string   `json:"scope"`
+	Source      string   `json:"source"`
+	Version     string   `json:"version"`
+	Path        string   `json:"path"`
+	Location    string   `json:"location,omitempty"`
+	Platform    string   `json:"platform,omitempty"`
+	Checksum    string   `json:"checksum,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Companions  []string `json:"companions,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+	InstalledAt string   `json:"installed_at"`
+	// Signature is the verified signature of the installed download.
+	Signature *registry.Signature `json:"signature,omitempty"`
+	// Provenance is the verified build provenance of the installed download.
+	Provenance *registry.Provenance `json:"provenance,omitempty"`
+	// Versions lists every installed version, including those in the
+	// versioned store, when there is more than the one on PATH.
+	Versions []VersionInfo `json:"versions,omitempty"`
+}
+
+// VersionInfo represents one installed version of an executable.
+type VersionInfo struct {
+	Version string `json:"version"`
+	Path    string `json:"path"`
+	// Active marks the version on PATH, rather than in the versioned store.
+	Active      bool   `json:"active"`
 	InstalledAt string `json:"installed_at"`
 }
 
@@ -33,54 +57,120 @@ type ExecutableInfo struct {
 func NewListCommand() *cobra.Command {
 	var jsonOutput bool
 	var longFormat bool
+	var userOnly bool
 
 	cmd := &cobra.Command{
 		Use:     "list [executable]",
 		Aliases: []string{"ls"},
 		Short:   "List managed executables",
-		Long:    "Display executables managed by execman. Optionally filter by name.",
-		Args:    cobra.MaximumNArgs(1),
+		Long: `Display executables managed by execman. Optionally filter by name.
+Executables in the system-wide registry are listed alongside the user's, unless
+--user or --system is given.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var filterName string
 			if len(args) > 0 {
 				filterName = args[0]
 			}
-			return runList(filterName, jsonOutput, longFormat)
+			return runList(filterName, jsonOutput, longFormat, userOnly)
 		},
 	}
 
 	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
 	cmd.Flags().BoolVarP(&longFormat, "long", "l", false, "Show detailed information")
+	cmd.Flags().BoolVar(&userOnly, "user", false, "Show only the user's executables")
 
 	return cmd
 }
 
-func runList(filterName string, jsonOutput bool, longFormat bool) error {
-	// Load registry.
-	reg, err := registry.Load()
+// Scope is the registry and config of one scope, and the executables in it
+// to show.
+type Scope struct {
+	Name     string
+	Config   *config.Config
+	Registry *registry.Registry
+	// Names are the executables to show, sorted by name.
+	Names []string
+	// StoreOnly are the executables to show that only have versions in the
+	// versioned store, sorted by name.
+	StoreOnly []string
+}
+
+// LoadScopes loads the scopes to show. When operating on the system scope,
+// or with userOnly, only that scope is loaded; otherwise the user's scope is
+// shown with the system's after it, unless the system's cannot be read, which
+// is only worth a warning.
+func LoadScopes(userOnly bool) ([]*Scope, error) {
+	names := []string{scope.Current()}
+	if scope.Current() == scope.User && !userOnly {
+		names = append(names, scope.System)
+	}
+
+	var scopes []*Scope
+	for i, name := range names {
+		reg, cfg, err := loadScope(name)
+		if err != nil && i > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %v; not showing %s executables\n", err, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		executables := reg.List()
+		sort.Strings(executables)
+		var storeOnly []string
+		for n := range reg.Versions {
+			if _, ok := reg.Get(n); !ok {
+				storeOnly = append(storeOnly, n)
+			}
+		}
+		sort.Strings(storeOnly)
+		scopes = append(scopes, &Scope{Name: name, Config: cfg, Registry: reg, Names: executables, StoreOnly: storeOnly})
+	}
+	return scopes, nil
+}
+
+// loadScope loads the registry and config of a scope.
+func loadScope(name string) (*registry.Registry, *config.Config, error) {
+	reg, err := registry.LoadScope(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load %s registry: %w", name, err)
+	}
+	cfg, err := config.LoadScope(name)
 	if err != nil {
-		return fmt.Errorf("failed to load registry: %w", err)
+		return nil, nil, fmt.Errorf("failed to load %s config: %w", name, err)
 	}
+	return reg, cfg, nil
+}
 
-	// Get all executable names.
-	names := reg.List()
+func runList(filterName string, jsonOutput, longFormat, userOnly bool) error {
+	// Load registries.
+	all, err := LoadScopes(userOnly)
+	if err != nil {
+		return err
+	}
 
-	// Filter by name if specified.
-	if filterName != "" {
-		found := false
-		for _, name := range names {
-			if name == filterName {
-				names = []string{filterName}
-				found = true
-				break
+	// Filter by name if specified, and leave out empty scopes.
+	var scopes []*Scope
+	for _, s := range all {
+		if filterName != "" {
+			s.Names = nil
+			s.StoreOnly = nil
+			if _, ok := s.Registry.Get(filterName); ok {
+				s.Names = []string{filterName}
+			} else if len(s.Registry.ListVersions(filterName)) > 0 {
+				s.StoreOnly = []string{filterName}
 			}
 		}
-		if !found {
-			return fmt.Errorf("executable %q is not managed by execman", filterName)
+		if len(s.Names) > 0 || len(s.StoreOnly) > 0 {
+			scopes = append(scopes, s)
 		}
 	}
 
-	if len(names) == 0 {
+	if len(scopes) == 0 {
+		if filterName != "" {
+			return fmt.Errorf("executable %q is not managed by execman", filterName)
+		}
 		if jsonOutput {
 			output := ListOutput{Executables: []ExecutableInfo{}}
 			encoder := json.NewEncoder(os.Stdout)
@@ -91,39 +181,60 @@ func runList(filterName string, jsonOutput bool, longFormat bool) error {
 		return nil
 	}
 
-	// Sort by name.
-	sort.Strings(names)
-
 	if jsonOutput {
-		return outputJSON(reg, names, longFormat)
+		return outputJSON(scopes, longFormat)
 	}
 
-	return outputText(reg, names, longFormat)
+	return outputText(scopes, longFormat)
 }
 
-func outputJSON(reg *registry.Registry, names []string, longFormat bool) error {
+func outputJSON(scopes []*Scope, longFormat bool) error {
 	// Convert to output format.
-	executables := make([]ExecutableInfo, 0, len(names))
-	for _, name := range names {
-		exec, ok := reg.Get(name)
-		if !ok {
-			continue
-		}
+	var executables []ExecutableInfo
+	for _, s := range scopes {
+		for _, name := range s.Names {
+			exec, ok := s.Registry.Get(name)
+			if !ok {
+				continue
+			}
 
-		info := ExecutableInfo{
-			Name:        name,
-			Source:      exec.Source,
-			Version:     exec.Version,
-			Path:        exec.Path,
-			InstalledAt: exec.InstalledAt.Format(time.RFC3339),
-		}
+			info := ExecutableInfo{
+				Name:        name,
+				Scope:       s.Name,
+				Source:      exec.Source,
+				Version:     exec.Version,
+				Path:        exec.Path,
+				Location:    s.Config.LocationName(exec.Location, exec.Path),
+				Aliases:     exec.Aliases,
+				InstalledAt: exec.InstalledAt.Format(time.RFC3339),
+			}
 
-		if longFormat {
-			info.Platform = exec.Platform
-			info.Checksum = exec.Checksum
-		}
+			if longFormat {
+				info.Platform = exec.Platform
+				info.Checksum = exec.Checksum
+				info.Format = exec.Format
+				info.Signature = exec.Signature
+				info.Provenance = exec.Provenance
+				for _, c := range exec.Companions {
+					info.Companions = append(info.Companions, c.Path)
+				}
+			}
+			if versions := Versions(s.Registry, name); len(versions) > 1 {
+				info.Versions = versions
+			}
 
-		executables = append(executables, info)
+			executables = append(executables, info)
+		}
+		for _, name := range s.StoreOnly {
+			versions := Versions(s.Registry, name)
+			stored, _ := s.Registry.GetVersion(name, versions[0].Version)
+			executables = append(executables, ExecutableInfo{
+				Name:     name,
+				Scope:    s.Name,
+				Source:   stored.Source,
+				Versions: versions,
+			})
+		}
 	}
 
 	output := ListOutput{Executables: executables}
@@ -133,76 +244,273 @@ func outputJSON(reg *registry.Registry, names []string, longFormat bool) error {
 	return encoder.Encode(output)
 }
 
-func outputText(reg *registry.Registry, names []string, longFormat bool) error {
+func outputText(scopes []*Scope, longFormat bool) error {
 	homeDir, _ := os.UserHomeDir()
+	count := 0
+	for _, s := range scopes {
+		count += len(s.Names) + len(s.StoreOnly)
+	}
 
 	// If showing a single executable in long format, use detailed view.
-	if len(names) == 1 && longFormat {
-		name := names[0]
+	if count == 1 && longFormat && len(scopes[0].Names) == 1 {
+		s := scopes[0]
+		name := s.Names[0]
+		cfg, reg := s.Config, s.Registry
 		exec, ok := reg.Get(name)
 		if !ok {
 			return fmt.Errorf("executable %q not found", name)
 		}
 
 		fmt.Printf("%s\n\n", name)
+		fmt.Printf("  Scope:        %s\n", s.Name)
 		fmt.Printf("  Source:       %s\n", exec.Source)
 		fmt.Printf("  Version:      %s\n", exec.Version)
 		fmt.Printf("  Path:         %s\n", exec.Path)
+		if location := cfg.LocationName(exec.Location, exec.Path); location != "" {
+			fmt.Printf("  Location:     @%s\n", location)
+		}
+		if len(exec.Aliases) > 0 {
+			var aliases []string
+			for _, alias := range exec.Aliases {
+				aliases = append(aliases, filepath.Base(alias))
+			}
+			fmt.Printf("  Aliases:      %s\n", strings.Join(aliases, ", "))
+		}
 		fmt.Printf("  Platform:     %s\n", exec.Platform)
+		if exec.Format != "" {
+			fmt.Printf("  Format:       %s\n", exec.Format)
+		}
+		if exec.ChecksumPolicy != "" {
+			fmt.Printf("  Checksums:    %s\n", exec.ChecksumPolicy)
+		}
+		if exec.SignaturePolicy != "" {
+			fmt.Printf("  Signatures:   %s\n", exec.SignaturePolicy)
+		}
+		fmt.Printf("  Signed:       %s\n", describeSignature(exec.Signature))
+		if p := exec.Provenance; p != nil {
+			fmt.Printf("  Provenance:   built from %s by %s (%s)\n", p.SourceRepo, p.Signer, p.Attestation)
+		}
+		if key, ok := reg.GetKey(exec.Source); ok {
+			fmt.Printf("  Pinned key:   %s %s (since %s)\n", key.Type, key.ID, key.PinnedAt.Format("2006-01-02"))
+		}
 		fmt.Printf("  Installed:    %s\n", exec.InstalledAt.Format(time.RFC3339))
 		fmt.Printf("  Checksum:     %s\n", exec.Checksum)
+		for i, c := range exec.Companions {
+			label := ""
+			if i == 0 {
+				label = "Companions:"
+			}
+			fmt.Printf("  %-13s %s\n", label, c.Path)
+		}
+		if versions := Versions(reg, name); len(versions) > 1 {
+			for i, v := range versions {
+				label := ""
+				if i == 0 {
+					label = "Versions:"
+				}
+				fmt.Printf("  %-13s %s\n", label, describeVersion(v, homeDir))
+			}
+		}
 
 		return nil
 	}
 
-	// Multiple executables or short format.
-	if len(names) > 1 || !longFormat {
-		fmt.Println("Managed executables:")
+	// Multiple executables or short format, labelled by scope when both
+	// scopes have executables.
+	for _, s := range scopes {
+		if len(scopes) > 1 {
+			fmt.Printf("Managed executables (%s):\n", s.Name)
+		} else {
+			fmt.Println("Managed executables:")
+		}
 		fmt.Println()
-	}
 
-	for _, name := range names {
-		exec, ok := reg.Get(name)
-		if !ok {
-			continue
+		groups := GroupByLocation(s.Config, s.Registry, s.Names)
+		for _, group := range groups {
+			if len(groups) > 1 {
+				fmt.Printf("%s:\n\n", group.Label)
+			}
+			for _, name := range group.Names {
+				printExecutable(s.Registry, name, homeDir, longFormat)
+			}
 		}
 
-		// Display path with ~ for home directory.
-		displayPath := exec.Path
-		if homeDir != "" && strings.HasPrefix(exec.Path, homeDir) {
-			displayPath = "~" + strings.TrimPrefix(exec.Path, homeDir)
+		if len(s.StoreOnly) > 0 {
+			if len(s.Names) > 0 {
+				fmt.Printf("In the store only:\n\n")
+			}
+			for _, name := range s.StoreOnly {
+				for i, v := range Versions(s.Registry, name) {
+					label := ""
+					if i == 0 {
+						label = name
+					}
+					fmt.Printf("  %-15s %-9s %s\n", label, v.Version, DisplayPath(v.Path, homeDir))
+				}
+				fmt.Println()
+			}
 		}
+	}
+
+	if count > 1 {
+		if count == 1 {
+			fmt.Println("1 executable managed")
+		} else {
+			fmt.Printf("%d executables managed\n", count)
+		}
+	}
+
+	return nil
+}
+
+// printExecutable prints an executable's entry in the short listing.
+func printExecutable(reg *registry.Registry, name, homeDir string, longFormat bool) {
+	exec, ok := reg.Get(name)
+	if !ok {
+		return
+	}
+
+	// Display path with ~ for home directory.
+	displayPath := DisplayPath(exec.Path, homeDir)
 
-		// Extract repo path from source URL.
-		source := strings.TrimPrefix(exec.Source, "https://")
+	// Extract repo path from source URL.
+	source := strings.TrimPrefix(exec.Source, "https://")
 
-		// Format installed_at timestamp.
-		installedDate := exec.InstalledAt.Format("2006-01-02")
+	// Format installed_at timestamp.
+	installedDate := exec.InstalledAt.Format("2006-01-02")
 
-		// Get just the executable name from the path.
-		execName := filepath.Base(exec.Path)
+	// Get just the executable name from the path.
+	execName := filepath.Base(exec.Path)
 
-		// Print formatted output.
-		fmt.Printf("  %-15s %-9s %s\n", execName, exec.Version, displayPath)
-		fmt.Printf("  %-15s %-9s %s\n", "", "", source)
+	// Print formatted output.
+	fmt.Printf("  %-15s %-9s %s\n", execName, exec.Version, displayPath)
+	fmt.Printf("  %-15s %-9s %s\n", "", "", source)
+
+	if longFormat {
+		fmt.Printf("  %-15s %-9s platform: %s\n", "", "", exec.Platform)
+		fmt.Printf("  %-15s %-9s checksum: %s\n", "", "", exec.Checksum)
+	}
 
-		if longFormat {
-			fmt.Printf("  %-15s %-9s platform: %s\n", "", "", exec.Platform)
-			fmt.Printf("  %-15s %-9s checksum: %s\n", "", "", exec.Checksum)
+	fmt.Printf("  %-15s %-9s installed %s\n", "", "", installedDate)
+	if versions := Versions(reg, name); len(versions) > 1 {
+		var tags []string
+		for _, v := range versions {
+			if v.Active {
+				tags = append(tags, v.Version+" (in use)")
+			} else {
+				tags = append(tags, v.Version)
+			}
 		}
+		fmt.Printf("  %-15s %-9s versions: %s\n", "", "", strings.Join(tags, ", "))
+	}
+	fmt.Println()
+}
 
-		fmt.Printf("  %-15s %-9s installed %s\n", "", "", installedDate)
-		fmt.Println()
+// Versions returns every installed version of an executable, the one on PATH
+// and those in the versioned store, newest first.
+func Versions(reg *registry.Registry, name string) []VersionInfo {
+	var versions []VersionInfo
+	if exec, ok := reg.Get(name); ok {
+		versions = append(versions, VersionInfo{
+			Version:     exec.Version,
+			Path:        exec.Path,
+			Active:      true,
+			InstalledAt: exec.InstalledAt.Format(time.RFC3339),
+		})
+	}
+	for _, version := range reg.ListVersions(name) {
+		exec, _ := reg.GetVersion(name, version)
+		versions = append(versions, VersionInfo{
+			Version:     exec.Version,
+			Path:        exec.Path,
+			InstalledAt: exec.InstalledAt.Format(time.RFC3339),
+		})
 	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return manifest.CompareTags(versions[i].Version, versions[j].Version) > 0
+	})
+	return versions
+}
 
-	if len(names) > 1 {
-		count := len(names)
-		if count == 1 {
-			fmt.Println("1 executable managed")
-		} else {
-			fmt.Printf("%d executables managed\n", count)
+// describeVersion describes an installed version for the detailed view.
+func describeVersion(v VersionInfo, homeDir string) string {
+	if v.Active {
+		return fmt.Sprintf("%s (in use)", v.Version)
+	}
+	return fmt.Sprintf("%s %s", v.Version, DisplayPath(v.Path, homeDir))
+}
+
+// Group is a set of executables installed in the same location.
+type Group struct {
+	// Label names the location, such as "@work (~/work/bin)", or is the
+	// directory for executables outside any configured location.
+	Label string
+	Names []string
+
+	location string
+	dir      string
+}
+
+// GroupByLocation groups executables by the location they are installed in.
+// Named locations come first, in name order, followed by other directories.
+// Names keep their order within each group.
+func GroupByLocation(cfg *config.Config, reg *registry.Registry, names []string) []Group {
+	homeDir, _ := os.UserHomeDir()
+	var groups []Group
+	index := map[string]int{}
+	for _, name := range names {
+		exec, ok := reg.Get(name)
+		if !ok {
+			continue
+		}
+		location := cfg.LocationName(exec.Location, exec.Path)
+		dir := filepath.Dir(exec.Path)
+		key := "@" + location
+		if location == "" {
+			key = dir
+		}
+		i, found := index[key]
+		if !found {
+			label := DisplayPath(dir, homeDir)
+			if location != "" {
+				label = fmt.Sprintf("@%s (%s)", location, label)
+			}
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, Group{Label: label, location: location, dir: dir})
 		}
+		groups[i].Names = append(groups[i].Names, name)
 	}
 
-	return nil
+	sort.SliceStable(groups, func(a, b int) bool {
+		ga, gb := groups[a], groups[b]
+		if (ga.location == "") != (gb.location == "") {
+			return ga.location != ""
+		}
+		if ga.location != gb.location {
+			return ga.location < gb.location
+		}
+		return ga.dir < gb.dir
+	})
+	return groups
+}
+
+// DisplayPath abbreviates the home directory in path to "~".
+func DisplayPath(path, homeDir string) string {
+	if homeDir != "" && strings.HasPrefix(path, homeDir) {
+		return "~" + strings.TrimPrefix(path, homeDir)
+	}
+	return path
+}
+
+// describeSignature summarises how an executable's download was signed.
+func describeSignature(sig *registry.Signature) string {
+	if sig == nil {
+		return "not verified"
+	}
+	signer := sig.KeyID
+	if sig.Identity != "" {
+		signer = fmt.Sprintf("%s (%s)", sig.Identity, sig.Issuer)
+	}
+	return fmt.Sprintf("%s, %s by %s", sig.Artifact, sig.Method, signer)
 }
@@ -0,0 +1,279 @@
+// Package lock implements the lock command, which pins the tools in a
+// manifest to exact releases and downloads.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/binfmt"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/fetch"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// DefaultPlatforms are the platforms locked when none are given.
+var DefaultPlatforms = []string{"linux/amd64", "linux/arm64", "darwin/amd64", "darwin/arm64"}
+
+// Options represents the lock command options.
+type Options struct {
+	Manifest  string
+	Platforms []string
+	// Update re-resolves every tool, rather than keeping versions already
+	// locked that still satisfy the manifest.
+	Update bool
+}
+
+// NewLockCommand creates the lock command.
+func NewLockCommand() *cobra.Command {
+	var manifestPath string
+	var platforms []string
+	var update bool
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Pin the tools in a manifest to exact releases",
+		Long: `Write a lockfile beside the manifest recording, for each tool, the exact
+release and, for each platform, the asset, its URL and the checksums of the
+asset and of the executable inside it. 'execman sync --frozen' installs
+exactly those bytes. Versions already locked are kept while they satisfy the
+manifest, unless --update is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return Run(Options{
+				Manifest:  manifestPath,
+				Platforms: platforms,
+				Update:    update,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&manifestPath, "manifest", "f", manifest.DefaultPath, "Manifest file to lock")
+	cmd.Flags().StringSliceVar(&platforms, "platform", nil, "Platform to lock, as os/arch (repeatable; default: common platforms and this one)")
+	cmd.Flags().BoolVar(&update, "update", false, "Re-resolve every tool to its newest matching release")
+
+	return cmd
+}
+
+// Run executes the lock command.
+func Run(opts Options) error {
+	m, err := manifest.Load(opts.Manifest)
+	if err != nil {
+		return err
+	}
+
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pol, err := policy.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	platforms, err := parsePlatforms(opts.Platforms)
+	if err != nil {
+		return err
+	}
+
+	lockPath := manifest.LockPath(opts.Manifest)
+	old, err := manifest.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	lock := &manifest.Lock{CreatedAt: time.Now().UTC()}
+	for i := range m.Tools {
+		tool := &m.Tools[i]
+		var previous *manifest.LockedTool
+		if old != nil && !opts.Update {
+			if locked, ok := old.Get(tool.Name); ok && locked.Current(tool) {
+				previous = locked
+			}
+		}
+
+		locked, err := lockTool(cfg, pol, reg, tool, previous, platforms)
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", tool.Name, err)
+		}
+		lock.Tools = append(lock.Tools, *locked)
+	}
+
+	if err := lock.Save(lockPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nLocked %d tools in %s:\n\n", len(lock.Tools), lockPath)
+	for _, locked := range lock.Tools {
+		fmt.Printf("  %-15s %-12s %d platforms\n", locked.Name, locked.Version, len(locked.Platforms))
+	}
+	return nil
+}
+
+// parsePlatforms checks a list of "os/arch" platforms. An empty list stands
+// for the default platforms and this one.
+func parsePlatforms(platforms []string) ([]string, error) {
+	if len(platforms) == 0 {
+		platforms = append([]string{}, DefaultPlatforms...)
+		host := runtime.GOOS + "/" + runtime.GOARCH
+		found := false
+		for _, p := range platforms {
+			found = found || p == host
+		}
+		if !found {
+			platforms = append(platforms, host)
+		}
+	}
+	for _, p := range platforms {
+		goos, goarch, ok := strings.Cut(p, "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid platform %q: expected os/arch, such as linux/amd64", p)
+		}
+	}
+	return platforms, nil
+}
+
+// lockTool locks a tool for the given platforms. The version and the assets
+// of a previous lock are kept where they can be.
+func lockTool(cfg *config.Config, pol *policy.Policy, reg *registry.Registry, tool *manifest.Tool, previous *manifest.LockedTool, platforms []string) (*manifest.LockedTool, error) {
+	if err := pol.CheckSource(tool.Source); err != nil {
+		return nil, err
+	}
+
+	locked := &manifest.LockedTool{
+		Name:       tool.Name,
+		Source:     tool.Source,
+		Constraint: tool.Version,
+		Platforms:  map[string]manifest.LockedAsset{},
+	}
+	if previous != nil {
+		locked.Version = previous.Version
+	} else {
+		fmt.Printf("Resolving %s...\n", tool.Name)
+		includePrereleases := (tool.Prerelease || cfg.IncludePrereleases) && !pol.ForbidsPrereleases()
+		version, err := tool.Resolve(includePrereleases)
+		if err != nil {
+			return nil, err
+		}
+		locked.Version = version
+	}
+
+	var release *github.Release
+	for _, platform := range platforms {
+		if previous != nil {
+			if asset, ok := previous.Platforms[platform]; ok {
+				locked.Platforms[platform] = asset
+				continue
+			}
+		}
+
+		if release == nil {
+			owner, repo, _, err := github.ParseSource(tool.Source)
+			if err != nil {
+				return nil, err
+			}
+			release, err = github.GetRelease(owner, repo, locked.Version)
+			if err != nil {
+				return nil, err
+			}
+			if err := pol.CheckRelease(tool.Source, release.TagName, release.Prerelease); err != nil {
+				return nil, err
+			}
+		}
+
+		asset, err := lockAsset(cfg, pol, reg, tool, release, platform)
+		if errors.Is(err, errNoAsset) {
+			fmt.Printf("Warning: %s %s has no asset for %s\n", tool.Name, locked.Version, platform)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", platform, err)
+		}
+		locked.Platforms[platform] = *asset
+	}
+
+	if len(locked.Platforms) == 0 {
+		return nil, fmt.Errorf("%s has no asset for any of %s", locked.Version, strings.Join(platforms, ", "))
+	}
+	return locked, nil
+}
+
+// errNoAsset is returned when a release has no asset for a platform.
+var errNoAsset = errors.New("no matching asset")
+
+// lockAsset downloads and verifies a release's asset for a platform, as
+// sync would, and records its checksums and those of the executable in it.
+// The tool's policies apply where they are stricter than the config's.
+func lockAsset(cfg *config.Config, pol *policy.Policy, reg *registry.Registry, tool *manifest.Tool, release *github.Release, platform string) (*manifest.LockedAsset, error) {
+	goos, goarch, _ := strings.Cut(platform, "/")
+	asset, err := github.FindAsset(release.Assets, goos, goarch)
+	if err != nil {
+		return nil, errNoAsset
+	}
+
+	source := tool.Source
+	trust := cfg.TrustFor(source)
+	pinnedKey, _ := reg.GetKey(source)
+	signaturePolicy := config.StricterPolicy(tool.SignaturePolicy, fetch.EffectiveSignaturePolicy("", "", trust, cfg))
+	if pol.RequiresSignature(source) {
+		signaturePolicy = config.PolicyRequire
+	}
+	fetched, err := fetch.Asset(cfg, release, asset, fetch.Options{
+		ChecksumPolicy:  config.StricterPolicy(tool.ChecksumPolicy, fetch.EffectivePolicy("", "", cfg)),
+		SignaturePolicy: signaturePolicy,
+		Source:          source,
+		Trust:           trust,
+		PinnedKey:       pinnedKey,
+	})
+	if errors.Is(err, fetch.ErrSignatureRequired) && pol.RequiresSignature(source) {
+		return nil, policy.SignatureViolation(source, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "execman-lock-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binaryPath := filepath.Join(tmpDir, "executable")
+	if err := archive.ExtractBinary(fetched.ArchivePath, binaryPath, cfg.ExtractionLimits); err != nil {
+		return nil, fmt.Errorf("failed to extract binary from %s: %w", asset.Name, err)
+	}
+	if _, err := binfmt.Check(binaryPath, goos, goarch, cfg.PlatformCheck, func(err error) {
+		fmt.Printf("Warning: %v\n", err)
+	}); err != nil {
+		return nil, fmt.Errorf("refusing to lock %s: %w", asset.Name, err)
+	}
+	binaryChecksum, err := archive.CalculateChecksum(binaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	return &manifest.LockedAsset{
+		Asset:           asset.Name,
+		URL:             asset.BrowserDownloadURL,
+		ArchiveChecksum: fetched.Checksum,
+		BinaryChecksum:  binaryChecksum,
+	}, nil
+}
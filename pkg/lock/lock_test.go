@@ -0,0 +1,246 @@
+package lock
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	host := runtime.GOOS + "/" + runtime.GOARCH
+
+	defaults, err := parsePlatforms(nil)
+	if err != nil {
+		t.Fatalf("parsePlatforms(nil) error: %v", err)
+	}
+	for _, want := range append([]string{host}, DefaultPlatforms...) {
+		if !slices.Contains(defaults, want) {
+			t.Errorf("parsePlatforms(nil) = %v, missing %s", defaults, want)
+		}
+	}
+	if len(defaults) > len(DefaultPlatforms)+1 {
+		t.Errorf("parsePlatforms(nil) = %v, with duplicates", defaults)
+	}
+
+	tests := []struct {
+		name      string
+		platforms []string
+		wantErr   bool
+	}{
+		{name: "explicit platforms", platforms: []string{"linux/amd64", "windows/arm64"}},
+		{name: "missing arch", platforms: []string{"linux"}, wantErr: true},
+		{name: "empty arch", platforms: []string{"linux/"}, wantErr: true},
+		{name: "empty os", platforms: []string{"/amd64"}, wantErr: true},
+		{name: "arch variant", platforms: []string{"linux/arm/v7"}, wantErr: true},
+		{name: "one invalid platform", platforms: []string{"linux/amd64", "darwin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlatforms(tt.platforms)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePlatforms(%v) expected error, got %v", tt.platforms, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePlatforms(%v) error: %v", tt.platforms, err)
+			}
+			if !slices.Equal(got, tt.platforms) {
+				t.Errorf("parsePlatforms(%v) = %v", tt.platforms, got)
+			}
+		})
+	}
+}
+
+func TestLockToolKeepsPreviousLock(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-lock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &manifest.Manifest{Tools: []manifest.Tool{{Source: "github.com/owner/tool", Version: "^1.2"}}}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tool := &m.Tools[0]
+
+	previous := &manifest.LockedTool{
+		Name:       "tool",
+		Source:     tool.Source,
+		Constraint: tool.Version,
+		Version:    "v1.2.3",
+		Platforms: map[string]manifest.LockedAsset{
+			"linux/amd64":  {Asset: "tool_linux_amd64.tar.gz", ArchiveChecksum: "sha256:aa", BinaryChecksum: "sha256:bb"},
+			"darwin/arm64": {Asset: "tool_darwin_arm64.tar.gz", ArchiveChecksum: "sha256:cc", BinaryChecksum: "sha256:dd"},
+		},
+	}
+
+	// Every platform is locked already, so nothing is resolved or
+	// downloaded.
+	locked, err := lockTool(&config.Config{}, &policy.Policy{}, reg, tool, previous, []string{"linux/amd64", "darwin/arm64"})
+	if err != nil {
+		t.Fatalf("lockTool() error: %v", err)
+	}
+	if locked.Version != previous.Version {
+		t.Errorf("lockTool() Version = %q, want %q", locked.Version, previous.Version)
+	}
+	for platform, want := range previous.Platforms {
+		if got := locked.Platforms[platform]; got != want {
+			t.Errorf("lockTool() %s = %+v, want %+v", platform, got, want)
+		}
+	}
+
+	// Platforms that are no longer wanted are dropped.
+	locked, err = lockTool(&config.Config{}, &policy.Policy{}, reg, tool, previous, []string{"linux/amd64"})
+	if err != nil {
+		t.Fatalf("lockTool() error: %v", err)
+	}
+	if len(locked.Platforms) != 1 {
+		t.Errorf("lockTool() Platforms = %v, want linux/amd64 only", locked.Platforms)
+	}
+}
+
+// tarGz returns a gzipped tarball holding an executable.
+func tarGz(t *testing.T, name, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	hdr := &tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLockAssetPolicies(t *testing.T) {
+	archiveData := tarGz(t, "tool", "#!/bin/sh\necho tool\n")
+	sum := sha256.Sum256(archiveData)
+	checksums := hex.EncodeToString(sum[:]) + "  tool_linux_amd64.tar.gz\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/checksums.txt":
+			_, _ = w.Write([]byte(checksums))
+			return
+		case "/bad/checksums.txt":
+			_, _ = w.Write([]byte(strings.Repeat("0", 64) + "  tool_linux_amd64.tar.gz\n"))
+			return
+		}
+		_, _ = w.Write(archiveData)
+	}))
+	defer server.Close()
+
+	tmpDir, err := os.MkdirTemp("", "execman-lock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("LocalAppData", tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		ExtractionLimits: archive.DefaultLimits,
+		PlatformCheck:    config.PolicyOff,
+		ChecksumPolicy:   config.PolicyWarn,
+		SignaturePolicy:  config.PolicyWarn,
+	}
+
+	// The releases are unsigned, and their checksums are right, wrong or
+	// missing.
+	release := func(checksums string) *github.Release {
+		r := &github.Release{TagName: "v1.0.0", Assets: []github.Asset{
+			{Name: "tool_linux_amd64.tar.gz", BrowserDownloadURL: server.URL + "/tool_linux_amd64.tar.gz"},
+		}}
+		if checksums != "" {
+			r.Assets = append(r.Assets, github.Asset{Name: "checksums.txt", BrowserDownloadURL: server.URL + "/" + checksums + "/checksums.txt"})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		tool      manifest.Tool
+		checksums string
+		wantErr   string
+	}{
+		{
+			name:      "configured policies",
+			tool:      manifest.Tool{Source: "github.com/owner/tool"},
+			checksums: "good",
+		},
+		{
+			name:      "tool requires a signature",
+			tool:      manifest.Tool{Source: "github.com/owner/tool", SignaturePolicy: config.PolicyRequire},
+			checksums: "good",
+			wantErr:   "signature verification is required",
+		},
+		{
+			name:    "tool requires a checksum",
+			tool:    manifest.Tool{Source: "github.com/owner/tool", ChecksumPolicy: config.PolicyRequire},
+			wantErr: "checksum verification is required",
+		},
+		{
+			name:      "tool cannot weaken the config",
+			tool:      manifest.Tool{Source: "github.com/owner/tool", ChecksumPolicy: config.PolicyOff},
+			checksums: "bad",
+			wantErr:   "checksum verification failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset, err := lockAsset(cfg, &policy.Policy{}, reg, &tt.tool, release(tt.checksums), "linux/amd64")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("lockAsset() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lockAsset() error: %v", err)
+			}
+			if asset.ArchiveChecksum != "sha256:"+hex.EncodeToString(sum[:]) {
+				t.Errorf("lockAsset() ArchiveChecksum = %q", asset.ArchiveChecksum)
+			}
+		})
+	}
+}
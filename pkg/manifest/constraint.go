@@ -0,0 +1,309 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed release tag, such as "v1.2.3" or "1.4.0-rc.1".
+type Version struct {
+	Major, Minor, Patch int
+	// Prerelease is the part after "-", if any.
+	Prerelease string
+	// parts is the number of components given, so that "1.2" can stand for
+	// any 1.2.x in a constraint.
+	parts int
+}
+
+// ParseVersion parses a release tag. A leading "v" and any "+build" suffix
+// are ignored.
+func ParseVersion(tag string) (Version, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	var v Version
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 || s == "" {
+		return Version{}, fmt.Errorf("invalid version %q", tag)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", tag)
+		}
+		*nums[i] = n
+	}
+	v.parts = len(fields)
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as, or newer than
+// w. A prerelease is older than the release it precedes.
+func (v Version) Compare(w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Prerelease == w.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case w.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, w.Prerelease)
+}
+
+// comparePrerelease compares dot-separated prerelease identifiers, numbers
+// numerically and anything else as text.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// CompareTags compares two release tags as versions, falling back to
+// comparing them as text when either is not a version.
+func CompareTags(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return va.Compare(vb)
+}
+
+// Constraint restricts which release tags are acceptable.
+type Constraint struct {
+	text string
+	// tag is set for a constraint naming a tag that is not a version, such
+	// as "nightly", which only that tag satisfies.
+	tag   string
+	terms []term
+}
+
+// term is a single comparison, such as ">=1.2".
+type term struct {
+	op string
+	v  Version
+}
+
+// ParseConstraint parses a version constraint. It accepts an exact version
+// ("v1.2.3"), a partial version or wildcard ("1.2", "1.x", "1.2.*"), a caret
+// or tilde range ("^1.2", "~1.2.3"), and comparisons (">=1.2 <2") that must
+// all hold. An empty constraint, "*" or "latest" accepts any release.
+func ParseConstraint(text string) (*Constraint, error) {
+	c := &Constraint{text: strings.TrimSpace(text)}
+	if c.text == "" || c.text == "*" || c.text == "latest" {
+		return c, nil
+	}
+
+	fields := strings.FieldsFunc(c.text, func(r rune) bool { return r == ' ' || r == ',' })
+	for _, field := range fields {
+		terms, err := parseTerm(field)
+		if err != nil {
+			// A single word that is not a version names a tag.
+			if len(fields) == 1 && !strings.ContainsAny(field, "<>=^~*") {
+				c.tag = field
+				return c, nil
+			}
+			return nil, fmt.Errorf("invalid version constraint %q: %w", text, err)
+		}
+		c.terms = append(c.terms, terms...)
+	}
+	return c, nil
+}
+
+// parseTerm parses one field of a constraint into comparisons.
+func parseTerm(field string) ([]term, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "=", ">", "<", "^", "~"} {
+		if strings.HasPrefix(field, prefix) {
+			op = prefix
+			break
+		}
+	}
+	rest := strings.TrimPrefix(field, op)
+
+	// Wildcards shorten the version: "1.2.x" means the same as "1.2".
+	fields := strings.Split(strings.TrimPrefix(rest, "v"), ".")
+	for i, f := range fields {
+		if f == "x" || f == "X" || f == "*" {
+			fields = fields[:i]
+			break
+		}
+	}
+	if len(fields) == 0 {
+		if op != "" {
+			return nil, fmt.Errorf("%q needs a version", field)
+		}
+		return nil, nil
+	}
+	v, err := ParseVersion(strings.Join(fields, "."))
+	if err != nil {
+		return nil, err
+	}
+	if v.parts < 3 && v.Prerelease != "" {
+		return nil, fmt.Errorf("%q has a prerelease without a full version", field)
+	}
+
+	switch op {
+	case "", "=":
+		if v.parts == 3 {
+			return []term{{"=", v}}, nil
+		}
+		return []term{{">=", v}, {"<", bump(v, v.parts-1)}}, nil
+	case "^":
+		// Allow changes that do not modify the leftmost non-zero component.
+		switch {
+		case v.Major > 0 || v.parts == 1:
+			return []term{{">=", v}, {"<", bump(v, 0)}}, nil
+		case v.Minor > 0 || v.parts == 2:
+			return []term{{">=", v}, {"<", bump(v, 1)}}, nil
+		default:
+			return []term{{">=", v}, {"<", bump(v, 2)}}, nil
+		}
+	case "~":
+		if v.parts == 1 {
+			return []term{{">=", v}, {"<", bump(v, 0)}}, nil
+		}
+		return []term{{">=", v}, {"<", bump(v, 1)}}, nil
+	case ">", "<=":
+		// A partial version covers every version it stands for, so ">1.2"
+		// means ">=1.3" and "<=1.2" means "<1.3".
+		if v.parts < 3 {
+			next := map[string]string{">": ">=", "<=": "<"}[op]
+			return []term{{next, bump(v, v.parts-1)}}, nil
+		}
+	}
+	return []term{{op, v}}, nil
+}
+
+// bump returns the lowest version after every version that agrees with v up
+// to component i, so bump(1.2.3, 1) is 1.3.0.
+func bump(v Version, i int) Version {
+	next := Version{parts: 3}
+	switch i {
+	case 0:
+		next.Major = v.Major + 1
+	case 1:
+		next.Major, next.Minor = v.Major, v.Minor+1
+	default:
+		next.Major, next.Minor, next.Patch = v.Major, v.Minor, v.Patch+1
+	}
+	// Stop below any prerelease of the next version.
+	next.Prerelease = "0"
+	return next
+}
+
+// String returns the constraint as written.
+func (c *Constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.text
+}
+
+// Any reports whether every release satisfies the constraint.
+func (c *Constraint) Any() bool {
+	return c == nil || (c.tag == "" && len(c.terms) == 0)
+}
+
+// Exact reports whether the constraint names a single release.
+func (c *Constraint) Exact() bool {
+	return c != nil && (c.tag != "" || (len(c.terms) == 1 && c.terms[0].op == "="))
+}
+
+// Matches reports whether a release tag satisfies the constraint.
+func (c *Constraint) Matches(tag string) bool {
+	if c.Any() {
+		return true
+	}
+	if c.tag != "" {
+		return tag == c.tag
+	}
+	v, err := ParseVersion(tag)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.terms {
+		d := v.Compare(t.v)
+		var ok bool
+		switch t.op {
+		case "=":
+			ok = d == 0
+		case ">":
+			ok = d > 0
+		case ">=":
+			ok = d >= 0
+		case "<":
+			ok = d < 0
+		case "<=":
+			ok = d <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the newest of tags that satisfies the constraint, or ""
+// if none does. Prereleases are only considered if prerelease is set, or if
+// the constraint names one exactly.
+func (c *Constraint) Select(tags []string, prerelease bool) string {
+	best := ""
+	for _, tag := range tags {
+		if !c.Matches(tag) {
+			continue
+		}
+		if v, err := ParseVersion(tag); err == nil && v.Prerelease != "" && !prerelease && !c.namesPrerelease() {
+			continue
+		}
+		if best == "" || CompareTags(tag, best) > 0 {
+			best = tag
+		}
+	}
+	return best
+}
+
+// namesPrerelease reports whether the constraint mentions a prerelease
+// version, as in "v2.0.0-rc.1" or ">=2.0.0-beta".
+func (c *Constraint) namesPrerelease() bool {
+	for _, t := range c.terms {
+		if t.v.Prerelease != "" && t.v.Prerelease != "0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lock records the exact release and downloads chosen for each tool in a
+// manifest, so that every machine installs the same bytes.
+type Lock struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Tools     []LockedTool `json:"tools"`
+}
+
+// LockedTool is a tool pinned to one release.
+type LockedTool struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Constraint is the manifest's version constraint when the tool was
+	// locked, so that a lockfile left behind by a manifest edit is noticed.
+	Constraint string `json:"constraint,omitempty"`
+	Version    string `json:"version"`
+	// Platforms maps "os/arch" to the asset locked for that platform.
+	Platforms map[string]LockedAsset `json:"platforms"`
+}
+
+// LockedAsset is the download locked for one platform.
+type LockedAsset struct {
+	Asset string `json:"asset"`
+	URL   string `json:"url"`
+	// ArchiveChecksum is the checksum of the downloaded asset.
+	ArchiveChecksum string `json:"archive_checksum"`
+	// BinaryChecksum is the checksum of the executable extracted from it.
+	BinaryChecksum string `json:"binary_checksum"`
+}
+
+// LockPath returns the lockfile path for a manifest: execman.lock.json for
+// execman.json.
+func LockPath(manifestPath string) string {
+	return strings.TrimSuffix(manifestPath, filepath.Ext(manifestPath)) + ".lock.json"
+}
+
+// LoadLock reads a lockfile. It returns nil if there is no file at path.
+func LoadLock(path string) (*Lock, error) {
+	// #nosec G304 -- Reading the lockfile beside a manifest the user chose
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var l Lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// Save writes the lockfile, with its tools sorted by name.
+func (l *Lock) Save(path string) error {
+	sort.Slice(l.Tools, func(i, j int) bool { return l.Tools[i].Name < l.Tools[j].Name })
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+	// #nosec G306 -- The lockfile is meant to be checked in and shared
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return nil
+}
+
+// Get returns the locked tool with the given name.
+func (l *Lock) Get(name string) (*LockedTool, bool) {
+	for i := range l.Tools {
+		if l.Tools[i].Name == name {
+			return &l.Tools[i], true
+		}
+	}
+	return nil, false
+}
+
+// Current reports whether the locked tool still matches a manifest entry:
+// the same source and constraint, with a version that satisfies it.
+func (lt *LockedTool) Current(tool *Tool) bool {
+	return lt.Source == tool.Source && lt.Constraint == tool.Version && tool.Constraint().Matches(lt.Version)
+}
+
+// Check reports an error if the lockfile does not cover every tool in the
+// manifest as it now stands.
+func (l *Lock) Check(m *Manifest) error {
+	var stale []string
+	for i := range m.Tools {
+		tool := &m.Tools[i]
+		locked, ok := l.Get(tool.Name)
+		if !ok || !locked.Current(tool) {
+			stale = append(stale, tool.Name)
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("the lockfile is out of date for %s; run 'execman lock'", strings.Join(stale, ", "))
+	}
+	return nil
+}
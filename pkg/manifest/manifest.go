@@ -0,0 +1,182 @@
+// Package manifest reads the manifest that declares the executables a
+// machine or team should have installed, for execman sync.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// DefaultPath is the manifest file read from the current directory when no
+// other is given.
+const DefaultPath = "execman.json"
+
+// Manifest lists the executables that should be installed.
+type Manifest struct {
+	Tools []Tool `json:"tools"`
+	// Keys holds publisher signing keys to pin for sources that have none
+	// pinned yet, keyed by source URL, as written by execman export.
+	Keys map[string]*registry.PinnedKey `json:"keys,omitempty"`
+
+	path string
+}
+
+// Tool is an executable listed in a manifest.
+type Tool struct {
+	// Source is the GitHub repository, such as "github.com/owner/repo".
+	Source string `json:"source"`
+	// Version constrains the release to install, such as "v1.2.3", "^1.2"
+	// or ">=1.4 <2". Any release satisfies an empty constraint.
+	Version string `json:"version,omitempty"`
+	// Name is the name to install the executable as, which defaults to the
+	// repository name.
+	Name string `json:"name,omitempty"`
+	// Location is the directory to install into, or @name for a configured
+	// location. It defaults to the default install directory.
+	Location string `json:"location,omitempty"`
+	// Prerelease allows prereleases to satisfy the version constraint.
+	Prerelease bool `json:"prerelease,omitempty"`
+	// ChecksumPolicy and SignaturePolicy override the configured policies
+	// for the tool, as install's --checksum-policy and --signature-policy do.
+	ChecksumPolicy  string `json:"checksum_policy,omitempty"`
+	SignaturePolicy string `json:"signature_policy,omitempty"`
+
+	constraint *Constraint
+}
+
+// Load reads and validates a manifest.
+func Load(path string) (*Manifest, error) {
+	// #nosec G304 -- Reading the manifest from a path the user chose
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	m.path = path
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Path returns the file the manifest was read from.
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// Validate checks the manifest's tools, parses their version constraints and
+// fills in default names. Two tools may not share a name.
+func (m *Manifest) Validate() error {
+	names := map[string]string{}
+	for i := range m.Tools {
+		tool := &m.Tools[i]
+		owner, repo, version, err := github.ParseSource(tool.Source)
+		if err != nil {
+			return err
+		}
+		if version != "" {
+			return fmt.Errorf("source %s: give the version in the version field", tool.Source)
+		}
+		tool.Source = github.ToURL(owner, repo)
+		if tool.Name == "" {
+			tool.Name = repo
+		}
+		if err := registry.ValidateName(tool.Name); err != nil {
+			return fmt.Errorf("source %s: %w", tool.Source, err)
+		}
+		if other, ok := names[tool.Name]; ok {
+			return fmt.Errorf("%s and %s are both named %q", other, tool.Source, tool.Name)
+		}
+		names[tool.Name] = tool.Source
+
+		tool.constraint, err = ParseConstraint(tool.Version)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", tool.Source, err)
+		}
+
+		if tool.ChecksumPolicy != "" {
+			if err := config.ValidatePolicy(tool.ChecksumPolicy); err != nil {
+				return fmt.Errorf("source %s: invalid checksum policy: %w", tool.Source, err)
+			}
+		}
+		if tool.SignaturePolicy != "" {
+			if err := config.ValidatePolicy(tool.SignaturePolicy); err != nil {
+				return fmt.Errorf("source %s: invalid signature policy: %w", tool.Source, err)
+			}
+		}
+	}
+
+	// Key the pinned keys by source URL, as the registry does.
+	keys := make(map[string]*registry.PinnedKey, len(m.Keys))
+	for source, key := range m.Keys {
+		owner, repo, _, err := github.ParseSource(source)
+		if err != nil {
+			return fmt.Errorf("keys: %w", err)
+		}
+		keys[github.ToURL(owner, repo)] = key
+	}
+	if len(keys) > 0 {
+		m.Keys = keys
+	}
+	return nil
+}
+
+// Write writes the manifest as indented JSON.
+func (m *Manifest) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Constraint returns the tool's parsed version constraint.
+func (t *Tool) Constraint() *Constraint {
+	if t.constraint == nil {
+		t.constraint, _ = ParseConstraint(t.Version)
+	}
+	return t.constraint
+}
+
+// Resolve picks the newest release of the tool that satisfies its version
+// constraint. Prereleases are only picked if includePrereleases is set or
+// the constraint names one exactly.
+func (t *Tool) Resolve(includePrereleases bool) (string, error) {
+	owner, repo, _, err := github.ParseSource(t.Source)
+	if err != nil {
+		return "", err
+	}
+	releases, err := github.ListReleases(owner, repo)
+	if err != nil {
+		return "", err
+	}
+	tags := make([]string, 0, len(releases))
+	for _, release := range releases {
+		if release.Prerelease && !includePrereleases && !t.Constraint().Exact() {
+			continue
+		}
+		tags = append(tags, release.TagName)
+	}
+	tag := t.Constraint().Select(tags, includePrereleases)
+	if tag == "" {
+		if t.Constraint().Any() {
+			return "", fmt.Errorf("no suitable release of %s/%s", owner, repo)
+		}
+		return "", fmt.Errorf("no release of %s/%s satisfies %q", owner, repo, t.Version)
+	}
+	return tag, nil
+}
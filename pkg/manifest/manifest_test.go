@@ -0,0 +1,182 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		tag        string
+		want       bool
+	}{
+		{"", "v0.1.0", true},
+		{"latest", "nightly", true},
+		{"v1.2.3", "1.2.3", true},
+		{"v1.2.3", "v1.2.4", false},
+		{"1.2", "v1.2.9", true},
+		{"1.2", "v1.3.0", false},
+		{"1.x", "v1.9.0", true},
+		{"1.2.*", "v1.2.0", true},
+		{"^1.2", "v1.9.9", true},
+		{"^1.2", "v2.0.0", false},
+		{"^1.2", "v1.1.0", false},
+		{"^0.4.1", "v0.4.9", true},
+		{"^0.4.1", "v0.5.0", false},
+		{"~1.2.3", "v1.2.9", true},
+		{"~1.2.3", "v1.3.0", false},
+		{">=1.4 <2", "v1.9.0", true},
+		{">=1.4, <2", "v2.0.0", false},
+		{">1.2", "v1.2.5", false},
+		{"<=1.2", "v1.2.5", true},
+		{"^1.2", "v2.0.0-rc.1", false},
+		{"nightly", "nightly", true},
+		{"nightly", "v1.0.0", false},
+		{">=1.0", "nightly", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.tag, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseConstraint() error: %v", err)
+			}
+			if got := c.Matches(tt.tag); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintSelect(t *testing.T) {
+	tags := []string{"v2.0.0-rc.1", "v1.10.0", "v1.9.2", "v1.2.0", "v0.9.0"}
+
+	tests := []struct {
+		constraint string
+		prerelease bool
+		want       string
+	}{
+		{"", false, "v1.10.0"},
+		{"", true, "v2.0.0-rc.1"},
+		{"^1.2", false, "v1.10.0"},
+		{"~1.9", false, "v1.9.2"},
+		{"<1", false, "v0.9.0"},
+		{"v2.0.0-rc.1", false, "v2.0.0-rc.1"},
+		{"^3", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseConstraint() error: %v", err)
+			}
+			if got := c.Select(tags, tt.prerelease); got != tt.want {
+				t.Errorf("Select() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-manifest-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name     string
+		content  string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "defaults", content: `{"tools": [{"source": "github.com/owner/tool"}]}`, wantName: "tool"},
+		{name: "named", content: `{"tools": [{"source": "github.com/cli/cli", "name": "gh", "version": "^2"}]}`, wantName: "gh"},
+		{name: "version in source", content: `{"tools": [{"source": "github.com/owner/tool@v1.0.0"}]}`, wantErr: true},
+		{name: "bad constraint", content: `{"tools": [{"source": "github.com/owner/tool", "version": ">=one"}]}`, wantErr: true},
+		{name: "duplicate name", content: `{"tools": [{"source": "github.com/alice/tool"}, {"source": "github.com/bob/tool"}]}`, wantErr: true},
+		{name: "bad name", content: `{"tools": [{"source": "github.com/owner/tool", "name": "../tool"}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "execman.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			m, err := Load(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if got := m.Tools[0].Name; got != tt.wantName {
+				t.Errorf("Name = %q, want %q", got, tt.wantName)
+			}
+			if !strings.HasPrefix(m.Tools[0].Source, "https://github.com/") {
+				t.Errorf("Source = %q, want a GitHub URL", m.Tools[0].Source)
+			}
+		})
+	}
+}
+
+func TestLockCheck(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-manifest-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifestPath := filepath.Join(tmpDir, "execman.json")
+	if got, want := LockPath(manifestPath), filepath.Join(tmpDir, "execman.lock.json"); got != want {
+		t.Errorf("LockPath() = %q, want %q", got, want)
+	}
+
+	m := &Manifest{Tools: []Tool{{Source: "github.com/owner/tool", Version: "^1.2"}}}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		locked  LockedTool
+		wantErr bool
+	}{
+		{name: "current", locked: LockedTool{Name: "tool", Source: "https://github.com/owner/tool", Constraint: "^1.2", Version: "v1.4.0"}},
+		{name: "other source", locked: LockedTool{Name: "tool", Source: "https://github.com/other/tool", Constraint: "^1.2", Version: "v1.4.0"}, wantErr: true},
+		{name: "constraint changed", locked: LockedTool{Name: "tool", Source: "https://github.com/owner/tool", Constraint: "^1.0", Version: "v1.4.0"}, wantErr: true},
+		{name: "not locked", locked: LockedTool{Name: "other", Source: "https://github.com/owner/tool", Constraint: "^1.2", Version: "v1.4.0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockPath := LockPath(manifestPath)
+			if err := (&Lock{Tools: []LockedTool{tt.locked}}).Save(lockPath); err != nil {
+				t.Fatalf("Save() error: %v", err)
+			}
+			lock, err := LoadLock(lockPath)
+			if err != nil {
+				t.Fatalf("LoadLock() error: %v", err)
+			}
+			err = lock.Check(m)
+			if tt.wantErr && err == nil {
+				t.Error("Check() expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Check() error: %v", err)
+			}
+		})
+	}
+
+	if lock, err := LoadLock(filepath.Join(tmpDir, "missing.lock.json")); lock != nil || err != nil {
+		t.Errorf("LoadLock() of a missing file = %v, %v; want nil, nil", lock, err)
+	}
+}
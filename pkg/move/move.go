@@ -0,0 +1,314 @@
+// Package move implements the move command, which moves managed executables
+// to another install directory without reinstalling them.
+package move
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/dircheck"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// Options represents the move command options.
+type Options struct {
+	Name string
+	// To is the directory to move to: a path, or "@name" for a configured
+	// location.
+	To string
+	// All moves every executable installed in From.
+	All  bool
+	From string
+	// SetDefault also makes To the default install directory.
+	SetDefault bool
+	Yes        bool
+}
+
+// NewMoveCommand creates the move command.
+func NewMoveCommand() *cobra.Command {
+	var opts Options
+
+	cmd := &cobra.Command{
+		Use:   "move <executable> <dir>",
+		Short: "Move managed executables to another directory",
+		Long: `Move an executable, with its aliases, to another directory, or move every
+executable installed in one directory with --all --from <dir> --to <dir>.
+Either directory may be given as @name for a configured location. The
+registry keeps each executable's history, such as when it was installed and
+its checksum, and records the new path and location.
+
+An executable installed as a symlink is moved as a symlink, still pointing at
+the same file. Companion files are kept in the data directory, not beside the
+executable, so they stay where they are.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.All {
+				if len(args) != 0 || opts.From == "" || opts.To == "" {
+					return fmt.Errorf("--all needs --from and --to, and no other arguments")
+				}
+				return nil
+			}
+			if opts.From != "" || opts.To != "" {
+				return fmt.Errorf("--from and --to can only be used with --all")
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if len(args) == 2 {
+				opts.Name = args[0]
+				opts.To = args[1]
+			}
+			return Run(opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Move every executable installed in the --from directory")
+	cmd.Flags().StringVar(&opts.From, "from", "", "Directory to move executables out of, with --all")
+	cmd.Flags().StringVar(&opts.To, "to", "", "Directory to move executables into")
+	cmd.Flags().BoolVar(&opts.SetDefault, "set-default", false, "Also make the new directory the default install directory")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+// Run executes the move command.
+func Run(opts Options) error {
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dir, location, err := cfg.ResolveInstallDir(opts.To)
+	if err != nil {
+		return err
+	}
+
+	// Find the executables to move.
+	var names []string
+	if opts.All {
+		from, _, err := cfg.ResolveInstallDir(opts.From)
+		if err != nil {
+			return err
+		}
+		all := reg.List()
+		sort.Strings(all)
+		for _, name := range all {
+			if exec, _ := reg.Get(name); filepath.Dir(exec.Path) == from {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Printf("No managed executables are installed in %s.\n", from)
+		}
+	} else {
+		exec, ok := reg.Get(opts.Name)
+		if !ok {
+			return fmt.Errorf("executable %q is not managed by execman", opts.Name)
+		}
+		if filepath.Dir(exec.Path) == dir {
+			fmt.Printf("%s is already in %s.\n", opts.Name, dir)
+		} else {
+			names = []string{opts.Name}
+		}
+	}
+
+	if len(names) > 0 {
+		// Show the moves and confirm.
+		if !opts.Yes {
+			fmt.Printf("Move to %s?\n\n", dir)
+			for _, name := range names {
+				exec, _ := reg.Get(name)
+				fmt.Printf("  %-16s %s\n", name, exec.Path)
+			}
+			if opts.SetDefault {
+				fmt.Printf("\nThe default install directory will become %s.\n", dir)
+			}
+			fmt.Println()
+			fmt.Print("Continue? [y/N]: ")
+
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.ToLower(strings.TrimSpace(response))
+
+			if response != "y" && response != "yes" {
+				fmt.Println("Move cancelled.")
+				return nil
+			}
+		}
+
+		// Check the directory before writing to it, as install does.
+		if err := dircheck.Preflight(filepath.Join(dir, names[0]), cfg.InstallDirCheck, func(issue dircheck.Issue) {
+			fmt.Printf("Warning: %s\n", issue)
+		}); err != nil {
+			return fmt.Errorf("refusing to move into %s: %w", dir, err)
+		}
+
+		failCount := 0
+		for _, name := range names {
+			if err := Relocate(reg, name, dir, location); err != nil {
+				fmt.Printf("Failed to move %s: %v\n", name, err)
+				failCount++
+				continue
+			}
+			// Save after each move, so that the registry matches the disk
+			// even if a later move fails.
+			if err := reg.Save(); err != nil {
+				return fmt.Errorf("failed to update registry: %w", err)
+			}
+			exec, _ := reg.Get(name)
+			fmt.Printf("Moved %s to %s\n", name, exec.Path)
+		}
+		if failCount > 0 {
+			return fmt.Errorf("%d of %d executables could not be moved", failCount, len(names))
+		}
+	}
+
+	if opts.SetDefault {
+		cfg.DefaultInstallDir = dir
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Printf("The default install directory is now %s.\n", dir)
+	}
+
+	return nil
+}
+
+// Relocate moves the executable called name, and its aliases, into dir and
+// records the new path and location in the registry, which is not saved.
+// Nothing is moved unless every path it needs in dir is free.
+func Relocate(reg *registry.Registry, name, dir, location string) error {
+	exec, ok := reg.Get(name)
+	if !ok {
+		return fmt.Errorf("executable %q is not managed by execman", name)
+	}
+
+	info, err := os.Lstat(exec.Path)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", exec.Path, err)
+	}
+	target := filepath.Join(dir, filepath.Base(exec.Path))
+
+	// Aliases still symlinked beside the executable move with it. Any other
+	// alias has been replaced by something else and is dropped.
+	var aliases, aliasTargets []string
+	for _, alias := range exec.Aliases {
+		if aliasInfo, err := os.Lstat(alias); err != nil || aliasInfo.Mode()&os.ModeSymlink == 0 {
+			fmt.Printf("Warning: %s is no longer a symlink, so it was left alone\n", alias)
+			continue
+		}
+		aliases = append(aliases, alias)
+		aliasTargets = append(aliasTargets, filepath.Join(dir, filepath.Base(alias)))
+	}
+
+	for _, path := range append([]string{target}, aliasTargets...) {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	// #nosec G301 -- Install directory needs 0755 for executables to be accessible
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		// Keep a symlink pointing at the same file from its new place.
+		link, err := os.Readlink(exec.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read symlink target: %w", err)
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(exec.Path), link)
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return fmt.Errorf("failed to create symlink: %w", err)
+		}
+		if err := os.Remove(exec.Path); err != nil {
+			_ = os.Remove(target)
+			return fmt.Errorf("failed to remove %s: %w", exec.Path, err)
+		}
+	} else if err := moveFile(exec.Path, target); err != nil {
+		return err
+	}
+
+	// Recreate the aliases beside the executable.
+	exec.Aliases = nil
+	for i, alias := range aliases {
+		if err := os.Remove(alias); err != nil {
+			fmt.Printf("Warning: failed to remove alias %s: %v\n", alias, err)
+		}
+		if err := os.Symlink(filepath.Base(target), aliasTargets[i]); err != nil {
+			fmt.Printf("Warning: failed to create alias %s: %v\n", aliasTargets[i], err)
+			continue
+		}
+		exec.Aliases = append(exec.Aliases, aliasTargets[i])
+	}
+
+	exec.Path = target
+	exec.Location = location
+	return nil
+}
+
+// moveFile moves a file, copying it when it cannot simply be renamed, as
+// between file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// Copy to a staging file beside the destination, then rename it into
+	// place, so that a partial copy is never left at dst.
+	stagingPath := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".execman-new")
+	if err := copyFile(src, stagingPath); err != nil {
+		_ = os.Remove(stagingPath)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := os.Rename(stagingPath, dst); err != nil {
+		_ = os.Remove(stagingPath)
+		return fmt.Errorf("failed to move %s: %w", src, err)
+	}
+	if err := os.Remove(src); err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to remove %s: %w", src, err)
+	}
+	return nil
+}
+
+// copyFile copies a file, keeping its permissions.
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	// #nosec G304 -- Copying a path recorded in the registry
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// #nosec G304 -- Writing a staging file in the install directory
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
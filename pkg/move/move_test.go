@@ -0,0 +1,107 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+func TestRelocate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-move-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldDir := filepath.Join(tmpDir, "old")
+	newDir := filepath.Join(tmpDir, "new")
+	if err := os.MkdirAll(oldDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldDir, "rg"), []byte("ripgrep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("rg", filepath.Join(oldDir, "ripgrep")); err != nil {
+		t.Fatal(err)
+	}
+	// A symlinked executable points at a file outside the install directory.
+	if err := os.WriteFile(filepath.Join(tmpDir, "real-fd"), []byte("fd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "real-fd"), filepath.Join(oldDir, "fd")); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	reg.Add("rg", &registry.Executable{
+		Source:      "https://github.com/BurntSushi/ripgrep",
+		Path:        filepath.Join(oldDir, "rg"),
+		Checksum:    "sha256:abc",
+		InstalledAt: installedAt,
+		Location:    "old",
+		Aliases:     []string{filepath.Join(oldDir, "ripgrep")},
+	})
+	reg.Add("fd", &registry.Executable{Source: "https://github.com/sharkdp/fd", Path: filepath.Join(oldDir, "fd")})
+
+	if err := Relocate(reg, "rg", newDir, "new"); err != nil {
+		t.Fatalf("Relocate() error: %v", err)
+	}
+
+	// The file moves, keeping its history, and the alias is relinked.
+	exec, _ := reg.Get("rg")
+	if exec.Path != filepath.Join(newDir, "rg") || exec.Location != "new" {
+		t.Errorf("moved executable = %+v, want it in %s at location new", exec, newDir)
+	}
+	if !exec.InstalledAt.Equal(installedAt) || exec.Checksum != "sha256:abc" {
+		t.Errorf("moved executable lost its history: %+v", exec)
+	}
+	if data, err := os.ReadFile(exec.Path); err != nil || string(data) != "ripgrep" {
+		t.Errorf("%s reads %q (%v), want the executable", exec.Path, data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(oldDir, "rg")); !os.IsNotExist(err) {
+		t.Errorf("the executable was left in %s", oldDir)
+	}
+	if len(exec.Aliases) != 1 || exec.Aliases[0] != filepath.Join(newDir, "ripgrep") {
+		t.Fatalf("aliases = %v, want ripgrep in %s", exec.Aliases, newDir)
+	}
+	if data, err := os.ReadFile(exec.Aliases[0]); err != nil || string(data) != "ripgrep" {
+		t.Errorf("alias reads %q (%v), want the executable", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(oldDir, "ripgrep")); !os.IsNotExist(err) {
+		t.Errorf("the alias was left in %s", oldDir)
+	}
+
+	// A symlink moves as a symlink to the same file.
+	if err := Relocate(reg, "fd", newDir, ""); err != nil {
+		t.Fatalf("Relocate() error: %v", err)
+	}
+	exec, _ = reg.Get("fd")
+	if data, err := os.ReadFile(exec.Path); err != nil || string(data) != "fd" {
+		t.Errorf("%s reads %q (%v), want the symlink's target", exec.Path, data, err)
+	}
+	if info, err := os.Lstat(exec.Path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s is no longer a symlink", exec.Path)
+	}
+
+	// Nothing is overwritten.
+	if err := os.WriteFile(filepath.Join(oldDir, "rg"), []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Relocate(reg, "rg", oldDir, "old"); err == nil {
+		t.Errorf("Relocate() moved over an existing file")
+	}
+	if data, _ := os.ReadFile(filepath.Join(newDir, "rg")); string(data) != "ripgrep" {
+		t.Errorf("a refused move changed the executable")
+	}
+}
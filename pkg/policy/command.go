@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// CheckResult is the JSON output of the policy check command.
+type CheckResult struct {
+	Name       string   `json:"name"`
+	Source     string   `json:"source"`
+	Version    string   `json:"version"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// NewPolicyCommand creates the policy command.
+func NewPolicyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Show and audit the install policy",
+		Long: `Show and audit the install policy. The policy is read from a system-wide
+file and a user file; installs and updates must satisfy both.`,
+	}
+
+	cmd.AddCommand(newShowCommand())
+	cmd.AddCommand(newCheckCommand())
+
+	return cmd
+}
+
+func newShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show the policy files in force",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := Load()
+			if err != nil {
+				return err
+			}
+			if len(p.Files) == 0 {
+				fmt.Println("No policy files are in force; every source is allowed.")
+				return nil
+			}
+			for _, f := range p.Files {
+				fmt.Printf("%s:\n", f.Path())
+				printList("Allow", f.Allow)
+				printList("Deny", f.Deny)
+				printList("Require signatures", f.RequireSignatures)
+				if f.ForbidPrereleases {
+					fmt.Println("  Prereleases are forbidden.")
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func printList(label string, patterns []string) {
+	if len(patterns) == 0 {
+		return
+	}
+	fmt.Printf("  %s:\n", label)
+	for _, pattern := range patterns {
+		fmt.Printf("    %s\n", pattern)
+	}
+}
+
+func newCheckCommand() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Audit installed executables against the policy",
+		Long: `Audit the executables in the registry against the policy. Violations give a
+non-zero exit code: 3 for a denied source, 4 for a missing signature and 5
+for a prerelease, the lowest applying when there are several.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return runCheck(jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+func runCheck(jsonOutput bool) error {
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+	p, err := Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	names := reg.List()
+	sort.Strings(names)
+
+	var all Violations
+	results := make([]CheckResult, 0, len(names))
+	for _, name := range names {
+		exec, _ := reg.Get(name)
+		result := CheckResult{Name: name, Source: exec.Source, Version: exec.Version}
+		for _, v := range p.Audit(exec) {
+			result.Violations = append(result.Violations, v.Reason)
+			all = append(all, v)
+		}
+		results = append(results, result)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			if len(result.Violations) == 0 {
+				fmt.Printf("  ok    %s %s\n", result.Name, result.Version)
+				continue
+			}
+			for _, reason := range result.Violations {
+				fmt.Printf("  FAIL  %s %s: %s\n", result.Name, result.Version, reason)
+			}
+		}
+		fmt.Printf("\n%d executables checked, %d policy violations.\n", len(results), len(all))
+	}
+
+	if len(all) > 0 {
+		return all
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package policy restricts which sources executables may be installed from.
+// Policies are read from a system-wide file, set by administrators, and a
+// user file; a source must satisfy both, so the user file can only tighten
+// the system policy.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+// Exit codes for policy violations. Other errors exit with code 1.
+const (
+	ExitDenied              = 3
+	ExitSignatureRequired   = 4
+	ExitPrereleaseForbidden = 5
+)
+
+// Rules that a source or release can violate.
+const (
+	RuleDenied              = "denied"
+	RuleSignatureRequired   = "signature-required"
+	RulePrereleaseForbidden = "prerelease-forbidden"
+)
+
+// Violation is an error reporting that a policy forbids an action.
+type Violation struct {
+	// Source is the URL of the offending source.
+	Source string
+	// Rule is the rule that was violated.
+	Rule string
+	// Reason explains the violation.
+	Reason string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// Error implements the error interface.
+func (v *Violation) Error() string {
+	if v.Err != nil {
+		return fmt.Sprintf("policy violation: %s: %v", v.Reason, v.Err)
+	}
+	return "policy violation: " + v.Reason
+}
+
+// Unwrap returns the underlying error.
+func (v *Violation) Unwrap() error {
+	return v.Err
+}
+
+// ExitCode returns the process exit code for the violation.
+func (v *Violation) ExitCode() int {
+	switch v.Rule {
+	case RuleSignatureRequired:
+		return ExitSignatureRequired
+	case RulePrereleaseForbidden:
+		return ExitPrereleaseForbidden
+	default:
+		return ExitDenied
+	}
+}
+
+// Violations is an error reporting several policy violations.
+type Violations []*Violation
+
+// Error implements the error interface.
+func (vs Violations) Error() string {
+	if len(vs) == 1 {
+		return vs[0].Error()
+	}
+	return fmt.Sprintf("%d policy violations", len(vs))
+}
+
+// ExitCode returns the exit code of the most serious violation: a denied
+// source, then a missing signature, then a prerelease.
+func (vs Violations) ExitCode() int {
+	code := 0
+	for _, v := range vs {
+		if c := v.ExitCode(); code == 0 || c < code {
+			code = c
+		}
+	}
+	return code
+}
+
+// File is one policy file.
+type File struct {
+	// Allow lists the sources that may be installed from. If empty, every
+	// source not denied is allowed.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists sources that may not be installed from.
+	Deny []string `json:"deny,omitempty"`
+	// RequireSignatures lists sources whose releases must carry a verified
+	// signature.
+	RequireSignatures []string `json:"require_signatures,omitempty"`
+	// ForbidPrereleases forbids installing prerelease versions.
+	ForbidPrereleases bool   `json:"forbid_prereleases,omitempty"`
+	path              string // internal, not serialized
+}
+
+// Policy is the combination of the policy files in force.
+type Policy struct {
+	Files []*File
+}
+
+// SystemPolicyPath returns the location of the system-wide policy file.
+func SystemPolicyPath() string {
+	configDir, _ := scope.ConfigDir(scope.System)
+	return filepath.Join(configDir, "policy.json")
+}
+
+// UserPolicyPath returns the location of the user's policy file.
+func UserPolicyPath() (string, error) {
+	configDir, err := scope.ConfigDir(scope.User)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "policy.json"), nil
+}
+
+// Load loads the policy files that apply to the current scope: the
+// system-wide file, and the user's file unless managing the system scope.
+func Load() (*Policy, error) {
+	if scope.Current() == scope.System {
+		return LoadFrom(SystemPolicyPath())
+	}
+	userPath, err := UserPolicyPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFrom(SystemPolicyPath(), userPath)
+}
+
+// LoadFrom loads the policy files at the given paths. Missing files impose
+// no restrictions, but a file that cannot be read or parsed is an error, so
+// that a broken policy does not silently allow everything.
+func LoadFrom(paths ...string) (*Policy, error) {
+	p := &Policy{}
+	for _, policyPath := range paths {
+		// #nosec G304 -- Reading policy from trusted path
+		data, err := os.ReadFile(policyPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy %s: %w", policyPath, err)
+		}
+
+		f := &File{path: policyPath}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, fmt.Errorf("failed to parse policy %s: %w", policyPath, err)
+		}
+		for _, pattern := range append(append(append([]string{}, f.Allow...), f.Deny...), f.RequireSignatures...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q in policy %s: %w", pattern, policyPath, err)
+			}
+		}
+		p.Files = append(p.Files, f)
+	}
+	return p, nil
+}
+
+// Path returns the file the policy was loaded from.
+func (f *File) Path() string {
+	return f.path
+}
+
+// CheckSource returns a *Violation if the source may not be installed from.
+func (p *Policy) CheckSource(source string) error {
+	key := sourceKey(source)
+	for _, f := range p.Files {
+		if pattern := firstMatch(f.Deny, key); pattern != "" {
+			return &Violation{
+				Source: source,
+				Rule:   RuleDenied,
+				Reason: fmt.Sprintf("%s is denied by %q in %s", key, pattern, f.path),
+			}
+		}
+		if len(f.Allow) > 0 && firstMatch(f.Allow, key) == "" {
+			return &Violation{
+				Source: source,
+				Rule:   RuleDenied,
+				Reason: fmt.Sprintf("%s is not allowed by %s", key, f.path),
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRelease returns a *Violation if the release may not be installed.
+func (p *Policy) CheckRelease(source, version string, prerelease bool) error {
+	if !prerelease {
+		return nil
+	}
+	for _, f := range p.Files {
+		if f.ForbidPrereleases {
+			return &Violation{
+				Source: source,
+				Rule:   RulePrereleaseForbidden,
+				Reason: fmt.Sprintf("%s is a prerelease and prereleases are forbidden by %s", version, f.path),
+			}
+		}
+	}
+	return nil
+}
+
+// ForbidsPrereleases reports whether any policy file forbids prereleases.
+func (p *Policy) ForbidsPrereleases() bool {
+	for _, f := range p.Files {
+		if f.ForbidPrereleases {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresSignature reports whether releases of the source must carry a
+// verified signature.
+func (p *Policy) RequiresSignature(source string) bool {
+	key := sourceKey(source)
+	for _, f := range p.Files {
+		if firstMatch(f.RequireSignatures, key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureViolation wraps an error from a download whose required signature
+// could not be verified.
+func SignatureViolation(source string, err error) *Violation {
+	return &Violation{
+		Source: source,
+		Rule:   RuleSignatureRequired,
+		Reason: fmt.Sprintf("releases of %s must be signed", sourceKey(source)),
+		Err:    err,
+	}
+}
+
+// sourceKey reduces a source URL such as "https://github.com/Owner/Repo" to
+// the form patterns match against: "github.com/owner/repo".
+func sourceKey(source string) string {
+	key := strings.TrimPrefix(source, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	if i := strings.Index(key, "@"); i >= 0 {
+		key = key[:i]
+	}
+	return strings.ToLower(strings.TrimSuffix(key, "/"))
+}
+
+// firstMatch returns the first pattern matching the source key, or "".
+// Patterns are globs matched a path segment at a time; a pattern with fewer
+// segments than the key matches everything beneath it, so "github.com/acme"
+// matches every repository of acme.
+func firstMatch(patterns []string, key string) string {
+	keySegments := strings.Split(key, "/")
+	for _, pattern := range patterns {
+		patternSegments := strings.Split(strings.ToLower(strings.TrimSuffix(pattern, "/")), "/")
+		if len(patternSegments) > len(keySegments) {
+			continue
+		}
+		matched := true
+		for i, segment := range patternSegments {
+			if ok, _ := path.Match(segment, keySegments[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Audit returns the policy violations of an installed executable.
+func (p *Policy) Audit(exec *registry.Executable) []*Violation {
+	var violations []*Violation
+	if err := p.CheckSource(exec.Source); err != nil {
+		violations = append(violations, err.(*Violation))
+	}
+	if err := p.CheckRelease(exec.Source, exec.Version, exec.Prerelease || isPrereleaseVersion(exec.Version)); err != nil {
+		violations = append(violations, err.(*Violation))
+	}
+	if p.RequiresSignature(exec.Source) && exec.Signature == nil {
+		violations = append(violations, &Violation{
+			Source: exec.Source,
+			Rule:   RuleSignatureRequired,
+			Reason: fmt.Sprintf("releases of %s must be signed, but %s was installed unverified", sourceKey(exec.Source), exec.Version),
+		})
+	}
+	return violations
+}
+
+// isPrereleaseVersion reports whether a version tag looks like a semantic
+// version prerelease, such as "v1.2.0-rc.1". It covers registry entries
+// recorded before prereleases were flagged.
+func isPrereleaseVersion(version string) bool {
+	core, _, found := strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	return found && core != "" && strings.Count(core, ".") >= 1
+}
@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// writePolicy writes a policy file into dir and returns its path.
+func writePolicy(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	policyPath := filepath.Join(dir, name)
+	if err := os.WriteFile(policyPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return policyPath
+}
+
+func TestCheckSource(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-policy-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	system := writePolicy(t, tmpDir, "system.json", `{
+  "allow": ["github.com/acme", "github.com/sfkleach/*", "github.com/*/tool-*"],
+  "deny": ["github.com/acme/legacy"]
+}`)
+	user := writePolicy(t, tmpDir, "user.json", `{"deny": ["github.com/sfkleach/nutmeg"]}`)
+
+	p, err := LoadFrom(system, user, filepath.Join(tmpDir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadFrom() error: %v", err)
+	}
+	if len(p.Files) != 2 {
+		t.Fatalf("LoadFrom() loaded %d files, want 2", len(p.Files))
+	}
+
+	tests := []struct {
+		source  string
+		allowed bool
+	}{
+		{"https://github.com/acme/widget", true},
+		{"https://github.com/ACME/Widget", true},
+		{"https://github.com/acme/legacy", false},
+		{"https://github.com/sfkleach/execman", true},
+		{"https://github.com/sfkleach/nutmeg", false},
+		{"https://github.com/someone/tool-box", true},
+		{"https://github.com/someone/toolbox", false},
+		{"https://gitlab.com/acme/widget", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			err := p.CheckSource(tt.source)
+			if tt.allowed {
+				if err != nil {
+					t.Errorf("CheckSource() unexpected error: %v", err)
+				}
+				return
+			}
+			var violation *Violation
+			if !errors.As(err, &violation) {
+				t.Fatalf("CheckSource() error = %v, want a violation", err)
+			}
+			if violation.ExitCode() != ExitDenied {
+				t.Errorf("ExitCode() = %d, want %d", violation.ExitCode(), ExitDenied)
+			}
+		})
+	}
+}
+
+func TestLoadFromInvalid(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-policy-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed JSON", `{"deny": [`},
+		{"bad pattern", `{"deny": ["github.com/[acme"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyPath := writePolicy(t, tmpDir, "policy.json", tt.content)
+			if _, err := LoadFrom(policyPath); err == nil {
+				t.Error("LoadFrom() expected an error")
+			}
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-policy-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	policyPath := writePolicy(t, tmpDir, "policy.json", `{
+  "deny": ["github.com/evil"],
+  "require_signatures": ["github.com/acme"],
+  "forbid_prereleases": true
+}`)
+	p, err := LoadFrom(policyPath)
+	if err != nil {
+		t.Fatalf("LoadFrom() error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		exec      *registry.Executable
+		wantRules []string
+		wantCode  int
+	}{
+		{
+			name: "compliant",
+			exec: &registry.Executable{Source: "https://github.com/other/tool", Version: "v1.0.0"},
+		},
+		{
+			name:      "denied and prerelease",
+			exec:      &registry.Executable{Source: "https://github.com/evil/tool", Version: "v1.0.0-rc.1"},
+			wantRules: []string{RuleDenied, RulePrereleaseForbidden},
+			wantCode:  ExitDenied,
+		},
+		{
+			name:      "flagged prerelease",
+			exec:      &registry.Executable{Source: "https://github.com/other/tool", Version: "nightly", Prerelease: true},
+			wantRules: []string{RulePrereleaseForbidden},
+			wantCode:  ExitPrereleaseForbidden,
+		},
+		{
+			name:      "unsigned",
+			exec:      &registry.Executable{Source: "https://github.com/acme/tool", Version: "v2.0.0"},
+			wantRules: []string{RuleSignatureRequired},
+			wantCode:  ExitSignatureRequired,
+		},
+		{
+			name: "signed",
+			exec: &registry.Executable{
+				Source:    "https://github.com/acme/tool",
+				Version:   "v2.0.0",
+				Signature: &registry.Signature{Method: "minisign"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := p.Audit(tt.exec)
+			if len(violations) != len(tt.wantRules) {
+				t.Fatalf("Audit() returned %d violations, want %d", len(violations), len(tt.wantRules))
+			}
+			for i, v := range violations {
+				if v.Rule != tt.wantRules[i] {
+					t.Errorf("violation %d rule = %q, want %q", i, v.Rule, tt.wantRules[i])
+				}
+			}
+			if len(violations) > 0 {
+				if code := Violations(violations).ExitCode(); code != tt.wantCode {
+					t.Errorf("ExitCode() = %d, want %d", code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureViolation(t *testing.T) {
+	cause := errors.New("no signature")
+	err := error(SignatureViolation("https://github.com/acme/tool", cause))
+	if !errors.Is(err, cause) {
+		t.Error("SignatureViolation() does not wrap its cause")
+	}
+	var violation *Violation
+	if !errors.As(err, &violation) || violation.ExitCode() != ExitSignatureRequired {
+		t.Errorf("SignatureViolation() exit code is not %d", ExitSignatureRequired)
+	}
+}
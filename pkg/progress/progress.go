@@ -0,0 +1,101 @@
+// Package progress renders a simple progress bar for long-running downloads.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// barWidth is the number of characters inside the brackets of the bar.
+const barWidth = 30
+
+// refreshInterval limits how often the bar is redrawn.
+const refreshInterval = 100 * time.Millisecond
+
+// Bar is a single-line progress bar. A nil *Bar is valid and draws nothing,
+// which lets callers use it unconditionally when output is not a terminal.
+type Bar struct {
+	w        io.Writer
+	lastDraw time.Time
+	drawn    bool
+}
+
+// IsTerminal reports whether f is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewBar returns a progress bar that draws to w.
+func NewBar(w io.Writer) *Bar {
+	return &Bar{w: w}
+}
+
+// NewTerminalBar returns a progress bar that draws to w, or nil if w is not
+// a terminal.
+func NewTerminalBar(w io.Writer) *Bar {
+	f, ok := w.(*os.File)
+	if !ok || !IsTerminal(f) {
+		return nil
+	}
+	return NewBar(f)
+}
+
+// Update redraws the bar to show done out of total bytes. A total that is
+// zero or negative means the size is unknown.
+func (b *Bar) Update(done, total int64) {
+	if b == nil {
+		return
+	}
+	now := time.Now()
+	finished := total > 0 && done >= total
+	if !finished && now.Sub(b.lastDraw) < refreshInterval {
+		return
+	}
+	b.lastDraw = now
+	b.drawn = true
+
+	if total <= 0 {
+		fmt.Fprintf(b.w, "\r  %s", FormatBytes(done))
+		return
+	}
+
+	if done > total {
+		done = total
+	}
+	filled := int(done * barWidth / total)
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	fmt.Fprintf(b.w, "\r  [%s] %3d%% %s / %s", bar, done*100/total, FormatBytes(done), FormatBytes(total))
+}
+
+// Finish ends the progress line so that subsequent output starts afresh.
+func (b *Bar) Finish() {
+	if b == nil || !b.drawn {
+		return
+	}
+	fmt.Fprintln(b.w)
+	b.drawn = false
+}
+
+// FormatBytes formats a byte count using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,428 @@
+// Package provenance verifies the SLSA build provenance that projects publish
+// for their release assets, either as in-toto attestations attached to the
+// release or as GitHub artifact attestations.
+package provenance
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/signature"
+)
+
+// ErrNoProvenance is returned when no attestation covers an asset.
+var ErrNoProvenance = errors.New("no provenance attestation covers the asset")
+
+// ErrUntrusted is returned when an attestation covers an asset but does not
+// verify, or does not show that the asset was built from its source.
+var ErrUntrusted = errors.New("provenance verification failed")
+
+// Predicate types of SLSA provenance.
+const (
+	PredicateSLSAv02 = "https://slsa.dev/provenance/v0.2"
+	PredicateSLSAv1  = "https://slsa.dev/provenance/v1"
+)
+
+// githubIssuer is the OIDC issuer of GitHub Actions workflows.
+const githubIssuer = "https://token.actions.githubusercontent.com"
+
+// inTotoPayloadType is the DSSE payload type of in-toto statements.
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// oidSourceRepositoryURI is the Fulcio certificate extension that records
+// the repository a GitHub Actions workflow ran in.
+var oidSourceRepositoryURI = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+
+// DefaultBuilders are the workflows trusted to sign provenance for any
+// source, in addition to the source's own workflows. Each entry is a prefix
+// of the signing workflow's identity.
+var DefaultBuilders = []string{
+	"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/",
+}
+
+// Result describes verified provenance.
+type Result struct {
+	PredicateType string
+	// Builder is the builder named in the provenance.
+	Builder string
+	// Signer is the identity of the workflow that signed the provenance.
+	Signer string
+	// SourceRepo is the repository the asset was built from.
+	SourceRepo string
+}
+
+// envelope is a signed DSSE envelope.
+type envelope struct {
+	payloadType string
+	payload     []byte
+	sig         []byte
+	cert        *x509.Certificate
+	// tlog is the transparency log entry recording the signature.
+	tlog *signature.LogEntry
+}
+
+// statement is the part of an in-toto statement that is checked.
+type statement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+	Predicate     struct {
+		// SLSA v0.2.
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+
+		// SLSA v1.
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+			ResolvedDependencies []struct {
+				URI string `json:"uri"`
+			} `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// SplitDocuments splits the contents of an attestation file, such as an
+// ".intoto.jsonl" file, into its JSON documents.
+func SplitDocuments(data []byte) ([][]byte, error) {
+	var docs [][]byte
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc json.RawMessage
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse attestation: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// Verify checks that one of the attestations is SLSA provenance for the asset
+// with the given SHA256 digest (in hex), signed by a trusted builder with a
+// Sigstore certificate that chains to the roots, and built from source, a
+// URL such as "https://github.com/owner/repo". Each attestation is a Sigstore
+// bundle, whose transparency log entry must verify with rekorKey.
+func Verify(attestations [][]byte, digest, source string, roots []*x509.Certificate, rekorKey crypto.PublicKey, builders []string) (*Result, error) {
+	var problems []string
+	for _, doc := range attestations {
+		env, err := parseEnvelope(doc)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if env.payloadType != inTotoPayloadType {
+			continue
+		}
+
+		var st statement
+		if err := json.Unmarshal(env.payload, &st); err != nil {
+			problems = append(problems, fmt.Sprintf("malformed in-toto statement: %v", err))
+			continue
+		}
+		if !covers(&st, digest) {
+			continue
+		}
+		if st.PredicateType != PredicateSLSAv02 && st.PredicateType != PredicateSLSAv1 {
+			problems = append(problems, fmt.Sprintf("unsupported predicate type %s", st.PredicateType))
+			continue
+		}
+
+		// Attestations that were not logged, such as bare envelopes, cannot
+		// be verified, so other attestations are tried.
+		if env.tlog == nil {
+			problems = append(problems, "attestation has no transparency log entry")
+			continue
+		}
+
+		// An attestation that names the asset must verify.
+		return verifyStatement(env, &st, source, roots, rekorKey, builders)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w (%s)", ErrNoProvenance, strings.Join(problems, "; "))
+	}
+	return nil, ErrNoProvenance
+}
+
+// verifyStatement verifies the signature of a provenance statement and checks
+// who built the asset, and from what.
+func verifyStatement(env *envelope, st *statement, source string, roots []*x509.Certificate, rekorKey crypto.PublicKey, builders []string) (*Result, error) {
+	if env.cert == nil {
+		return nil, fmt.Errorf("%w: attestation has no signing certificate", ErrUntrusted)
+	}
+
+	// Signing certificates are only valid for a few minutes, so the chain is
+	// checked at the time the transparency log recorded the attestation.
+	body, signedAt, err := signature.VerifyLogEntry(env.tlog, rekorKey, env.cert)
+	if err == nil {
+		err = matchLogEntry(body, env)
+	}
+	if err == nil {
+		var signer, issuer string
+		signer, issuer, err = signature.VerifyKeylessMessage(pae(env.payloadType, env.payload), env.sig, env.cert, roots, signedAt)
+		if err == nil {
+			return checkStatement(env, st, source, signer, issuer, builders)
+		}
+	}
+	if errors.Is(err, signature.ErrUntrusted) {
+		return nil, fmt.Errorf("%w: %v", ErrUntrusted, err)
+	}
+	return nil, err
+}
+
+// checkStatement checks that a provenance statement signed by the given
+// workflow shows the asset was built from source by a trusted builder.
+func checkStatement(env *envelope, st *statement, source, signer, issuer string, builders []string) (*Result, error) {
+	if issuer != githubIssuer {
+		return nil, fmt.Errorf("%w: attestation was signed by %s, not by GitHub Actions", ErrUntrusted, issuer)
+	}
+	if !trustedBuilder(signer, source, builders) {
+		return nil, fmt.Errorf("%w: attestation was signed by untrusted workflow %s", ErrUntrusted, signer)
+	}
+
+	result := &Result{PredicateType: st.PredicateType, Signer: signer}
+	if st.PredicateType == PredicateSLSAv02 {
+		result.Builder = st.Predicate.Builder.ID
+		result.SourceRepo = st.Predicate.Invocation.ConfigSource.URI
+	} else {
+		result.Builder = st.Predicate.RunDetails.Builder.ID
+		result.SourceRepo = st.Predicate.BuildDefinition.ExternalParameters.Workflow.Repository
+		if result.SourceRepo == "" && len(st.Predicate.BuildDefinition.ResolvedDependencies) > 0 {
+			result.SourceRepo = st.Predicate.BuildDefinition.ResolvedDependencies[0].URI
+		}
+	}
+	if result.SourceRepo == "" {
+		return nil, fmt.Errorf("%w: provenance does not name a source repository", ErrUntrusted)
+	}
+	if normalizeRepo(result.SourceRepo) != normalizeRepo(source) {
+		return nil, fmt.Errorf("%w: asset was built from %s, not %s", ErrUntrusted, result.SourceRepo, source)
+	}
+
+	// The certificate also records the repository the signing workflow ran
+	// in, which must agree with the provenance.
+	if repo := signature.CertificateExtension(env.cert, oidSourceRepositoryURI); repo != "" && normalizeRepo(repo) != normalizeRepo(source) {
+		return nil, fmt.Errorf("%w: attestation was signed in %s, not %s", ErrUntrusted, repo, source)
+	}
+
+	return result, nil
+}
+
+// matchLogEntry checks that a transparency log entry, of the "dsse" or
+// "intoto" kind, records the envelope's payload signed with its certificate.
+func matchLogEntry(body []byte, env *envelope) error {
+	type hash struct {
+		Value string `json:"value"`
+	}
+	var record struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			// The "dsse" kind.
+			PayloadHash hash `json:"payloadHash"`
+			Signatures  []struct {
+				Verifier []byte `json:"verifier"`
+			} `json:"signatures"`
+
+			// The "intoto" kind.
+			Content struct {
+				PayloadHash hash `json:"payloadHash"`
+				Envelope    struct {
+					Signatures []struct {
+						PublicKey []byte `json:"publicKey"`
+					} `json:"signatures"`
+				} `json:"envelope"`
+			} `json:"content"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return fmt.Errorf("%w: malformed transparency log entry: %v", signature.ErrUntrusted, err)
+	}
+
+	var payloadHash string
+	var verifiers [][]byte
+	switch record.Kind {
+	case "dsse":
+		payloadHash = record.Spec.PayloadHash.Value
+		for _, s := range record.Spec.Signatures {
+			verifiers = append(verifiers, s.Verifier)
+		}
+	case "intoto":
+		payloadHash = record.Spec.Content.PayloadHash.Value
+		for _, s := range record.Spec.Content.Envelope.Signatures {
+			verifiers = append(verifiers, s.PublicKey)
+		}
+	default:
+		return fmt.Errorf("%w: unexpected transparency log entry kind %q", signature.ErrUntrusted, record.Kind)
+	}
+
+	sum := sha256.Sum256(env.payload)
+	if !strings.EqualFold(payloadHash, hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("%w: the transparency log entry is for a different attestation", signature.ErrUntrusted)
+	}
+	for _, verifier := range verifiers {
+		if cert, err := signature.ParseCertificate(verifier); err == nil && cert.Equal(env.cert) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the transparency log entry is for a different signer", signature.ErrUntrusted)
+}
+
+// covers reports whether a statement's subjects include the digest.
+func covers(st *statement, digest string) bool {
+	for _, subject := range st.Subject {
+		if strings.EqualFold(subject.Digest["sha256"], digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedBuilder reports whether a signing workflow may vouch for a source's
+// builds: it is one of the source's own workflows or a trusted builder.
+func trustedBuilder(signer, source string, builders []string) bool {
+	own := strings.TrimSuffix(source, "/") + "/.github/workflows/"
+	if strings.HasPrefix(strings.ToLower(signer), strings.ToLower(own)) {
+		return true
+	}
+	for _, builder := range builders {
+		if strings.HasPrefix(signer, builder) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRepo reduces a repository reference such as
+// "git+https://github.com/Owner/Repo@refs/tags/v1" to "github.com/owner/repo".
+func normalizeRepo(repo string) string {
+	repo = strings.TrimPrefix(repo, "git+")
+	repo = strings.TrimPrefix(repo, "https://")
+	repo = strings.TrimPrefix(repo, "http://")
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	repo = strings.TrimSuffix(repo, "/")
+	repo = strings.TrimSuffix(repo, ".git")
+	return strings.ToLower(repo)
+}
+
+// pae returns the DSSE pre-authentication encoding that is signed.
+func pae(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
+
+// parseEnvelope decodes a Sigstore bundle holding a DSSE envelope, or a bare
+// DSSE envelope whose signature carries its certificate. Only bundles carry
+// the transparency log entry that verification requires.
+func parseEnvelope(doc []byte) (*envelope, error) {
+	type dsse struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []struct {
+			Sig  string `json:"sig"`
+			Cert string `json:"cert"`
+		} `json:"signatures"`
+	}
+	var bundle struct {
+		MediaType            string `json:"mediaType"`
+		VerificationMaterial struct {
+			Certificate *struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificate"`
+			X509CertificateChain *struct {
+				Certificates []struct {
+					RawBytes []byte `json:"rawBytes"`
+				} `json:"certificates"`
+			} `json:"x509CertificateChain"`
+			TlogEntries []signature.BundleLogEntry `json:"tlogEntries"`
+		} `json:"verificationMaterial"`
+		DSSEEnvelope *dsse `json:"dsseEnvelope"`
+		dsse
+	}
+	if err := json.Unmarshal(doc, &bundle); err != nil {
+		return nil, fmt.Errorf("malformed attestation: %w", err)
+	}
+
+	d := &bundle.dsse
+	if bundle.MediaType != "" {
+		if bundle.DSSEEnvelope == nil {
+			return nil, errors.New("bundle does not contain an attestation")
+		}
+		d = bundle.DSSEEnvelope
+	}
+	if len(d.Signatures) == 0 {
+		return nil, errors.New("attestation is not signed")
+	}
+
+	payload, err := decodeBase64(d.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed attestation payload: %w", err)
+	}
+	sig, err := decodeBase64(d.Signatures[0].Sig)
+	if err != nil {
+		return nil, fmt.Errorf("malformed attestation signature: %w", err)
+	}
+	env := &envelope{payloadType: d.PayloadType, payload: payload, sig: sig}
+
+	vm := bundle.VerificationMaterial
+	if len(vm.TlogEntries) > 0 {
+		env.tlog, err = vm.TlogEntries[0].Entry()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var raw []byte
+	switch {
+	case vm.Certificate != nil:
+		raw = vm.Certificate.RawBytes
+	case vm.X509CertificateChain != nil && len(vm.X509CertificateChain.Certificates) > 0:
+		raw = vm.X509CertificateChain.Certificates[0].RawBytes
+	}
+	switch {
+	case raw != nil:
+		env.cert, err = x509.ParseCertificate(raw)
+	case d.Signatures[0].Cert != "":
+		env.cert, err = signature.ParseCertificate([]byte(d.Signatures[0].Cert))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation certificate: %w", err)
+	}
+	return env, nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64, which DSSE both allows.
+func decodeBase64(s string) ([]byte, error) {
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
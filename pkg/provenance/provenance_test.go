@@ -0,0 +1,342 @@
+package provenance
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSource = "https://github.com/owner/tool"
+
+// signer is a Fulcio-like root, a workflow signing certificate and a
+// transparency log.
+type signer struct {
+	root     *x509.Certificate
+	leaf     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newSigner(t *testing.T, identity, repo string) *signer {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio-root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := url.Parse(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, _ := asn1.Marshal("https://token.actions.githubusercontent.com")
+	repoValue, _ := asn1.Marshal(repo)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{uri},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: issuer},
+			{Id: oidSourceRepositoryURI, Value: repoValue},
+		},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signer{root: root, leaf: leaf, key: key, rekorKey: rekorKey}
+}
+
+// statementV1 returns SLSA v1 provenance, as actions/attest-build-provenance
+// produces, for an artifact built from repo.
+func statementV1(t *testing.T, digest, repo string) []byte {
+	t.Helper()
+	st, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []any{map[string]any{"name": "tool_linux_amd64.tar.gz", "digest": map[string]string{"sha256": digest}}},
+		"predicateType": PredicateSLSAv1,
+		"predicate": map[string]any{
+			"buildDefinition": map[string]any{
+				"externalParameters": map[string]any{"workflow": map[string]any{"repository": repo, "path": ".github/workflows/release.yml"}},
+			},
+			"runDetails": map[string]any{"builder": map[string]any{"id": "https://github.com/actions/runner/github-hosted"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// statementV02 returns SLSA v0.2 provenance, as the SLSA generator produces.
+func statementV02(t *testing.T, digest, repo string) []byte {
+	t.Helper()
+	st, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"subject":       []any{map[string]any{"name": "tool_linux_amd64.tar.gz", "digest": map[string]string{"sha256": digest}}},
+		"predicateType": PredicateSLSAv02,
+		"predicate": map[string]any{
+			"builder":    map[string]any{"id": "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"},
+			"invocation": map[string]any{"configSource": map[string]any{"uri": "git+" + repo + "@refs/tags/v1.0.0"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func (s *signer) sign(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	sum := sha256.Sum256(pae(inTotoPayloadType, payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// logEntry returns a Sigstore bundle's record of a "dsse" transparency log
+// entry for a signed statement.
+func (s *signer) logEntry(t *testing.T, payload []byte) map[string]any {
+	t.Helper()
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]any{
+			"payloadHash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			"signatures": []any{map[string]any{
+				"verifier": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf.Raw}),
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	integratedTime := time.Now().Unix()
+	canonical, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(body), integratedTime, "abcd", 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(canonical)
+	set, err := ecdsa.SignASN1(rand.Reader, s.rekorKey, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]any{
+		"logIndex":          "42",
+		"logId":             map[string]any{"keyId": []byte{0xab, 0xcd}},
+		"integratedTime":    strconv.FormatInt(integratedTime, 10),
+		"inclusionPromise":  map[string]any{"signedEntryTimestamp": set},
+		"canonicalizedBody": base64.StdEncoding.EncodeToString(body),
+	}
+}
+
+// bundle wraps a statement in a Sigstore bundle, whose transparency log
+// entry records logged.
+func (s *signer) bundle(t *testing.T, payload, sig, logged []byte) []byte {
+	t.Helper()
+	doc, err := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": s.leaf.Raw},
+			"tlogEntries": []any{s.logEntry(t, logged)},
+		},
+		"dsseEnvelope": map[string]any{
+			"payload":     base64.StdEncoding.EncodeToString(payload),
+			"payloadType": inTotoPayloadType,
+			"signatures":  []any{map[string]any{"sig": base64.StdEncoding.EncodeToString(sig)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// envelope wraps a statement in a DSSE envelope carrying its certificate, as
+// found in ".intoto.jsonl" files.
+func (s *signer) envelope(t *testing.T, payload, sig []byte) []byte {
+	t.Helper()
+	doc, err := json.Marshal(map[string]any{
+		"payloadType": inTotoPayloadType,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures": []any{map[string]any{
+			"sig":  base64.StdEncoding.EncodeToString(sig),
+			"cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf.Raw})),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestVerify(t *testing.T) {
+	sum := sha256.Sum256([]byte("archive"))
+	digest := hex.EncodeToString(sum[:])
+	otherSum := sha256.Sum256([]byte("other archive"))
+	otherDigest := hex.EncodeToString(otherSum[:])
+
+	own := newSigner(t, testSource+"/.github/workflows/release.yml@refs/tags/v1.0.0", testSource)
+	generator := newSigner(t, "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0", testSource)
+	fork := newSigner(t, "https://github.com/attacker/tool/.github/workflows/release.yml@refs/tags/v1.0.0", "https://github.com/attacker/tool")
+
+	v1 := statementV1(t, digest, testSource)
+	v02 := statementV02(t, digest, testSource)
+	forked := statementV1(t, digest, "https://github.com/attacker/tool")
+	other := statementV1(t, otherDigest, testSource)
+
+	jsonl := func(docs ...[]byte) []byte {
+		var lines []string
+		for _, d := range docs {
+			lines = append(lines, string(d))
+		}
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	tests := []struct {
+		name        string
+		file        []byte
+		signer      *signer
+		wantErr     error
+		wantBuilder string
+	}{
+		{
+			name:        "attestation bundle",
+			file:        own.bundle(t, v1, own.sign(t, v1), v1),
+			signer:      own,
+			wantBuilder: "https://github.com/actions/runner/github-hosted",
+		},
+		{
+			name:        "SLSA generator bundles",
+			file:        jsonl(generator.bundle(t, other, generator.sign(t, other), other), generator.bundle(t, v02, generator.sign(t, v02), v02)),
+			signer:      generator,
+			wantBuilder: "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0",
+		},
+		{
+			name:    "envelopes without a transparency log entry",
+			file:    jsonl(generator.envelope(t, v02, generator.sign(t, v02))),
+			signer:  generator,
+			wantErr: ErrNoProvenance,
+		},
+		{
+			name:    "asset not covered",
+			file:    own.bundle(t, other, own.sign(t, other), other),
+			signer:  own,
+			wantErr: ErrNoProvenance,
+		},
+		{
+			name:    "built from another repository",
+			file:    own.bundle(t, forked, own.sign(t, forked), forked),
+			signer:  own,
+			wantErr: ErrUntrusted,
+		},
+		{
+			name:    "signed by another repository's workflow",
+			file:    fork.bundle(t, v1, fork.sign(t, v1), v1),
+			signer:  fork,
+			wantErr: ErrUntrusted,
+		},
+		{
+			name:    "tampered statement",
+			file:    own.bundle(t, v1, own.sign(t, other), v1),
+			signer:  own,
+			wantErr: ErrUntrusted,
+		},
+		{
+			name:    "transparency log entry for another statement",
+			file:    own.bundle(t, v1, own.sign(t, v1), other),
+			signer:  own,
+			wantErr: ErrUntrusted,
+		},
+		{
+			name:    "untrusted root",
+			file:    own.bundle(t, v1, own.sign(t, v1), v1),
+			signer:  &signer{root: generator.root, rekorKey: own.rekorKey},
+			wantErr: ErrUntrusted,
+		},
+		{
+			name:    "untrusted transparency log",
+			file:    own.bundle(t, v1, own.sign(t, v1), v1),
+			signer:  &signer{root: own.root, rekorKey: generator.rekorKey},
+			wantErr: ErrUntrusted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := SplitDocuments(tt.file)
+			if err != nil {
+				t.Fatalf("SplitDocuments() error: %v", err)
+			}
+			roots := []*x509.Certificate{tt.signer.root}
+			result, err := Verify(docs, digest, testSource, roots, &tt.signer.rekorKey.PublicKey, DefaultBuilders)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() unexpected error: %v", err)
+			}
+			if result.Builder != tt.wantBuilder {
+				t.Errorf("Verify() Builder = %q, want %q", result.Builder, tt.wantBuilder)
+			}
+		})
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/sfkleach/execman/pkg/scope"
 )
 
 // Executable represents a managed executable in the registry.
@@ -16,31 +20,133 @@ type Executable struct {
 	Path        string    `json:"path"`
 	Platform    string    `json:"platform"`
 	Checksum    string    `json:"checksum"`
+	// Prerelease records that the installed version is a prerelease.
+	Prerelease bool `json:"prerelease,omitempty"`
+	// Location is the name of the configured install location the
+	// executable was installed into, if any.
+	Location string `json:"location,omitempty"`
+	// Format is the executable format detected from the binary's header,
+	// such as "elf linux/amd64".
+	Format string `json:"format,omitempty"`
+	// ChecksumPolicy overrides the configured checksum policy for this
+	// executable when set.
+	ChecksumPolicy string `json:"checksum_policy,omitempty"`
+	// SignaturePolicy overrides the configured signature policy for this
+	// executable when set.
+	SignaturePolicy string `json:"signature_policy,omitempty"`
+	// Signature records the signature that the installed download was
+	// verified against, if any.
+	Signature *Signature `json:"signature,omitempty"`
+	// Provenance records the verified build provenance of the installed
+	// download, if it was checked. Once recorded, updates must verify too.
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Companions lists shell completions, man pages and licenses that were
+	// installed alongside the executable.
+	Companions []CompanionFile `json:"companions,omitempty"`
+	// Aliases lists symlinks to the executable under other names, installed
+	// beside it and removed with it.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// CompanionFile represents a file installed alongside an executable, such as
+// a shell completion script, man page or license.
+type CompanionFile struct {
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+// Signature records a verified signature of a downloaded release asset.
+type Signature struct {
+	// Method is how the signature was verified, such as "cosign-keyless".
+	Method string `json:"method"`
+	// Artifact is the signed release asset: the download itself, or the
+	// checksums file it was verified against.
+	Artifact string `json:"artifact"`
+	// Identity and Issuer identify the signer of a keyless signature.
+	Identity string `json:"identity,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	// KeyID identifies the key of a key-based signature.
+	KeyID      string    `json:"key_id,omitempty"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// Provenance records verified SLSA build provenance of a downloaded release
+// asset.
+type Provenance struct {
+	PredicateType string `json:"predicate_type"`
+	// Builder is the builder named in the provenance.
+	Builder string `json:"builder"`
+	// Signer is the identity of the workflow that signed the provenance.
+	Signer string `json:"signer"`
+	// SourceRepo is the repository the asset was built from.
+	SourceRepo string `json:"source_repo"`
+	// Attestation is where the provenance was found: a release asset, or the
+	// GitHub attestations API.
+	Attestation string    `json:"attestation"`
+	VerifiedAt  time.Time `json:"verified_at"`
 }
 
 // Registry represents the execman registry.
 type Registry struct {
 	SchemaVersion int                    `json:"schema_version"`
 	Executables   map[string]*Executable `json:"executables"`
-	path          string                 // internal, not serialized
+	// Keys holds the publisher signing keys pinned for each source, keyed by
+	// source URL. A key is pinned on first use and outlives the executables
+	// installed from the source.
+	Keys map[string]*PinnedKey `json:"keys,omitempty"`
+	// Versions holds the versions of executables kept side by side in the
+	// versioned store, keyed by name and then by version. They are separate
+	// from the installed executable of the same name, which is the one on
+	// PATH.
+	Versions  map[string]map[string]*Executable `json:"versions,omitempty"`
+	path      string                            // internal, not serialized
+	scopeName string                            // internal, not serialized
+}
+
+// PinnedKey is a publisher's minisign or GPG public key, trusted for every
+// release of a source.
+type PinnedKey struct {
+	// Type is "minisign" or "gpg".
+	Type string `json:"type"`
+	// ID is the minisign key ID or the GPG key fingerprint.
+	ID string `json:"id"`
+	// PublicKey is the key itself: a minisign key or an armored GPG key.
+	PublicKey string    `json:"public_key"`
+	PinnedAt  time.Time `json:"pinned_at"`
 }
 
-// DefaultRegistryPath returns the default registry file path.
+// DefaultRegistryPath returns the registry file path of the current scope.
 func DefaultRegistryPath() (string, error) {
-	configDir, err := os.UserConfigDir()
+	return ScopeRegistryPath(scope.Current())
+}
+
+// ScopeRegistryPath returns the registry file path of a scope.
+func ScopeRegistryPath(s string) (string, error) {
+	stateDir, err := scope.StateDir(s)
 	if err != nil {
-		return "", fmt.Errorf("failed to get user config directory: %w", err)
+		return "", err
 	}
-	return filepath.Join(configDir, "execman", "registry.json"), nil
+	return filepath.Join(stateDir, "registry.json"), nil
 }
 
-// Load loads the registry from the default location.
+// Load loads the registry of the current scope.
 func Load() (*Registry, error) {
-	path, err := DefaultRegistryPath()
+	return LoadScope(scope.Current())
+}
+
+// LoadScope loads the registry of a scope.
+func LoadScope(s string) (*Registry, error) {
+	path, err := ScopeRegistryPath(s)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := LoadFrom(path)
 	if err != nil {
 		return nil, err
 	}
-	return LoadFrom(path)
+	reg.scopeName = s
+	return reg, nil
 }
 
 // LoadFrom loads the registry from a specific path.
@@ -77,7 +183,7 @@ func LoadFrom(path string) (*Registry, error) {
 func (r *Registry) Save() error {
 	// Ensure directory exists.
 	dir := filepath.Dir(r.path)
-	if err := os.MkdirAll(dir, 0750); err != nil {
+	if err := os.MkdirAll(dir, scope.DirMode(r.scopeName)); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
@@ -86,8 +192,9 @@ func (r *Registry) Save() error {
 		return fmt.Errorf("failed to marshal registry: %w", err)
 	}
 
-	// Use 0600 permissions for registry file (user read/write only).
-	if err := os.WriteFile(r.path, data, 0600); err != nil {
+	// The user's registry is private to them; the system's is readable by
+	// every user.
+	if err := os.WriteFile(r.path, data, scope.FileMode(r.scopeName)); err != nil {
 		return fmt.Errorf("failed to write registry: %w", err)
 	}
 
@@ -110,6 +217,45 @@ func (r *Registry) Remove(name string) {
 	delete(r.Executables, name)
 }
 
+// Rename moves an executable, and its versions in the versioned store, to a
+// new name.
+func (r *Registry) Rename(oldName, newName string) {
+	if exec, ok := r.Executables[oldName]; ok {
+		delete(r.Executables, oldName)
+		r.Executables[newName] = exec
+	}
+	if versions, ok := r.Versions[oldName]; ok {
+		delete(r.Versions, oldName)
+		r.Versions[newName] = versions
+	}
+}
+
+// Owner returns the name of the executable installed at path, as its file or
+// as one of its aliases.
+func (r *Registry) Owner(path string) (string, bool) {
+	path = filepath.Clean(path)
+	for name, exec := range r.Executables {
+		if filepath.Clean(exec.Path) == path {
+			return name, true
+		}
+		for _, alias := range exec.Aliases {
+			if filepath.Clean(alias) == path {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ValidateName checks that a name can be given to an executable: it must be a
+// single path element, and may not contain '@', which introduces a version.
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\@`) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
+
 // List returns all executable names.
 func (r *Registry) List() []string {
 	names := make([]string, 0, len(r.Executables))
@@ -118,3 +264,55 @@ func (r *Registry) List() []string {
 	}
 	return names
 }
+
+// AddVersion adds or updates a version of an executable in the versioned
+// store.
+func (r *Registry) AddVersion(name string, exec *Executable) {
+	if r.Versions == nil {
+		r.Versions = make(map[string]map[string]*Executable)
+	}
+	if r.Versions[name] == nil {
+		r.Versions[name] = make(map[string]*Executable)
+	}
+	r.Versions[name][exec.Version] = exec
+}
+
+// GetVersion retrieves a version of an executable from the versioned store.
+func (r *Registry) GetVersion(name, version string) (*Executable, bool) {
+	exec, ok := r.Versions[name][version]
+	return exec, ok
+}
+
+// RemoveVersion removes a version of an executable from the versioned store.
+func (r *Registry) RemoveVersion(name, version string) {
+	delete(r.Versions[name], version)
+	if len(r.Versions[name]) == 0 {
+		delete(r.Versions, name)
+	}
+}
+
+// ListVersions returns the versions of an executable in the versioned store,
+// sorted as strings.
+func (r *Registry) ListVersions(name string) []string {
+	versions := make([]string, 0, len(r.Versions[name]))
+	for version := range r.Versions[name] {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// GetKey retrieves the signing key pinned for a source.
+func (r *Registry) GetKey(source string) (*PinnedKey, bool) {
+	key, ok := r.Keys[source]
+	return key, ok
+}
+
+// PinKey records the signing key trusted for a source, replacing any key
+// pinned before.
+func (r *Registry) PinKey(source string, key *PinnedKey) {
+	if r.Keys == nil {
+		r.Keys = make(map[string]*PinnedKey)
+	}
+	r.Keys[source] = key
+}
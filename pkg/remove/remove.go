@@ -6,7 +6,9 @@ import (
 	"os"
 	"strings"
 
+	"github.com/sfkleach/execman/pkg/companion"
 	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
 	"github.com/sfkleach/execman/pkg/symlink"
 	"github.com/spf13/cobra"
 )
@@ -22,11 +24,14 @@ func NewRemoveCommand() *cobra.Command {
 	var yes bool
 
 	cmd := &cobra.Command{
-		Use:   "remove <executable>",
+		Use:   "remove <executable>[@version]",
 		Short: "Remove a managed executable",
-		Long:  "Remove an executable from management and delete the file.",
-		Args:  cobra.ExactArgs(1),
+		Long: `Remove an executable from management and delete the file, along with any
+other versions of it kept in the versioned store. Give a version, as in
+terraform@v1.5.7, to remove just that version from the store.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
 			opts := Options{
 				Name: args[0],
 				Yes:  yes,
@@ -48,8 +53,23 @@ func Remove(opts Options) error {
 		return fmt.Errorf("failed to load registry: %w", err)
 	}
 
+	// A version names one version in the store.
+	if name, version, ok := strings.Cut(opts.Name, "@"); ok {
+		if exec, ok := reg.Get(name); ok && exec.Version == version {
+			return fmt.Errorf("%s %s is the version in use; switch to another with 'execman use' first, or remove %s", name, version, name)
+		}
+		if _, ok := reg.GetVersion(name, version); !ok {
+			return fmt.Errorf("%s %s is not in the store", name, version)
+		}
+		return removeStored(reg, name, []string{version}, opts.Yes)
+	}
+
 	// Check if executable exists.
+	stored := reg.ListVersions(opts.Name)
 	exec, ok := reg.Get(opts.Name)
+	if !ok && len(stored) > 0 {
+		return removeStored(reg, opts.Name, stored, opts.Yes)
+	}
 	if !ok {
 		return fmt.Errorf("executable %q is not managed by execman", opts.Name)
 	}
@@ -89,6 +109,15 @@ func Remove(opts Options) error {
 			fmt.Printf("  Will remove:  %s\n", effectivePath)
 		}
 		fmt.Printf("  Installed:    %s\n", exec.InstalledAt.Format("2006-01-02"))
+		if len(exec.Companions) > 0 {
+			fmt.Printf("  Companions:   %d files\n", len(exec.Companions))
+		}
+		if len(exec.Aliases) > 0 {
+			fmt.Printf("  Aliases:      %s\n", strings.Join(exec.Aliases, ", "))
+		}
+		if len(stored) > 0 {
+			fmt.Printf("  Stored:       %s\n", strings.Join(stored, ", "))
+		}
 		fmt.Println()
 		fmt.Print("This will delete the executable file and remove it from management. Continue? [y/N]: ")
 
@@ -118,6 +147,9 @@ func Remove(opts Options) error {
 		}
 	}
 
+	// Remove companion files, aliases and the other versions in the store.
+	DeleteExtras(reg, opts.Name, exec)
+
 	// Remove from registry.
 	reg.Remove(opts.Name)
 	if err := reg.Save(); err != nil {
@@ -129,3 +161,76 @@ func Remove(opts Options) error {
 
 	return nil
 }
+
+// DeleteExtras deletes what an executable has besides its file: its
+// companion files, its aliases, if they are still symlinks, and its versions
+// in the store. Problems are reported as warnings. The registry is updated but
+// not saved.
+func DeleteExtras(reg *registry.Registry, name string, exec *registry.Executable) {
+	if err := companion.Remove(exec.Companions); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	for _, alias := range exec.Aliases {
+		info, err := os.Lstat(alias)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			fmt.Printf("Warning: %s is no longer a symlink, so it was left alone\n", alias)
+			continue
+		}
+		if err := os.Remove(alias); err != nil {
+			fmt.Printf("Warning: failed to remove alias %s: %v\n", alias, err)
+		}
+	}
+
+	deleteStored(reg, name, reg.ListVersions(name))
+}
+
+// removeStored removes versions of an executable from the versioned store.
+func removeStored(reg *registry.Registry, name string, versions []string, yes bool) error {
+	if !yes {
+		fmt.Printf("Remove %s %s from the store?\n\n", name, strings.Join(versions, ", "))
+		for _, version := range versions {
+			exec, _ := reg.GetVersion(name, version)
+			fmt.Printf("  %-12s %s\n", version, exec.Path)
+		}
+		fmt.Println()
+		fmt.Print("This will delete the files and remove them from management. Continue? [y/N]: ")
+
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		if response != "y" && response != "yes" {
+			fmt.Println("Removal cancelled.")
+			return nil
+		}
+	}
+
+	deleteStored(reg, name, versions)
+	if err := reg.Save(); err != nil {
+		return fmt.Errorf("failed to update registry: %w", err)
+	}
+
+	fmt.Printf("\n%s %s removed successfully\n", name, strings.Join(versions, ", "))
+	return nil
+}
+
+// deleteStored deletes versions of an executable from the versioned store and
+// the registry, warning about files that cannot be deleted.
+func deleteStored(reg *registry.Registry, name string, versions []string) {
+	for _, version := range versions {
+		exec, ok := reg.GetVersion(name, version)
+		if !ok {
+			continue
+		}
+		if err := os.Remove(exec.Path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to remove %s: %v\n", exec.Path, err)
+			continue
+		}
+		store.RemoveEmpty(exec.Path)
+		reg.RemoveVersion(name, version)
+	}
+}
@@ -0,0 +1,308 @@
+// Package rename implements the rename command, which changes the name an
+// executable is managed and installed under.
+package rename
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// Options for the rename command.
+type Options struct {
+	Old string
+	New string
+	Yes bool
+}
+
+// NewRenameCommand creates the rename command.
+func NewRenameCommand() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "rename <executable> <new-name>",
+		Short: "Rename a managed executable",
+		Long: `Rename an executable's file, and the name execman manages it under,
+keeping its history, such as when it was installed and its checksum. Its
+aliases are relinked to the new name and its versions in the versioned store
+are renamed too. The new name must not belong to another managed executable
+or to a file already beside the executable.
+
+Completion scripts and man pages are written for the original name, so they
+are left as they are.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			opts := Options{
+				Old: args[0],
+				New: args[1],
+				Yes: yes,
+			}
+			return Run(opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip confirmation prompt")
+
+	return cmd
+}
+
+// Run executes the rename command.
+func Run(opts Options) error {
+	// Load registry.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	exec, found := reg.Get(opts.Old)
+	stored := reg.ListVersions(opts.Old)
+	if !found && len(stored) == 0 {
+		return fmt.Errorf("executable %q is not managed by execman", opts.Old)
+	}
+
+	// Show details and confirm.
+	if !opts.Yes {
+		fmt.Printf("Rename %s to %s?\n\n", opts.Old, opts.New)
+		if found {
+			fmt.Printf("  Path:         %s\n", exec.Path)
+			fmt.Printf("  New path:     %s\n", filepath.Join(filepath.Dir(exec.Path), newBase(exec.Path, opts.Old, opts.New)))
+			if len(exec.Aliases) > 0 {
+				fmt.Printf("  Aliases:      %s\n", strings.Join(exec.Aliases, ", "))
+			}
+		}
+		if len(stored) > 0 {
+			fmt.Printf("  Stored:       %s\n", strings.Join(stored, ", "))
+		}
+		fmt.Println()
+		fmt.Print("Continue? [y/N]: ")
+
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		if response != "y" && response != "yes" {
+			fmt.Println("Rename cancelled.")
+			return nil
+		}
+	}
+
+	undo, err := Rename(reg, opts.Old, opts.New)
+	if err != nil {
+		return err
+	}
+	if err := reg.Save(); err != nil {
+		// Put the files back, so that they match the registry on disk.
+		if undoErr := undo(); undoErr != nil {
+			fmt.Printf("Warning: failed to undo the rename: %v\n", undoErr)
+		}
+		return fmt.Errorf("failed to update registry: %w", err)
+	}
+
+	fmt.Printf("\n%s renamed to %s\n", opts.Old, opts.New)
+	return nil
+}
+
+// move is one file renamed by Rename.
+type move struct {
+	src, dst string
+}
+
+// Rename renames an executable's file, its versions in the versioned store
+// and its registry entries from oldName to newName, and relinks its aliases.
+// Either every file is renamed or none is. The registry is updated but not
+// saved; if saving it fails, calling the returned undo puts the files and
+// the registry entries back as they were.
+func Rename(reg *registry.Registry, oldName, newName string) (func() error, error) {
+	if err := registry.ValidateName(newName); err != nil {
+		return nil, err
+	}
+	if newName == oldName {
+		return nil, fmt.Errorf("%s already has that name", oldName)
+	}
+	if _, ok := reg.Get(newName); ok || len(reg.ListVersions(newName)) > 0 {
+		return nil, fmt.Errorf("%s is already managed by execman", newName)
+	}
+
+	exec, found := reg.Get(oldName)
+	stored := reg.ListVersions(oldName)
+	if !found && len(stored) == 0 {
+		return nil, fmt.Errorf("executable %q is not managed by execman", oldName)
+	}
+
+	// Work out every rename, and check that nothing is in the way, before
+	// changing anything.
+	var moves []move
+	var aliases []string
+	if found {
+		target := filepath.Join(filepath.Dir(exec.Path), newBase(exec.Path, oldName, newName))
+		for _, alias := range exec.Aliases {
+			// An alias with the new name gives way to the executable.
+			if filepath.Clean(alias) == target {
+				info, err := os.Lstat(alias)
+				if err == nil && info.Mode()&os.ModeSymlink == 0 {
+					return nil, fmt.Errorf("%s already exists", target)
+				}
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+		if len(aliases) == len(exec.Aliases) {
+			if owner, ok := reg.Owner(target); ok {
+				return nil, fmt.Errorf("%s belongs to %s, which execman manages", target, owner)
+			}
+			if _, err := os.Lstat(target); err == nil {
+				return nil, fmt.Errorf("%s already exists", target)
+			}
+		}
+		moves = append(moves, move{src: exec.Path, dst: target})
+	}
+	for _, version := range stored {
+		storedExec, _ := reg.GetVersion(oldName, version)
+		dir, err := store.Dir(newName, version)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(dir, newBase(storedExec.Path, oldName, newName))
+		if _, err := os.Lstat(target); err == nil {
+			return nil, fmt.Errorf("%s already exists", target)
+		}
+		moves = append(moves, move{src: storedExec.Path, dst: target})
+	}
+
+	// Clear away an alias that the executable is taking the name of.
+	takesAlias := found && len(aliases) < len(exec.Aliases)
+	if takesAlias {
+		if err := os.Remove(moves[0].dst); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove alias %s: %w", moves[0].dst, err)
+		}
+	}
+
+	for i, m := range moves {
+		// #nosec G301 -- Install and store directories need 0755 for executables to be accessible
+		err := os.MkdirAll(filepath.Dir(m.dst), 0755)
+		if err == nil {
+			err = os.Rename(m.src, m.dst)
+		}
+		if err != nil {
+			// Put back what was already renamed.
+			_ = moveBack(moves[:i])
+			if takesAlias {
+				_ = os.Symlink(filepath.Base(exec.Path), moves[0].dst)
+			}
+			return nil, fmt.Errorf("failed to rename %s: %w", m.src, err)
+		}
+	}
+
+	// Remember what is about to change in the registry, for undo.
+	renamed := moves
+	var oldPath string
+	var oldAliases, relinked []string
+	if found {
+		oldPath = exec.Path
+		oldAliases = exec.Aliases
+	}
+	storedPaths := map[string]string{}
+	for _, version := range stored {
+		storedExec, _ := reg.GetVersion(oldName, version)
+		storedPaths[version] = storedExec.Path
+	}
+
+	// Point the aliases at the new name. They are relative symlinks beside
+	// the executable.
+	if found {
+		exec.Path = moves[0].dst
+		exec.Aliases = nil
+		for _, alias := range aliases {
+			info, err := os.Lstat(alias)
+			if err != nil || info.Mode()&os.ModeSymlink == 0 {
+				fmt.Printf("Warning: %s is no longer a symlink, so it was left alone\n", alias)
+				continue
+			}
+			if err := os.Remove(alias); err != nil {
+				fmt.Printf("Warning: failed to relink alias %s: %v\n", alias, err)
+				continue
+			}
+			relinked = append(relinked, alias)
+			if err := os.Symlink(filepath.Base(exec.Path), alias); err != nil {
+				fmt.Printf("Warning: failed to relink alias %s: %v\n", alias, err)
+				continue
+			}
+			exec.Aliases = append(exec.Aliases, alias)
+		}
+		moves = moves[1:]
+	}
+
+	for i, version := range stored {
+		storedExec, _ := reg.GetVersion(oldName, version)
+		store.RemoveEmpty(storedExec.Path)
+		storedExec.Path = moves[i].dst
+	}
+
+	reg.Rename(oldName, newName)
+
+	undo := func() error {
+		reg.Rename(newName, oldName)
+		for version, path := range storedPaths {
+			storedExec, _ := reg.GetVersion(oldName, version)
+			storedExec.Path = path
+		}
+		errs := []error{moveBack(renamed)}
+		if found {
+			exec.Path = oldPath
+			exec.Aliases = oldAliases
+			// Point the aliases at the old name again, and restore the alias
+			// that the executable took the name of.
+			if takesAlias {
+				relinked = append(relinked, renamed[0].dst)
+			}
+			for _, alias := range relinked {
+				err := os.Remove(alias)
+				if err == nil || os.IsNotExist(err) {
+					err = os.Symlink(filepath.Base(oldPath), alias)
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to relink alias %s: %w", alias, err))
+				}
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return undo, nil
+}
+
+// moveBack moves renamed files back, last first, recreating the directories
+// they came from. Every file is tried, and every failure is returned.
+func moveBack(moves []move) error {
+	var errs []error
+	for j := len(moves) - 1; j >= 0; j-- {
+		m := moves[j]
+		// #nosec G301 -- Install and store directories need 0755 for executables to be accessible
+		err := os.MkdirAll(filepath.Dir(m.src), 0755)
+		if err == nil {
+			err = os.Rename(m.dst, m.src)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to move %s back to %s: %w", m.dst, m.src, err))
+			continue
+		}
+		store.RemoveEmpty(m.dst)
+	}
+	return errors.Join(errs...)
+}
+
+// newBase returns the file name for an executable at path renamed from
+// oldName to newName, keeping any extension, such as ".exe", after the name.
+func newBase(path, oldName, newName string) string {
+	if suffix, ok := strings.CutPrefix(filepath.Base(path), oldName); ok {
+		return newName + suffix
+	}
+	return newName
+}
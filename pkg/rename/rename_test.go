@@ -0,0 +1,156 @@
+package rename
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+)
+
+func TestRename(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-rename-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+
+	// ripgrep is installed as "ripgrep", with the alias "rg" and an older
+	// version in the store.
+	binDir := filepath.Join(tmpDir, "bin")
+	storeDir, err := store.Dir("ripgrep", "v13.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		filepath.Join(binDir, "ripgrep"):   "new",
+		filepath.Join(storeDir, "ripgrep"): "old",
+		filepath.Join(binDir, "fd"):        "fd",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("ripgrep", filepath.Join(binDir, "rg")); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := "https://github.com/BurntSushi/ripgrep"
+	installedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	reg.Add("ripgrep", &registry.Executable{
+		Source:      source,
+		Version:     "v14.1.0",
+		Path:        filepath.Join(binDir, "ripgrep"),
+		Checksum:    "sha256:abc",
+		InstalledAt: installedAt,
+		Aliases:     []string{filepath.Join(binDir, "rg")},
+	})
+	reg.AddVersion("ripgrep", &registry.Executable{Source: source, Version: "v13.0.0", Path: filepath.Join(storeDir, "ripgrep")})
+	reg.Add("fd", &registry.Executable{Source: "https://github.com/sharkdp/fd", Path: filepath.Join(binDir, "fd")})
+
+	// Names that are taken or invalid are refused, leaving everything alone.
+	for _, name := range []string{"fd", "ripgrep", "a/b", ""} {
+		if _, err := Rename(reg, "ripgrep", name); err == nil {
+			t.Errorf("Rename() to %q succeeded", name)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "grep"), []byte("unmanaged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rename(reg, "ripgrep", "grep"); err == nil {
+		t.Errorf("Rename() replaced an unmanaged file")
+	}
+
+	// Undoing a rename, as when the registry cannot be saved, puts back the
+	// files, the alias and the registry entries.
+	undo, err := Rename(reg, "ripgrep", "rg")
+	if err != nil {
+		t.Fatalf("Rename() error: %v", err)
+	}
+	if err := undo(); err != nil {
+		t.Fatalf("undo() error: %v", err)
+	}
+	if _, ok := reg.Get("rg"); ok {
+		t.Errorf("rg is still registered after undo")
+	}
+	if exec, ok := reg.Get("ripgrep"); !ok || exec.Path != filepath.Join(binDir, "ripgrep") || len(exec.Aliases) != 1 {
+		t.Errorf("ripgrep after undo = %+v, want its original path and alias", exec)
+	}
+	if data, err := os.ReadFile(filepath.Join(binDir, "ripgrep")); err != nil || string(data) != "new" {
+		t.Errorf("ripgrep reads %q (%v) after undo, want the executable", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(binDir, "rg")); err != nil || target != "ripgrep" {
+		t.Errorf("alias links to %q (%v) after undo, want ripgrep", target, err)
+	}
+	if stored, ok := reg.GetVersion("ripgrep", "v13.0.0"); !ok || stored.Path != filepath.Join(storeDir, "ripgrep") {
+		t.Errorf("stored version after undo = %+v, want its original path", stored)
+	}
+	if data, err := os.ReadFile(filepath.Join(storeDir, "ripgrep")); err != nil || string(data) != "old" {
+		t.Errorf("stored version reads %q (%v) after undo", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filepath.Dir(storeDir)), "rg")); !os.IsNotExist(err) {
+		t.Errorf("the new store directory was left behind after undo")
+	}
+
+	// Taking the name of its own alias replaces the alias.
+	if _, err := Rename(reg, "ripgrep", "rg"); err != nil {
+		t.Fatalf("Rename() error: %v", err)
+	}
+	if _, ok := reg.Get("ripgrep"); ok {
+		t.Errorf("ripgrep is still registered")
+	}
+	exec, ok := reg.Get("rg")
+	if !ok {
+		t.Fatalf("rg is not registered")
+	}
+	if exec.Path != filepath.Join(binDir, "rg") || len(exec.Aliases) != 0 {
+		t.Errorf("renamed executable = %+v, want rg with no aliases", exec)
+	}
+	if !exec.InstalledAt.Equal(installedAt) || exec.Checksum != "sha256:abc" {
+		t.Errorf("renamed executable lost its history: %+v", exec)
+	}
+	if data, err := os.ReadFile(exec.Path); err != nil || string(data) != "new" {
+		t.Errorf("%s reads %q (%v), want the executable", exec.Path, data, err)
+	}
+	if info, err := os.Lstat(exec.Path); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("%s is not the executable file", exec.Path)
+	}
+
+	// The stored version is renamed too.
+	stored, ok := reg.GetVersion("rg", "v13.0.0")
+	if !ok {
+		t.Fatalf("the stored version was not renamed")
+	}
+	if data, err := os.ReadFile(stored.Path); err != nil || string(data) != "old" {
+		t.Errorf("%s reads %q (%v), want the stored version", stored.Path, data, err)
+	}
+	if _, err := os.Stat(filepath.Dir(storeDir)); !os.IsNotExist(err) {
+		t.Errorf("the old store directory was left behind")
+	}
+
+	// Renaming again relinks aliases.
+	exec.Aliases = []string{filepath.Join(binDir, "ripgrep")}
+	if err := os.Symlink("rg", exec.Aliases[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rename(reg, "rg", "ripgrep-14"); err != nil {
+		t.Fatalf("Rename() error: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(binDir, "ripgrep")); err != nil || target != "ripgrep-14" {
+		t.Errorf("alias links to %q (%v), want ripgrep-14", target, err)
+	}
+}
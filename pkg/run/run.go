@@ -0,0 +1,189 @@
+// Package run implements the run command, which runs an executable from a
+// GitHub release once without installing it.
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/binfmt"
+	"github.com/sfkleach/execman/pkg/cache"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/fetch"
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// Options represents the run command options.
+type Options struct {
+	Source string
+	// Args are passed to the executable.
+	Args               []string
+	IncludePrereleases bool
+}
+
+// NewRunCommand creates the run command.
+func NewRunCommand() *cobra.Command {
+	var includePrereleases bool
+
+	cmd := &cobra.Command{
+		Use:   "run <github.com/owner/repo>[@version] [-- args...]",
+		Short: "Run an executable from GitHub once, without installing it",
+		Long: `Download a release's executable for this platform, verifying it as install
+would, and run it with the arguments after the source. The download and the
+extracted executable are kept in the download cache, so running it again
+does not download it again, but nothing is installed: PATH and the registry
+are left alone. The executable takes execman's place, so it receives
+signals and standard input directly and its exit status is execman's.
+execman's own messages go to standard error.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return Run(Options{
+				Source:             args[0],
+				Args:               programArgs(args),
+				IncludePrereleases: includePrereleases,
+			})
+		},
+	}
+
+	// Flags after the source belong to the executable.
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVar(&includePrereleases, "include-prereleases", false, "Allow running a prerelease version")
+
+	return cmd
+}
+
+// programArgs returns the arguments after the source, which belong to the
+// executable. Since flags after the source are not parsed, a "--" there only
+// separates the executable's arguments from execman's, and is dropped.
+func programArgs(args []string) []string {
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	return rest
+}
+
+// Run executes the run command.
+func Run(opts Options) error {
+	// Report progress on standard error, leaving standard output to the
+	// executable.
+	path, err := prepare(opts, os.Stderr)
+	if err != nil {
+		return err
+	}
+	return runner.Exec(path, opts.Args)
+}
+
+// prepare downloads, verifies and extracts the executable, reporting
+// progress to out, and returns its path in the download cache.
+func prepare(opts Options, out io.Writer) (string, error) {
+	// Load registry and config. The registry is only read, for pinned keys.
+	reg, err := registry.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pol, err := policy.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	owner, repo, version, err := github.ParseSource(opts.Source)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the source against the policy before contacting it.
+	source := github.ToURL(owner, repo)
+	if err := pol.CheckSource(source); err != nil {
+		return "", err
+	}
+	includePrereleases := (opts.IncludePrereleases || cfg.IncludePrereleases) && !pol.ForbidsPrereleases()
+
+	var release *github.Release
+	if version != "" {
+		fmt.Fprintf(out, "Fetching release %s from %s/%s...\n", version, owner, repo)
+		release, err = github.GetRelease(owner, repo, version)
+	} else {
+		fmt.Fprintf(out, "Fetching latest release from %s/%s...\n", owner, repo)
+		release, err = github.GetLatestRelease(owner, repo, includePrereleases)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := pol.CheckRelease(source, release.TagName, release.Prerelease); err != nil {
+		return "", err
+	}
+
+	asset, err := github.FindAsset(release.Assets, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", fmt.Errorf("%s has no download for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+
+	// Download and verify the asset. A key trusted on first use is not
+	// pinned, since the registry is left alone.
+	trust := cfg.TrustFor(source)
+	pinnedKey, _ := reg.GetKey(source)
+	signaturePolicy := fetch.EffectiveSignaturePolicy("", "", trust, cfg)
+	if pol.RequiresSignature(source) {
+		signaturePolicy = config.PolicyRequire
+	}
+	fetched, err := fetch.Asset(cfg, release, asset, fetch.Options{
+		ChecksumPolicy:  fetch.EffectivePolicy("", "", cfg),
+		SignaturePolicy: signaturePolicy,
+		Source:          source,
+		Trust:           trust,
+		PinnedKey:       pinnedKey,
+		Output:          out,
+	})
+	if errors.Is(err, fetch.ErrSignatureRequired) && pol.RequiresSignature(source) {
+		return "", policy.SignatureViolation(source, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Extract afresh on every run, so that a copy altered in the cache is
+	// never run.
+	downloadCache, err := cache.Open(cfg.CacheMaxSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to open download cache: %w", err)
+	}
+	path := downloadCache.ExtractedPath(fetched.Checksum, repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	stagingPath := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.execman-new", repo, os.Getpid()))
+	if err := archive.ExtractBinary(fetched.ArchivePath, stagingPath, cfg.ExtractionLimits); err != nil {
+		_ = os.Remove(stagingPath)
+		return "", fmt.Errorf("failed to extract binary: %w", err)
+	}
+	if _, err := binfmt.Check(stagingPath, runtime.GOOS, runtime.GOARCH, cfg.PlatformCheck, func(err error) {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}); err != nil {
+		_ = os.Remove(stagingPath)
+		return "", fmt.Errorf("refusing to run %s: %w", asset.Name, err)
+	}
+	if err := os.Rename(stagingPath, path); err != nil {
+		_ = os.Remove(stagingPath)
+		return "", fmt.Errorf("failed to extract binary: %w", err)
+	}
+
+	fmt.Fprintf(out, "Running %s %s...\n", repo, release.TagName)
+	return path, nil
+}
@@ -0,0 +1,58 @@
+package run
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProgramArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want []string
+	}{
+		{
+			name: "no arguments",
+			argv: []string{"github.com/owner/tool"},
+			want: []string{},
+		},
+		{
+			name: "flags after the source",
+			argv: []string{"github.com/owner/tool", "--help", "-v"},
+			want: []string{"--help", "-v"},
+		},
+		{
+			name: "separator after the source",
+			argv: []string{"github.com/owner/tool", "--", "--help"},
+			want: []string{"--help"},
+		},
+		{
+			name: "separator passed on",
+			argv: []string{"github.com/owner/tool", "--", "--", "file"},
+			want: []string{"--", "file"},
+		},
+		{
+			name: "separator before the source",
+			argv: []string{"--include-prereleases", "--", "github.com/owner/tool", "--version"},
+			want: []string{"--version"},
+		},
+		{
+			name: "separator later on",
+			argv: []string{"github.com/owner/tool", "grep", "--", "-x"},
+			want: []string{"grep", "--", "-x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := NewRunCommand()
+			if err := cmd.ParseFlags(tt.argv); err != nil {
+				t.Fatalf("ParseFlags() error: %v", err)
+			}
+			got := programArgs(cmd.Flags().Args())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("programArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
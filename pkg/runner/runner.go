@@ -0,0 +1,4 @@
+// Package runner runs an executable in place of execman, so that it sees
+// execman's arguments, environment, standard streams and signals, and its
+// exit status becomes execman's.
+package runner
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Exec replaces the execman process with the executable at path, run with
+// args. It only returns if the executable cannot be started.
+func Exec(path string, args []string) error {
+	argv := append([]string{path}, args...)
+	// #nosec G204 -- Running the executable the user asked for
+	if err := syscall.Exec(path, argv, os.Environ()); err != nil {
+		return fmt.Errorf("failed to run %s: %w", path, err)
+	}
+	return nil
+}
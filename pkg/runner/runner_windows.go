@@ -0,0 +1,39 @@
+//go:build windows
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// Exec runs the executable at path with args and exits with its exit code.
+// Windows cannot replace a running process, so the executable runs as a
+// child sharing execman's console, which delivers Ctrl+C to both; execman
+// ignores it and waits for the child. Exec only returns if the executable
+// cannot be started.
+func Exec(path string, args []string) error {
+	// #nosec G204 -- Running the executable the user asked for
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signal.Ignore(os.Interrupt)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", path, err)
+	}
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", path, err)
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package scope selects between the per-user installation, managed by each
+// user in their own config directory, and the system-wide installation,
+// managed by administrators for every user of the machine.
+package scope
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Scopes.
+const (
+	User   = "user"
+	System = "system"
+)
+
+// current is the scope that commands operate on.
+var current = User
+
+// Set selects the scope that commands operate on.
+func Set(s string) {
+	current = s
+}
+
+// Current returns the scope that commands operate on.
+func Current() string {
+	return current
+}
+
+// ConfigDir returns the directory holding a scope's configuration: the
+// user's config directory, or /etc/execman for the system.
+func ConfigDir(s string) (string, error) {
+	if s == System {
+		if runtime.GOOS == "windows" {
+			return filepath.Join(os.Getenv("ProgramData"), "execman"), nil
+		}
+		return filepath.Join("/etc", "execman"), nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "execman"), nil
+}
+
+// StateDir returns the directory holding a scope's registry: the user's
+// config directory, or /var/lib/execman for the system.
+func StateDir(s string) (string, error) {
+	if s == System {
+		if runtime.GOOS == "windows" {
+			return filepath.Join(os.Getenv("ProgramData"), "execman"), nil
+		}
+		return filepath.Join("/var", "lib", "execman"), nil
+	}
+	return ConfigDir(User)
+}
+
+// DataDir returns the directory holding a scope's versioned store: the
+// user's data directory, or /var/lib/execman for the system.
+func DataDir(s string) (string, error) {
+	if s == System {
+		return StateDir(System)
+	}
+	if runtime.GOOS == "windows" {
+		return ConfigDir(User)
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return filepath.Join(dataHome, "execman"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "share", "execman"), nil
+}
+
+// DirMode returns the permissions of the directories holding a scope's
+// configuration and registry, which the system shares with every user.
+func DirMode(s string) os.FileMode {
+	if s == System {
+		return 0755
+	}
+	return 0750
+}
+
+// FileMode returns the permissions of a scope's configuration and registry
+// files, which every user must be able to read in the system scope.
+func FileMode(s string) os.FileMode {
+	if s == System {
+		return 0644
+	}
+	return 0600
+}
+
+// DefaultInstallDir returns the directory executables are installed into
+// when a scope's configuration does not say otherwise.
+func DefaultInstallDir(s string) (string, error) {
+	if s == System {
+		if runtime.GOOS == "windows" {
+			return filepath.Join(os.Getenv("ProgramFiles"), "execman", "bin"), nil
+		}
+		return filepath.Join("/usr", "local", "bin"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "bin"), nil
+}
@@ -0,0 +1,685 @@
+// Package signature verifies the signatures that projects publish alongside
+// their release assets.
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Verification methods, as recorded in the registry.
+const (
+	MethodCosignKeyless = "cosign-keyless"
+	MethodCosignKey     = "cosign-key"
+)
+
+// ErrUntrusted is returned when a signature is present but does not verify:
+// it is invalid, or was made by someone other than the trusted signer.
+var ErrUntrusted = errors.New("signature verification failed")
+
+// ErrNotConfigured is returned when there is nothing to verify a signature
+// against, because no trusted identity or key is configured.
+var ErrNotConfigured = errors.New("no trusted signer is configured")
+
+// Fulcio certificate extensions that record the OIDC issuer. The first is
+// deprecated but still present in older certificates.
+var (
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CosignTrust describes who is trusted to sign a source's releases.
+type CosignTrust struct {
+	// Identity is the exact certificate identity expected of a keyless
+	// signature, such as a GitHub Actions workflow URI.
+	Identity string
+	// IdentityRegexp matches the certificate identity when Identity is not
+	// set. It must match the whole identity.
+	IdentityRegexp string
+	// Issuer is the OIDC issuer expected of a keyless signature, such as
+	// "https://token.actions.githubusercontent.com".
+	Issuer string
+	// PublicKey verifies key-based signatures.
+	PublicKey crypto.PublicKey
+	// Roots are the Sigstore (Fulcio) root and intermediate certificates
+	// that keyless signing certificates must chain to.
+	Roots []*x509.Certificate
+	// RekorKey is the transparency log's key. Keyless signatures must have
+	// been recorded in the log while their certificate was valid, so they
+	// cannot be verified without it.
+	RekorKey crypto.PublicKey
+}
+
+// CosignMaterial holds the signature files published for an artifact: either
+// a bundle, or a signature with an optional certificate.
+type CosignMaterial struct {
+	Bundle      []byte
+	Signature   []byte
+	Certificate []byte
+}
+
+// Result describes a verified signature.
+type Result struct {
+	Method   string
+	Identity string
+	Issuer   string
+	KeyID    string
+}
+
+// LogEntry is a Rekor transparency log entry with its signed entry
+// timestamp, which shows that the log recorded the entry at IntegratedTime.
+type LogEntry struct {
+	// Body is the base64-encoded canonical entry.
+	Body           string
+	IntegratedTime int64
+	LogIndex       int64
+	LogID          string
+	// SET is the signed entry timestamp.
+	SET []byte
+}
+
+// BundleLogEntry is a transparency log entry as a Sigstore bundle records it.
+type BundleLogEntry struct {
+	LogIndex string `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   string `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	CanonicalizedBody string `json:"canonicalizedBody"`
+}
+
+// Entry returns the log entry, or nil if the bundle has no signed entry
+// timestamp for it.
+func (e *BundleLogEntry) Entry() (*LogEntry, error) {
+	if e.InclusionPromise == nil {
+		return nil, nil
+	}
+	integratedTime, err := strconv.ParseInt(e.IntegratedTime, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed transparency log entry: %w", err)
+	}
+	logIndex, err := strconv.ParseInt(e.LogIndex, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed transparency log entry: %w", err)
+	}
+	return &LogEntry{
+		Body:           e.CanonicalizedBody,
+		IntegratedTime: integratedTime,
+		LogIndex:       logIndex,
+		LogID:          hex.EncodeToString(e.LogID.KeyID),
+		SET:            e.InclusionPromise.SignedEntryTimestamp,
+	}, nil
+}
+
+// parsedMaterial is signature material decoded from its various encodings.
+type parsedMaterial struct {
+	signature   []byte
+	certificate *x509.Certificate
+	digest      []byte
+	tlog        *LogEntry
+}
+
+// VerifyCosign verifies a cosign signature of the file at artifactPath.
+// Keyless signatures must carry a certificate that chains to the trusted
+// roots and names the trusted identity and issuer, and a transparency log
+// entry made while the certificate was valid; other signatures must verify
+// with the trusted public key. Verification needs no network access.
+func VerifyCosign(artifactPath string, material CosignMaterial, trust CosignTrust) (*Result, error) {
+	parsed, err := parseMaterial(material)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := fileDigest(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.digest != nil && !bytes.Equal(parsed.digest, digest) {
+		return nil, fmt.Errorf("%w: bundle is for a different artifact", ErrUntrusted)
+	}
+
+	if parsed.certificate == nil {
+		return verifyWithKey(artifactPath, digest, parsed, trust)
+	}
+	return verifyKeyless(artifactPath, digest, parsed, trust)
+}
+
+// verifyWithKey verifies a signature against the trusted public key.
+func verifyWithKey(artifactPath string, digest []byte, parsed *parsedMaterial, trust CosignTrust) (*Result, error) {
+	if trust.PublicKey == nil {
+		return nil, fmt.Errorf("%w: the signature has no certificate and no public key is configured", ErrNotConfigured)
+	}
+	if err := verifySignature(trust.PublicKey, artifactPath, digest, parsed.signature); err != nil {
+		return nil, err
+	}
+	keyID, err := KeyID(trust.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Method: MethodCosignKey, KeyID: keyID}, nil
+}
+
+// verifyKeyless verifies a signature made with a short-lived Fulcio
+// certificate.
+func verifyKeyless(artifactPath string, digest []byte, parsed *parsedMaterial, trust CosignTrust) (*Result, error) {
+	if trust.Identity == "" && trust.IdentityRegexp == "" {
+		return nil, fmt.Errorf("%w: no certificate identity is configured", ErrNotConfigured)
+	}
+	if trust.Issuer == "" {
+		return nil, fmt.Errorf("%w: no certificate issuer is configured", ErrNotConfigured)
+	}
+	if len(trust.Roots) == 0 {
+		return nil, fmt.Errorf("%w: no Sigstore root certificates are configured", ErrNotConfigured)
+	}
+	if trust.RekorKey == nil {
+		return nil, fmt.Errorf("%w: no transparency log key is configured", ErrNotConfigured)
+	}
+
+	cert := parsed.certificate
+	if err := verifySignature(cert.PublicKey, artifactPath, digest, parsed.signature); err != nil {
+		return nil, err
+	}
+
+	// Signing certificates are only valid for a few minutes, so the chain is
+	// checked at the time the transparency log recorded the signature.
+	body, signedAt, err := VerifyLogEntry(parsed.tlog, trust.RekorKey, cert)
+	if err != nil {
+		return nil, err
+	}
+	if err := matchHashedRekord(body, digest, parsed.signature, cert); err != nil {
+		return nil, err
+	}
+
+	if err := verifyChain(cert, trust.Roots, signedAt); err != nil {
+		return nil, err
+	}
+
+	identity, err := matchIdentity(cert, trust)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := certificateIssuer(cert)
+	if err != nil {
+		return nil, err
+	}
+	if issuer != trust.Issuer {
+		return nil, fmt.Errorf("%w: certificate issuer is %q, expected %q", ErrUntrusted, issuer, trust.Issuer)
+	}
+
+	return &Result{Method: MethodCosignKeyless, Identity: identity, Issuer: issuer}, nil
+}
+
+// verifyChain checks that a signing certificate chains to the trusted roots
+// and was valid at the given time.
+func verifyChain(cert *x509.Certificate, trusted []*x509.Certificate, at time.Time) error {
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for _, c := range trusted {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return fmt.Errorf("%w: untrusted certificate: %v", ErrUntrusted, err)
+	}
+	return nil
+}
+
+// VerifyKeylessMessage verifies a signature of message made with a Fulcio
+// signing certificate that chained to the trusted roots at signedAt, the time
+// a transparency log recorded the signature, and returns the certificate's
+// identity and OIDC issuer for the caller to check.
+func VerifyKeylessMessage(message, sig []byte, cert *x509.Certificate, roots []*x509.Certificate, signedAt time.Time) (identity, issuer string, err error) {
+	if len(roots) == 0 {
+		return "", "", fmt.Errorf("%w: no Sigstore root certificates are configured", ErrNotConfigured)
+	}
+	if err := verifyChain(cert, roots, signedAt); err != nil {
+		return "", "", err
+	}
+
+	digest := sha256.Sum256(message)
+	var ok bool
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, sig)
+	default:
+		return "", "", fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("%w: invalid signature", ErrUntrusted)
+	}
+
+	issuer, err = certificateIssuer(cert)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case len(cert.URIs) > 0:
+		identity = cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		identity = cert.EmailAddresses[0]
+	}
+	return identity, issuer, nil
+}
+
+// CertificateExtension returns the string value of a Fulcio certificate
+// extension, such as the source repository URI, or "" if it is absent.
+func CertificateExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) string {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			var value string
+			if _, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				return ""
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// matchIdentity returns the certificate identity that matches the trusted
+// identity.
+func matchIdentity(cert *x509.Certificate, trust CosignTrust) (string, error) {
+	var identities []string
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.EmailAddresses...)
+
+	var re *regexp.Regexp
+	if trust.Identity == "" {
+		var err error
+		re, err = regexp.Compile("^(?:" + trust.IdentityRegexp + ")$")
+		if err != nil {
+			return "", fmt.Errorf("invalid certificate identity pattern: %w", err)
+		}
+	}
+
+	for _, identity := range identities {
+		if identity == trust.Identity || (re != nil && re.MatchString(identity)) {
+			return identity, nil
+		}
+	}
+	return "", fmt.Errorf("%w: certificate identity %v does not match the trusted identity", ErrUntrusted, identities)
+}
+
+// certificateIssuer returns the OIDC issuer recorded in a Fulcio certificate.
+func certificateIssuer(cert *x509.Certificate) (string, error) {
+	var legacy string
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err != nil {
+				return "", fmt.Errorf("%w: malformed issuer extension: %v", ErrUntrusted, err)
+			}
+			return issuer, nil
+		case ext.Id.Equal(oidIssuerV1):
+			legacy = string(ext.Value)
+		}
+	}
+	if legacy == "" {
+		return "", fmt.Errorf("%w: certificate does not record an OIDC issuer", ErrUntrusted)
+	}
+	return legacy, nil
+}
+
+// verifySignature verifies a signature of an artifact, given its SHA256
+// digest. Ed25519 signatures cover the whole artifact rather than a digest.
+func verifySignature(pub crypto.PublicKey, artifactPath string, digest, sig []byte) error {
+	var ok bool
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil
+	case ed25519.PublicKey:
+		// #nosec G304 -- Reading a downloaded artifact from the cache
+		message, err := os.ReadFile(artifactPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", artifactPath, err)
+		}
+		ok = ed25519.Verify(key, message, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return fmt.Errorf("%w: invalid signature", ErrUntrusted)
+	}
+	return nil
+}
+
+// VerifyLogEntry checks the signed entry timestamp of a transparency log
+// entry, and that the log recorded the entry while cert was valid. It returns
+// the decoded entry, for the caller to check that it records the signature
+// being verified, and the time it was recorded.
+func VerifyLogEntry(entry *LogEntry, rekorKey crypto.PublicKey, cert *x509.Certificate) ([]byte, time.Time, error) {
+	if rekorKey == nil {
+		return nil, time.Time{}, fmt.Errorf("%w: no transparency log key is configured", ErrNotConfigured)
+	}
+	if entry == nil {
+		return nil, time.Time{}, fmt.Errorf("%w: the signature has no transparency log entry", ErrUntrusted)
+	}
+
+	// The timestamp signs the canonical JSON form of the entry, whose keys
+	// are in sorted order.
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to encode transparency log entry: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	key, ok := rekorKey.(*ecdsa.PublicKey)
+	if !ok || !ecdsa.VerifyASN1(key, sum[:], entry.SET) {
+		return nil, time.Time{}, fmt.Errorf("%w: invalid transparency log timestamp", ErrUntrusted)
+	}
+
+	signedAt := time.Unix(entry.IntegratedTime, 0)
+	if signedAt.Before(cert.NotBefore) || signedAt.After(cert.NotAfter) {
+		return nil, time.Time{}, fmt.Errorf("%w: the signature was logged outside the certificate's validity period", ErrUntrusted)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(entry.Body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: malformed transparency log entry: %v", ErrUntrusted, err)
+	}
+	return body, signedAt, nil
+}
+
+// matchHashedRekord checks that a transparency log entry records this
+// signature of this artifact, made with this certificate. Otherwise the
+// entry's time says nothing about when the certificate was used.
+func matchHashedRekord(body, digest, sig []byte, cert *x509.Certificate) error {
+	var record struct {
+		Spec struct {
+			Signature struct {
+				Content   string `json:"content"`
+				PublicKey struct {
+					Content string `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return fmt.Errorf("%w: malformed transparency log entry: %v", ErrUntrusted, err)
+	}
+	if record.Spec.Data.Hash.Value != hex.EncodeToString(digest) ||
+		record.Spec.Signature.Content != base64.StdEncoding.EncodeToString(sig) {
+		return fmt.Errorf("%w: the transparency log entry is for a different signature", ErrUntrusted)
+	}
+	logged, err := ParseCertificate([]byte(record.Spec.Signature.PublicKey.Content))
+	if err != nil || !logged.Equal(cert) {
+		return fmt.Errorf("%w: the transparency log entry is for a different certificate", ErrUntrusted)
+	}
+	return nil
+}
+
+// parseMaterial decodes a bundle, or a signature and certificate.
+func parseMaterial(material CosignMaterial) (*parsedMaterial, error) {
+	if material.Bundle != nil {
+		return parseBundle(material.Bundle)
+	}
+	if material.Signature == nil {
+		return nil, errors.New("no signature was provided")
+	}
+
+	parsed := &parsedMaterial{signature: decodeSignature(material.Signature)}
+	if material.Certificate != nil {
+		cert, err := ParseCertificate(material.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		parsed.certificate = cert
+	}
+	return parsed, nil
+}
+
+// parseBundle decodes a Sigstore bundle or an older cosign bundle.
+func parseBundle(data []byte) (*parsedMaterial, error) {
+	var bundle struct {
+		// Sigstore bundle fields.
+		MediaType            string `json:"mediaType"`
+		VerificationMaterial struct {
+			Certificate *struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificate"`
+			X509CertificateChain *struct {
+				Certificates []struct {
+					RawBytes []byte `json:"rawBytes"`
+				} `json:"certificates"`
+			} `json:"x509CertificateChain"`
+			TlogEntries []BundleLogEntry `json:"tlogEntries"`
+		} `json:"verificationMaterial"`
+		MessageSignature *struct {
+			MessageDigest *struct {
+				Algorithm string `json:"algorithm"`
+				Digest    []byte `json:"digest"`
+			} `json:"messageDigest"`
+			Signature []byte `json:"signature"`
+		} `json:"messageSignature"`
+
+		// Cosign bundle fields.
+		Base64Signature string `json:"base64Signature"`
+		Cert            string `json:"cert"`
+		RekorBundle     *struct {
+			SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+			Payload              struct {
+				Body           string `json:"body"`
+				IntegratedTime int64  `json:"integratedTime"`
+				LogIndex       int64  `json:"logIndex"`
+				LogID          string `json:"logID"`
+			} `json:"Payload"`
+		} `json:"rekorBundle"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse signature bundle: %w", err)
+	}
+
+	parsed := &parsedMaterial{}
+	if bundle.MediaType != "" {
+		if bundle.MessageSignature == nil {
+			return nil, errors.New("signature bundle does not contain a message signature")
+		}
+		parsed.signature = bundle.MessageSignature.Signature
+		if d := bundle.MessageSignature.MessageDigest; d != nil && d.Algorithm == "SHA2_256" {
+			parsed.digest = d.Digest
+		}
+
+		vm := bundle.VerificationMaterial
+		var raw []byte
+		switch {
+		case vm.Certificate != nil:
+			raw = vm.Certificate.RawBytes
+		case vm.X509CertificateChain != nil && len(vm.X509CertificateChain.Certificates) > 0:
+			raw = vm.X509CertificateChain.Certificates[0].RawBytes
+		}
+		if raw != nil {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+			}
+			parsed.certificate = cert
+		}
+
+		if len(vm.TlogEntries) > 0 {
+			entry, err := vm.TlogEntries[0].Entry()
+			if err != nil {
+				return nil, err
+			}
+			parsed.tlog = entry
+		}
+		return parsed, nil
+	}
+
+	if bundle.Base64Signature == "" {
+		return nil, errors.New("signature bundle does not contain a signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(bundle.Base64Signature)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature in bundle: %w", err)
+	}
+	parsed.signature = sig
+	if bundle.Cert != "" {
+		cert, err := ParseCertificate([]byte(bundle.Cert))
+		if err != nil {
+			return nil, err
+		}
+		parsed.certificate = cert
+	}
+	if rb := bundle.RekorBundle; rb != nil {
+		parsed.tlog = &LogEntry{
+			Body:           rb.Payload.Body,
+			IntegratedTime: rb.Payload.IntegratedTime,
+			LogIndex:       rb.Payload.LogIndex,
+			LogID:          rb.Payload.LogID,
+			SET:            rb.SignedEntryTimestamp,
+		}
+	}
+	return parsed, nil
+}
+
+// decodeSignature decodes a signature file, which cosign writes in base64.
+func decodeSignature(data []byte) []byte {
+	if sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		return sig
+	}
+	return data
+}
+
+// ParseCertificate parses a PEM certificate, which cosign may also have
+// encoded in base64.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signing certificate: %w", err)
+		}
+		data = decoded
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// fileDigest returns the SHA256 digest of a file.
+func fileDigest(path string) ([]byte, error) {
+	// #nosec G304 -- Reading a downloaded artifact from the cache
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// KeyID returns an identifier for a public key: the SHA256 of its PKIX
+// encoding.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// LoadPublicKey reads a PEM encoded public key.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	// #nosec G304 -- Reading a key file named in the user's config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM encoded public key", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	return pub, nil
+}
+
+// LoadCertificates reads the PEM encoded certificates in a file.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	// #nosec G304 -- Reading a certificate file named in the user's config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificates: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s contains no certificates", path)
+	}
+	return certs, nil
+}
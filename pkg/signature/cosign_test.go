@@ -0,0 +1,439 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testIdentity = "https://github.com/owner/tool/.github/workflows/release.yml@refs/tags/v1.0.0"
+	testIssuer   = "https://token.actions.githubusercontent.com"
+)
+
+// fixture is a Fulcio-like certificate authority and a signing certificate
+// issued by it.
+type fixture struct {
+	root     *x509.Certificate
+	leaf     *x509.Certificate
+	leafKey  *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newFixture(t *testing.T, identity, issuer string) *fixture {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio-root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := url.Parse(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerValue, err := asn1.Marshal(issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{uri},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuerV2, Value: issuerValue},
+		},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{root: root, leaf: leaf, leafKey: leafKey, rekorKey: rekorKey}
+}
+
+// sign signs an artifact with the fixture's signing key.
+func (f *fixture) sign(t *testing.T, artifact []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(artifact)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.leafKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// certPEM returns the signing certificate as cosign writes it: base64
+// encoded PEM.
+func (f *fixture) certPEM() []byte {
+	p := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.leaf.Raw})
+	return []byte(base64.StdEncoding.EncodeToString(p))
+}
+
+// hashedRekord returns the canonical transparency log entry recording a
+// signature of an artifact made with a certificate.
+func hashedRekord(t *testing.T, artifact, sig []byte, cert *x509.Certificate) []byte {
+	t.Helper()
+	digest := sha256.Sum256(artifact)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"signature": map[string]any{
+				"content":   base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString(certPEM)},
+			},
+			"data": map[string]any{
+				"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// logEntry returns a transparency log entry for body, logged at the given
+// time, with its signed entry timestamp.
+func (f *fixture) logEntry(t *testing.T, body []byte, at time.Time) *LogEntry {
+	t.Helper()
+	entry := &LogEntry{Body: base64.StdEncoding.EncodeToString(body), IntegratedTime: at.Unix(), LogID: "abcd", LogIndex: 42}
+	canonical, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(canonical)
+	entry.SET, err = ecdsa.SignASN1(rand.Reader, f.rekorKey, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// cosignBundle builds a cosign bundle with a transparency log entry.
+func (f *fixture) cosignBundle(t *testing.T, artifact, sig []byte) []byte {
+	t.Helper()
+	entry := f.logEntry(t, hashedRekord(t, artifact, sig, f.leaf), time.Now())
+	bundle, err := json.Marshal(map[string]any{
+		"base64Signature": base64.StdEncoding.EncodeToString(sig),
+		"cert":            string(f.certPEM()),
+		"rekorBundle": map[string]any{
+			"SignedEntryTimestamp": entry.SET,
+			"Payload": map[string]any{
+				"body":           entry.Body,
+				"integratedTime": entry.IntegratedTime,
+				"logID":          entry.LogID,
+				"logIndex":       entry.LogIndex,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+// sigstoreBundle builds a Sigstore bundle with a transparency log entry
+// logged at the given time, or none if the time is zero.
+func (f *fixture) sigstoreBundle(t *testing.T, artifact, sig []byte, loggedAt time.Time) []byte {
+	t.Helper()
+	var entry *LogEntry
+	if !loggedAt.IsZero() {
+		entry = f.logEntry(t, hashedRekord(t, artifact, sig, f.leaf), loggedAt)
+	}
+	return f.sigstoreBundleWithEntry(t, artifact, sig, entry)
+}
+
+// sigstoreBundleWithEntry builds a Sigstore bundle with the given
+// transparency log entry, if any.
+func (f *fixture) sigstoreBundleWithEntry(t *testing.T, artifact, sig []byte, entry *LogEntry) []byte {
+	t.Helper()
+	digest := sha256.Sum256(artifact)
+	material := map[string]any{
+		"certificate": map[string]any{"rawBytes": f.leaf.Raw},
+	}
+	if entry != nil {
+		logID, err := hex.DecodeString(entry.LogID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		material["tlogEntries"] = []any{map[string]any{
+			"logIndex":          "42",
+			"logId":             map[string]any{"keyId": logID},
+			"integratedTime":    fmt.Sprint(entry.IntegratedTime),
+			"inclusionPromise":  map[string]any{"signedEntryTimestamp": entry.SET},
+			"canonicalizedBody": entry.Body,
+		}}
+	}
+	bundle, err := json.Marshal(map[string]any{
+		"mediaType":            "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": material,
+		"messageSignature": map[string]any{
+			"messageDigest": map[string]any{"algorithm": "SHA2_256", "digest": digest[:]},
+			"signature":     sig,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func writeArtifact(t *testing.T, content []byte) string {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "execman-signature-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	path := filepath.Join(tmpDir, "checksums.txt")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyCosignKeyless(t *testing.T) {
+	artifact := []byte("abc123  tool_linux_amd64.tar.gz\n")
+	path := writeArtifact(t, artifact)
+
+	f := newFixture(t, testIdentity, testIssuer)
+	sig := f.sign(t, artifact)
+	other := newFixture(t, testIdentity, testIssuer)
+
+	now := time.Now()
+	rekorKey := &f.rekorKey.PublicKey
+	trust := CosignTrust{Identity: testIdentity, Issuer: testIssuer, Roots: []*x509.Certificate{f.root}, RekorKey: rekorKey}
+
+	tests := []struct {
+		name     string
+		material CosignMaterial
+		trust    CosignTrust
+		wantErr  error
+	}{
+		{
+			name:     "cosign bundle",
+			material: CosignMaterial{Bundle: f.cosignBundle(t, artifact, sig)},
+			trust:    trust,
+		},
+		{
+			name:     "sigstore bundle",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    trust,
+		},
+		{
+			name:     "identity pattern",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust: CosignTrust{
+				IdentityRegexp: `https://github\.com/owner/tool/\.github/workflows/release\.yml@refs/tags/v.*`,
+				Issuer:         testIssuer,
+				Roots:          []*x509.Certificate{f.root},
+				RekorKey:       rekorKey,
+			},
+		},
+		{
+			name:     "wrong identity",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: "https://github.com/attacker/tool/.github/workflows/release.yml@refs/tags/v1.0.0", Issuer: testIssuer, Roots: []*x509.Certificate{f.root}, RekorKey: rekorKey},
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "identity pattern must match whole identity",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{IdentityRegexp: `https://github\.com/owner/tool`, Issuer: testIssuer, Roots: []*x509.Certificate{f.root}, RekorKey: rekorKey},
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "wrong issuer",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: testIdentity, Issuer: "https://accounts.google.com", Roots: []*x509.Certificate{f.root}, RekorKey: rekorKey},
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "untrusted root",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: testIdentity, Issuer: testIssuer, Roots: []*x509.Certificate{other.root}, RekorKey: rekorKey},
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "signature by another key",
+			material: CosignMaterial{Signature: other.sign(t, artifact), Certificate: f.certPEM()},
+			trust:    trust,
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "bundle for another artifact",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, []byte("other"), sig, now)},
+			trust:    trust,
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "transparency log entry required",
+			material: CosignMaterial{Signature: []byte(base64.StdEncoding.EncodeToString(sig)), Certificate: f.certPEM()},
+			trust:    trust,
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "logged after the certificate expired",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now.Add(time.Hour))},
+			trust:    trust,
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "logged with another certificate",
+			material: CosignMaterial{Bundle: f.sigstoreBundleWithEntry(t, artifact, sig, f.logEntry(t, hashedRekord(t, artifact, sig, other.leaf), now))},
+			trust:    trust,
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "timestamp from another log",
+			material: CosignMaterial{Bundle: other.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: testIdentity, Issuer: testIssuer, Roots: []*x509.Certificate{other.root}, RekorKey: rekorKey},
+			wantErr:  ErrUntrusted,
+		},
+		{
+			name:     "no transparency log key configured",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: testIdentity, Issuer: testIssuer, Roots: []*x509.Certificate{f.root}},
+			wantErr:  ErrNotConfigured,
+		},
+		{
+			name:     "no identity configured",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Roots: []*x509.Certificate{f.root}, RekorKey: rekorKey},
+			wantErr:  ErrNotConfigured,
+		},
+		{
+			name:     "no roots configured",
+			material: CosignMaterial{Bundle: f.sigstoreBundle(t, artifact, sig, now)},
+			trust:    CosignTrust{Identity: testIdentity, Issuer: testIssuer, RekorKey: rekorKey},
+			wantErr:  ErrNotConfigured,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyCosign(path, tt.material, tt.trust)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyCosign() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyCosign() unexpected error: %v", err)
+			}
+			if result.Method != MethodCosignKeyless || result.Identity != testIdentity || result.Issuer != testIssuer {
+				t.Errorf("VerifyCosign() = %+v", result)
+			}
+		})
+	}
+}
+
+func TestVerifyCosignKey(t *testing.T) {
+	artifact := []byte("release contents")
+	path := writeArtifact(t, artifact)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(artifact)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.PublicKey
+		wantErr error
+	}{
+		{"trusted key", &key.PublicKey, nil},
+		{"other key", &otherKey.PublicKey, ErrUntrusted},
+		{"no key", nil, ErrNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := VerifyCosign(path, CosignMaterial{Signature: encoded}, CosignTrust{PublicKey: tt.key})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyCosign() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyCosign() unexpected error: %v", err)
+			}
+			wantID, _ := KeyID(tt.key)
+			if result.Method != MethodCosignKey || result.KeyID != wantID {
+				t.Errorf("VerifyCosign() = %+v", result)
+			}
+		})
+	}
+}
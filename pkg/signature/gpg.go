@@ -0,0 +1,154 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// parseGPGKeys parses armored or binary OpenPGP public keys.
+func parseGPGKeys(data []byte) (openpgp.EntityList, error) {
+	const begin = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	if !bytes.Contains(data, []byte(begin)) {
+		keyring, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("not a GPG public key: %w", err)
+		}
+		return keyring, nil
+	}
+
+	// Key files such as those served by GitHub may hold several armored
+	// blocks, one per key.
+	var keyring openpgp.EntityList
+	for _, block := range bytes.Split(data, []byte(begin))[1:] {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(append([]byte(begin), block...)))
+		if err != nil {
+			return nil, fmt.Errorf("not a GPG public key: %w", err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	if len(keyring) == 0 {
+		return nil, errors.New("not a GPG public key")
+	}
+	return keyring, nil
+}
+
+// isGPGSignature reports whether data looks like an armored or binary
+// OpenPGP signature.
+func isGPGSignature(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP SIGNATURE-----")) {
+		return true
+	}
+	// Binary OpenPGP packets always have the top bit of the first byte set,
+	// which base64 encoded signatures never do.
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return false
+	}
+	_, err := readGPGSignature(data)
+	return err == nil
+}
+
+// gpgSignatureBody returns the binary form of an armored or binary signature.
+func gpgSignatureBody(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		return data, nil
+	}
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("malformed GPG signature: %w", err)
+	}
+	return io.ReadAll(block.Body)
+}
+
+// readGPGSignature parses the signature packet of a detached signature.
+func readGPGSignature(data []byte) (*packet.Signature, error) {
+	body, err := gpgSignatureBody(data)
+	if err != nil {
+		return nil, err
+	}
+	p, err := packet.Read(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("malformed GPG signature: %w", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, errors.New("malformed GPG signature: not a signature packet")
+	}
+	return sig, nil
+}
+
+// gpgSignerID identifies the key that made a signature, by fingerprint if the
+// signature records it and otherwise by key ID.
+func gpgSignerID(data []byte) string {
+	sig, err := readGPGSignature(data)
+	switch {
+	case err != nil:
+		return "unknown"
+	case sig.IssuerFingerprint != nil:
+		return strings.ToUpper(hex.EncodeToString(sig.IssuerFingerprint))
+	case sig.IssuerKeyId != nil:
+		return fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	default:
+		return "unknown"
+	}
+}
+
+// gpgFingerprint returns the fingerprint of an entity's primary key.
+func gpgFingerprint(entity *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint))
+}
+
+// verifyGPG verifies a detached GPG signature of the file at artifactPath and
+// returns the entity that made it.
+func verifyGPG(artifactPath string, sig []byte, keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	body, err := gpgSignatureBody(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G304 -- Reading a downloaded artifact from the cache
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", artifactPath, err)
+	}
+	defer f.Close()
+
+	signer, err := openpgp.CheckDetachedSignature(keyring, f, bytes.NewReader(body), nil)
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		var trusted []string
+		for _, entity := range keyring {
+			trusted = append(trusted, gpgFingerprint(entity))
+		}
+		return nil, fmt.Errorf("%w: signed by key %s, but %s is trusted",
+			ErrKeyChanged, gpgSignerID(sig), strings.Join(trusted, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrusted, err)
+	}
+	return signer, nil
+}
+
+// encodeGPGKey returns an entity's public key in armored form.
+func encodeGPGKey(entity *openpgp.Entity) (string, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode GPG key: %w", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		return "", fmt.Errorf("failed to encode GPG key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode GPG key: %w", err)
+	}
+	return buf.String(), nil
+}
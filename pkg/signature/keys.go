@@ -0,0 +1,128 @@
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Verification methods for detached signatures made with a publisher's key.
+const (
+	MethodMinisign = "minisign"
+	MethodGPG      = "gpg"
+)
+
+// ErrKeyChanged is returned when a signature was made by a key other than
+// the trusted one, which may mean the publisher's key has been replaced.
+var ErrKeyChanged = errors.New("signed with a different key than the trusted one")
+
+// PublicKey is a publisher's minisign or GPG public key.
+type PublicKey struct {
+	// Type is MethodMinisign or MethodGPG.
+	Type     string
+	minisign *minisignKey
+	gpg      openpgp.EntityList
+}
+
+// ParsePublicKey parses a minisign public key, or one or more armored or
+// binary GPG public keys.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	if key, err := parseMinisignKey(data); err == nil {
+		return &PublicKey{Type: MethodMinisign, minisign: key}, nil
+	}
+	if keyring, err := parseGPGKeys(data); err == nil {
+		return &PublicKey{Type: MethodGPG, gpg: keyring}, nil
+	}
+	return nil, errors.New("not a minisign or GPG public key")
+}
+
+// ID identifies the key: a minisign key ID, or GPG primary key fingerprints.
+func (k *PublicKey) ID() string {
+	if k.minisign != nil {
+		return minisignKeyID(k.minisign.id)
+	}
+	var ids []string
+	for _, entity := range k.gpg {
+		ids = append(ids, gpgFingerprint(entity))
+	}
+	return strings.Join(ids, ",")
+}
+
+// Encode returns the key in a form that ParsePublicKey accepts.
+func (k *PublicKey) Encode() (string, error) {
+	if k.minisign != nil {
+		return k.minisign.encode(), nil
+	}
+	var blocks []string
+	for _, entity := range k.gpg {
+		block, err := encodeGPGKey(entity)
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, block)
+	}
+	return strings.Join(blocks, ""), nil
+}
+
+// DetachedType returns the kind of a detached signature: MethodMinisign,
+// MethodGPG, or "" if it is neither.
+func DetachedType(sig []byte) string {
+	switch {
+	case isMinisignSignature(sig):
+		return MethodMinisign
+	case isGPGSignature(sig):
+		return MethodGPG
+	default:
+		return ""
+	}
+}
+
+// VerifyDetached verifies a minisign or GPG signature of the file at
+// artifactPath against a trusted key. It returns the key that made the
+// signature, which for GPG is narrowed down from the trusted keyring.
+// A signature by any other key is reported with ErrKeyChanged.
+func VerifyDetached(artifactPath string, sig []byte, key *PublicKey) (*PublicKey, error) {
+	sigType := DetachedType(sig)
+	if sigType == "" {
+		return nil, errors.New("not a minisign or GPG signature")
+	}
+	if sigType != key.Type {
+		return nil, fmt.Errorf("%w: signed with %s, but a %s key is trusted", ErrKeyChanged, sigType, key.Type)
+	}
+
+	if sigType == MethodMinisign {
+		parsed, err := parseMinisignSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyMinisign(artifactPath, parsed, key.minisign); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	signer, err := verifyGPG(artifactPath, sig, key.gpg)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{Type: MethodGPG, gpg: openpgp.EntityList{signer}}, nil
+}
+
+// DetachedSignerID identifies the key that made a detached signature, for
+// reporting which key a release is signed with when it is not trusted.
+func DetachedSignerID(sig []byte) string {
+	switch DetachedType(sig) {
+	case MethodMinisign:
+		parsed, err := parseMinisignSignature(sig)
+		if err != nil {
+			return "unknown"
+		}
+		return minisignKeyID(parsed.keyID)
+	case MethodGPG:
+		return gpgSignerID(sig)
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,175 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignFixture is a minisign key pair.
+type minisignFixture struct {
+	id   [8]byte
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newMinisignFixture(t *testing.T) *minisignFixture {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &minisignFixture{pub: pub, priv: priv}
+	if _, err := rand.Read(f.id[:]); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// publicKey returns the key as written by "minisign -G".
+func (f *minisignFixture) publicKey() []byte {
+	raw := append([]byte("Ed"), f.id[:]...)
+	encoded := base64.StdEncoding.EncodeToString(append(raw, f.pub...))
+	return []byte("untrusted comment: minisign public key\n" + encoded + "\n")
+}
+
+// sign returns a ".minisig" file for content.
+func (f *minisignFixture) sign(content []byte, prehashed bool) []byte {
+	algorithm := "Ed"
+	message := content
+	if prehashed {
+		algorithm = "ED"
+		sum := blake2b.Sum512(content)
+		message = sum[:]
+	}
+	sig := ed25519.Sign(f.priv, message)
+	comment := "timestamp:1700000000\tfile:checksums.txt"
+	global := ed25519.Sign(f.priv, append(append([]byte{}, sig...), comment...))
+
+	raw := append(append([]byte(algorithm), f.id[:]...), sig...)
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func newGPGFixture(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Release Signer", "", "release@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodeGPGKey(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity, []byte(encoded)
+}
+
+func gpgSign(t *testing.T, entity *openpgp.Entity, content []byte, armored bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if armored {
+		err = openpgp.ArmoredDetachSign(&buf, entity, bytes.NewReader(content), nil)
+	} else {
+		err = openpgp.DetachSign(&buf, entity, bytes.NewReader(content), nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyDetached(t *testing.T) {
+	content := []byte("abc123  tool_linux_amd64.tar.gz\n")
+	path := writeArtifact(t, content)
+
+	minisignKey := newMinisignFixture(t)
+	otherMinisignKey := newMinisignFixture(t)
+	gpgEntity, gpgKey := newGPGFixture(t)
+	otherGPGEntity, otherGPGKey := newGPGFixture(t)
+
+	tests := []struct {
+		name    string
+		sig     []byte
+		key     []byte
+		wantErr error
+	}{
+		{name: "minisign prehashed", sig: minisignKey.sign(content, true), key: minisignKey.publicKey()},
+		{name: "minisign legacy", sig: minisignKey.sign(content, false), key: minisignKey.publicKey()},
+		{name: "minisign tampered", sig: minisignKey.sign([]byte("other"), true), key: minisignKey.publicKey(), wantErr: ErrUntrusted},
+		{name: "minisign key changed", sig: otherMinisignKey.sign(content, true), key: minisignKey.publicKey(), wantErr: ErrKeyChanged},
+		{name: "gpg armored", sig: gpgSign(t, gpgEntity, content, true), key: gpgKey},
+		{name: "gpg binary", sig: gpgSign(t, gpgEntity, content, false), key: gpgKey},
+		{name: "gpg tampered", sig: gpgSign(t, gpgEntity, []byte("other"), false), key: gpgKey, wantErr: ErrUntrusted},
+		{name: "gpg key changed", sig: gpgSign(t, otherGPGEntity, content, true), key: gpgKey, wantErr: ErrKeyChanged},
+		{name: "gpg keyring", sig: gpgSign(t, otherGPGEntity, content, true), key: append(append([]byte{}, gpgKey...), otherGPGKey...)},
+		{name: "signature type changed", sig: gpgSign(t, gpgEntity, content, true), key: minisignKey.publicKey(), wantErr: ErrKeyChanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePublicKey(tt.key)
+			if err != nil {
+				t.Fatalf("ParsePublicKey() error: %v", err)
+			}
+			signer, err := VerifyDetached(path, tt.sig, key)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyDetached() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDetached() unexpected error: %v", err)
+			}
+			if signer.ID() != DetachedSignerID(tt.sig) && signer.Type == MethodMinisign {
+				t.Errorf("signer ID = %s, signature key ID = %s", signer.ID(), DetachedSignerID(tt.sig))
+			}
+
+			// The signer's key round-trips, so that it can be pinned.
+			encoded, err := signer.Encode()
+			if err != nil {
+				t.Fatalf("Encode() error: %v", err)
+			}
+			pinned, err := ParsePublicKey([]byte(encoded))
+			if err != nil {
+				t.Fatalf("ParsePublicKey(Encode()) error: %v", err)
+			}
+			if pinned.ID() != signer.ID() || bytes.Contains([]byte(pinned.ID()), []byte(",")) {
+				t.Errorf("pinned key ID = %s, want %s", pinned.ID(), signer.ID())
+			}
+		})
+	}
+}
+
+func TestDetachedType(t *testing.T) {
+	entity, _ := newGPGFixture(t)
+	content := []byte("content")
+
+	tests := []struct {
+		name string
+		sig  []byte
+		want string
+	}{
+		{"minisign", newMinisignFixture(t).sign(content, true), MethodMinisign},
+		{"gpg armored", gpgSign(t, entity, content, true), MethodGPG},
+		{"gpg binary", gpgSign(t, entity, content, false), MethodGPG},
+		{"cosign base64", []byte("MEUCIQDx1vUQ3i1ySaZ+5XlXtuS0ks2lvBe2gEmV3ek5tsuSXgIgF8t3Xw=="), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetachedType(tt.sig); got != tt.want {
+				t.Errorf("DetachedType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Minisign signature algorithms: "Ed" signs the file itself, "ED" signs its
+// BLAKE2b-512 hash.
+const (
+	minisignLegacy    = "Ed"
+	minisignPrehashed = "ED"
+)
+
+// minisignKey is a minisign public key.
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+// minisignSignature is a parsed ".minisig" file.
+type minisignSignature struct {
+	algorithm      string
+	keyID          [8]byte
+	signature      []byte
+	trustedComment string
+	globalSig      []byte
+}
+
+// parseMinisignKey parses a minisign public key, either a key file or the
+// bare base64 line printed by "minisign -G".
+func parseMinisignKey(data []byte) (*minisignKey, error) {
+	var encoded string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		encoded = line
+		break
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != minisignLegacy {
+		return nil, errors.New("not a minisign public key")
+	}
+	k := &minisignKey{key: ed25519.PublicKey(raw[10:])}
+	copy(k.id[:], raw[2:10])
+	return k, nil
+}
+
+// encode returns the key in the form printed by "minisign -G".
+func (k *minisignKey) encode() string {
+	raw := append([]byte(minisignLegacy), k.id[:]...)
+	return base64.StdEncoding.EncodeToString(append(raw, k.key...))
+}
+
+// minisignKeyID formats a key ID the way minisign displays it.
+func minisignKeyID(id [8]byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id[:]))
+}
+
+// isMinisignSignature reports whether data looks like a ".minisig" file.
+func isMinisignSignature(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("untrusted comment:"))
+}
+
+// parseMinisignSignature parses a ".minisig" file.
+func parseMinisignSignature(data []byte) (*minisignSignature, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		return nil, errors.New("malformed minisign signature")
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign signature")
+	}
+	sig := &minisignSignature{algorithm: string(raw[:2]), signature: raw[10:]}
+	copy(sig.keyID[:], raw[2:10])
+	if sig.algorithm != minisignLegacy && sig.algorithm != minisignPrehashed {
+		return nil, fmt.Errorf("unsupported minisign signature algorithm %q", sig.algorithm)
+	}
+
+	comment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return nil, errors.New("malformed minisign trusted comment")
+	}
+	sig.trustedComment = comment
+	sig.globalSig, err = base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(sig.globalSig) != ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign global signature")
+	}
+	return sig, nil
+}
+
+// verifyMinisign verifies a minisign signature of the file at artifactPath.
+func verifyMinisign(artifactPath string, sig *minisignSignature, key *minisignKey) error {
+	if sig.keyID != key.id {
+		return fmt.Errorf("%w: signed by key %s, but key %s is trusted",
+			ErrKeyChanged, minisignKeyID(sig.keyID), minisignKeyID(key.id))
+	}
+
+	// #nosec G304 -- Reading a downloaded artifact from the cache
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", artifactPath, err)
+	}
+	defer f.Close()
+
+	var message []byte
+	if sig.algorithm == minisignPrehashed {
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", artifactPath, err)
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return fmt.Errorf("failed to read %s: %w", artifactPath, err)
+		}
+		message = h.Sum(nil)
+	} else {
+		message, err = io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", artifactPath, err)
+		}
+	}
+
+	if !ed25519.Verify(key.key, message, sig.signature) {
+		return fmt.Errorf("%w: invalid minisign signature", ErrUntrusted)
+	}
+	// The global signature covers the trusted comment, which minisign uses to
+	// record e.g. the file name and timestamp.
+	global := append(append([]byte{}, sig.signature...), sig.trustedComment...)
+	if !ed25519.Verify(key.key, global, sig.globalSig) {
+		return fmt.Errorf("%w: invalid minisign trusted comment signature", ErrUntrusted)
+	}
+	return nil
+}
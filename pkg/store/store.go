@@ -0,0 +1,60 @@
+// Package store locates the versioned store, in which several versions of an
+// executable are kept side by side, each in a directory of its own.
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+// Root returns the directory of the current scope's versioned store.
+func Root() (string, error) {
+	return ScopeRoot(scope.Current())
+}
+
+// ScopeRoot returns the directory of a scope's versioned store.
+func ScopeRoot(s string) (string, error) {
+	dataDir, err := scope.DataDir(s)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "store"), nil
+}
+
+// Dir returns the directory that holds one version of an executable:
+// <root>/<name>/<version>.
+func Dir(name, version string) (string, error) {
+	for _, part := range []string{name, version} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", fmt.Errorf("invalid store entry %q", part)
+		}
+	}
+	root, err := Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, name, version), nil
+}
+
+// Contains reports whether path lies inside the store rooted at root.
+func Contains(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// RemoveEmpty removes the version and name directories that held an
+// executable at path in the store, if they are left empty.
+func RemoveEmpty(path string) {
+	root, err := Root()
+	if err != nil || !Contains(root, path) {
+		return
+	}
+	versionDir := filepath.Dir(path)
+	if os.Remove(versionDir) == nil {
+		_ = os.Remove(filepath.Dir(versionDir))
+	}
+}
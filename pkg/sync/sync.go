@@ -0,0 +1,489 @@
+// Package sync brings the managed executables into line with a manifest.
+package sync
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/fetch"
+	"github.com/sfkleach/execman/pkg/install"
+	"github.com/sfkleach/execman/pkg/list"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/remove"
+	"github.com/spf13/cobra"
+)
+
+// Options represents the sync command options.
+type Options struct {
+	Manifest string
+	DryRun   bool
+	Prune    bool
+	Yes      bool
+	// Frozen installs exactly the releases and downloads recorded in the
+	// manifest's lockfile, and fails if that cannot be done.
+	Frozen bool
+}
+
+// Kinds of action in a sync plan.
+const (
+	ActionInstall   = "install"
+	ActionUpdate    = "update"
+	ActionDowngrade = "downgrade"
+	// ActionReinstall replaces an executable whose version is locked but
+	// whose contents differ from the lockfile.
+	ActionReinstall = "reinstall"
+	ActionRemove    = "remove"
+	ActionKeep      = "keep"
+	// ActionSkip marks a tool that cannot be synced, such as one whose name
+	// is taken by an executable from another source.
+	ActionSkip = "skip"
+)
+
+// Action is one step of a sync plan.
+type Action struct {
+	Kind   string
+	Name   string
+	Source string
+	// From is the installed version, if any.
+	From string
+	// To is the version to install.
+	To string
+	// Into is the directory, or @name location, to install into.
+	Into string
+	// Note explains a skip, or warns about a kept executable.
+	Note string
+	// Locked is the download the lockfile records, when syncing frozen.
+	Locked *manifest.LockedAsset
+	// Asset is the name of the download that will be installed, if it has
+	// been looked up.
+	Asset string
+	// ChecksumPolicy and SignaturePolicy are the manifest's overrides of
+	// the configured policies, which may only be stricter.
+	ChecksumPolicy  string
+	SignaturePolicy string
+}
+
+// Changes reports whether the action changes anything.
+func (a Action) Changes() bool {
+	return a.Kind != ActionKeep && a.Kind != ActionSkip
+}
+
+// Resolver returns the release tag that a tool should be installed at.
+type Resolver func(tool *manifest.Tool) (string, error)
+
+// NewSyncCommand creates the sync command.
+func NewSyncCommand() *cobra.Command {
+	var manifestPath string
+	var dryRun bool
+	var prune bool
+	var yes bool
+	var frozen bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Install, update and remove executables to match a manifest",
+		Long: `Bring the managed executables into line with a manifest: install the tools
+it lists that are missing, update or downgrade those whose version does not
+satisfy its constraint and, with --prune, remove executables it does not list.
+The plan is shown before anything is changed.
+
+With --frozen, the releases and downloads recorded by 'execman lock' are
+installed exactly, and sync fails if the lockfile is missing, out of date,
+or does not match what is downloaded.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return Run(Options{
+				Manifest: manifestPath,
+				DryRun:   dryRun,
+				Prune:    prune,
+				Yes:      yes,
+				Frozen:   frozen,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&manifestPath, "manifest", "f", manifest.DefaultPath, "Manifest file to sync with")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Show the plan without changing anything")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Remove managed executables the manifest does not list")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	cmd.Flags().BoolVar(&frozen, "frozen", false, "Install exactly what the lockfile records")
+
+	return cmd
+}
+
+// Run executes the sync command.
+func Run(opts Options) error {
+	m, err := manifest.Load(opts.Manifest)
+	if err != nil {
+		return err
+	}
+
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pol, err := policy.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	var lock *manifest.Lock
+	if opts.Frozen {
+		lockPath := manifest.LockPath(m.Path())
+		lock, err = manifest.LoadLock(lockPath)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			return fmt.Errorf("--frozen needs a lockfile, but %s does not exist; run 'execman lock'", lockPath)
+		}
+		if err := lock.Check(m); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Resolving versions for %s...\n", m.Path())
+	actions, err := Plan(m, reg, cfg, opts.Prune, lock, func(tool *manifest.Tool) (string, error) {
+		includePrereleases := (tool.Prerelease || cfg.IncludePrereleases) && !pol.ForbidsPrereleases()
+		return tool.Resolve(includePrereleases)
+	})
+	if err != nil {
+		return err
+	}
+
+	changes := PrintPlan("Sync plan", actions)
+	if !opts.Prune {
+		if unlisted := countUnlisted(actions, reg); unlisted > 0 {
+			fmt.Printf("%d managed executables are not in the manifest; use --prune to remove them.\n", unlisted)
+		}
+	}
+	if opts.Frozen {
+		for _, a := range actions {
+			if a.Kind == ActionSkip {
+				return fmt.Errorf("cannot sync %s exactly as locked: %s", a.Name, a.Note)
+			}
+		}
+	}
+	if changes == 0 || opts.DryRun {
+		return nil
+	}
+
+	if !opts.Yes {
+		fmt.Print("\nProceed? (Y/n): ")
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response == "n" || response == "no" {
+			fmt.Println("Sync cancelled.")
+			return nil
+		}
+	}
+
+	if err := PinKeys(m, reg); err != nil {
+		return err
+	}
+	return Apply(actions)
+}
+
+// Plan compares the manifest with the registry and returns the actions that
+// would bring the registry into line, in manifest order, followed by the
+// removal of unlisted executables if prune is set. An installed executable
+// whose version satisfies its constraint is kept without asking resolve.
+//
+// Given a lockfile, each tool is planned to be at its locked version instead,
+// with the download locked for this platform, and an executable is only kept
+// if its version and checksum match the lockfile.
+func Plan(m *manifest.Manifest, reg *registry.Registry, cfg *config.Config, prune bool, lock *manifest.Lock, resolve Resolver) ([]Action, error) {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	var actions []Action
+	listed := map[string]bool{}
+
+	for i := range m.Tools {
+		tool := &m.Tools[i]
+		listed[tool.Name] = true
+		action := Action{Name: tool.Name, Source: tool.Source}
+
+		exec, found := reg.Get(tool.Name)
+		if found {
+			action.From = exec.Version
+			action.Into = filepath.Dir(exec.Path)
+		}
+
+		// Never replace an executable that came from somewhere else.
+		if found && exec.Source != tool.Source {
+			action.Kind = ActionSkip
+			action.Note = fmt.Sprintf("%s is installed from %s", tool.Name, exec.Source)
+			actions = append(actions, action)
+			continue
+		}
+
+		// Installed executables stay where they are, so that no copy is
+		// left behind in the old directory.
+		if tool.Location != "" {
+			dir, _, err := cfg.ResolveInstallDir(tool.Location)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tool.Name, err)
+			}
+			if !found || filepath.Dir(exec.Path) == dir {
+				action.Into = tool.Location
+			} else {
+				action.Note = fmt.Sprintf("installed in %s, not %s", action.Into, tool.Location)
+			}
+		}
+
+		// A manifest may be someone else's, so it can only make verification
+		// stricter than the config.
+		action.ChecksumPolicy = stricterPolicy(&action, "checksum", tool.ChecksumPolicy, fetch.EffectivePolicy("", "", cfg))
+		action.SignaturePolicy = stricterPolicy(&action, "signature", tool.SignaturePolicy, fetch.EffectiveSignaturePolicy("", "", cfg.TrustFor(tool.Source), cfg))
+
+		var tag string
+		if lock != nil {
+			locked, ok := lock.Get(tool.Name)
+			var asset manifest.LockedAsset
+			if ok {
+				asset, ok = locked.Platforms[platform]
+			}
+			if !ok {
+				action.Kind = ActionSkip
+				action.Note = fmt.Sprintf("no download is locked for %s", platform)
+				actions = append(actions, action)
+				continue
+			}
+			if found && exec.Version == locked.Version && exec.Checksum == asset.BinaryChecksum {
+				action.Kind = ActionKeep
+				actions = append(actions, action)
+				continue
+			}
+			tag = locked.Version
+			action.Locked = &asset
+		} else {
+			if found && tool.Constraint().Matches(exec.Version) {
+				action.Kind = ActionKeep
+				actions = append(actions, action)
+				continue
+			}
+
+			var err error
+			tag, err = resolve(tool)
+			if err != nil {
+				action.Kind = ActionSkip
+				action.Note = err.Error()
+				actions = append(actions, action)
+				continue
+			}
+		}
+		action.To = tag
+
+		switch {
+		case !found:
+			action.Kind = ActionInstall
+		case tag == exec.Version:
+			action.Kind = ActionReinstall
+		case manifest.CompareTags(tag, exec.Version) < 0:
+			action.Kind = ActionDowngrade
+		default:
+			action.Kind = ActionUpdate
+		}
+		actions = append(actions, action)
+	}
+
+	if prune {
+		names := reg.List()
+		sort.Strings(names)
+		for _, name := range names {
+			if listed[name] {
+				continue
+			}
+			exec, _ := reg.Get(name)
+			actions = append(actions, Action{
+				Kind:   ActionRemove,
+				Name:   name,
+				Source: exec.Source,
+				From:   exec.Version,
+				Into:   filepath.Dir(exec.Path),
+			})
+		}
+	}
+	return actions, nil
+}
+
+// stricterPolicy returns a manifest's policy for a tool if it is stricter
+// than the configured one, and otherwise "" with a note on the action if the
+// manifest's policy is being ignored.
+func stricterPolicy(action *Action, kind, policy, configured string) string {
+	if policy == "" || policy == configured {
+		return ""
+	}
+	if config.StricterPolicy(policy, configured) != policy {
+		note := fmt.Sprintf("ignoring %s policy %s, which is weaker than the configured %s", kind, policy, configured)
+		if action.Note != "" {
+			note = action.Note + "; " + note
+		}
+		action.Note = note
+		return ""
+	}
+	return policy
+}
+
+// PrintPlan prints a plan under a title and returns the number of changes
+// in it.
+func PrintPlan(title string, actions []Action) int {
+	homeDir, _ := os.UserHomeDir()
+	changes := 0
+	kept := 0
+
+	fmt.Printf("\n%s:\n\n", title)
+	for _, a := range actions {
+		if a.Changes() {
+			changes++
+		} else if a.Kind == ActionKeep {
+			kept++
+		}
+
+		versions := a.To
+		switch a.Kind {
+		case ActionUpdate, ActionDowngrade:
+			versions = fmt.Sprintf("%s → %s", a.From, a.To)
+		case ActionKeep, ActionRemove:
+			versions = a.From
+		}
+		into := a.Into
+		if !strings.HasPrefix(into, "@") {
+			into = list.DisplayPath(into, homeDir)
+		}
+		if a.Kind == ActionSkip {
+			into = a.Note
+		}
+		fmt.Printf("  %-10s %-15s %-20s %s\n", a.Kind, a.Name, versions, into)
+		if a.Asset != "" && a.Kind != ActionSkip {
+			fmt.Printf("  %-10s %-15s %-20s asset: %s\n", "", "", "", a.Asset)
+		}
+		if a.Changes() && a.ChecksumPolicy != "" {
+			fmt.Printf("  %-10s %-15s %-20s checksum policy: %s\n", "", "", "", a.ChecksumPolicy)
+		}
+		if a.Changes() && a.SignaturePolicy != "" {
+			fmt.Printf("  %-10s %-15s %-20s signature policy: %s\n", "", "", "", a.SignaturePolicy)
+		}
+		if a.Kind != ActionSkip && a.Note != "" {
+			fmt.Printf("  %-10s %-15s %-20s warning: %s\n", "", "", "", a.Note)
+		}
+	}
+
+	fmt.Printf("\n%d to change, %d unchanged.\n", changes, kept)
+	return changes
+}
+
+// countUnlisted returns the number of managed executables a plan does not
+// mention.
+func countUnlisted(actions []Action, reg *registry.Registry) int {
+	listed := map[string]bool{}
+	for _, a := range actions {
+		listed[a.Name] = true
+	}
+	unlisted := 0
+	for _, name := range reg.List() {
+		if !listed[name] {
+			unlisted++
+		}
+	}
+	return unlisted
+}
+
+// PinKeys pins the manifest's publisher keys for its sources that have no key
+// pinned yet. A different key pinned already is kept, with a warning, so that
+// a manifest cannot replace a key that was trusted before.
+func PinKeys(m *manifest.Manifest, reg *registry.Registry) error {
+	pinned := 0
+	for i := range m.Tools {
+		source := m.Tools[i].Source
+		key, ok := m.Keys[source]
+		if !ok || key == nil {
+			continue
+		}
+		if existing, ok := reg.GetKey(source); ok {
+			if existing.ID != key.ID {
+				fmt.Printf("Warning: keeping the %s key %s pinned for %s, not %s from the manifest\n", existing.Type, existing.ID, source, key.ID)
+			}
+			continue
+		}
+		reg.PinKey(source, key)
+		pinned++
+	}
+	if pinned == 0 {
+		return nil
+	}
+	if err := reg.Save(); err != nil {
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	return nil
+}
+
+// Apply carries out the changes in a plan, reporting failures as it goes.
+// Policy violations are returned so that they give a distinct exit code.
+func Apply(actions []Action) error {
+	doneCount := 0
+	failCount := 0
+	var violations policy.Violations
+
+	for _, a := range actions {
+		if !a.Changes() {
+			continue
+		}
+
+		var err error
+		switch a.Kind {
+		case ActionRemove:
+			fmt.Printf("\nRemoving %s...\n", a.Name)
+			err = remove.Remove(remove.Options{Name: a.Name, Yes: true})
+		default:
+			fmt.Printf("\nInstalling %s %s...\n", a.Name, a.To)
+			err = install.Run(install.Options{
+				Source:          a.Source + "@" + a.To,
+				Name:            a.Name,
+				Into:            a.Into,
+				Yes:             true,
+				Locked:          a.Locked,
+				ChecksumPolicy:  a.ChecksumPolicy,
+				SignaturePolicy: a.SignaturePolicy,
+			})
+		}
+
+		var violation *policy.Violation
+		if errors.As(err, &violation) {
+			violations = append(violations, violation)
+		}
+		if err != nil {
+			fmt.Printf("Failed to %s %s: %v\n", a.Kind, a.Name, err)
+			failCount++
+		} else {
+			doneCount++
+		}
+	}
+
+	fmt.Printf("\n%d changed, %d failed.\n", doneCount, failCount)
+	if len(violations) > 0 {
+		return violations
+	}
+	if failCount > 0 {
+		return fmt.Errorf("%d changes failed", failCount)
+	}
+	return nil
+}
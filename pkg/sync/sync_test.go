@@ -0,0 +1,291 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+func TestPlan(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-sync-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binDir := filepath.Join(tmpDir, "bin")
+	workDir := filepath.Join(tmpDir, "work")
+	cfg := &config.Config{DefaultInstallDir: binDir, Locations: map[string]string{"work": workDir}}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := map[string]*registry.Executable{
+		"kept":       {Source: "https://github.com/owner/kept", Version: "v1.4.0"},
+		"outdated":   {Source: "https://github.com/owner/outdated", Version: "v1.0.0"},
+		"ahead":      {Source: "https://github.com/owner/ahead", Version: "v3.0.0"},
+		"tool":       {Source: "https://github.com/alice/tool", Version: "v1.0.0"},
+		"elsewhere":  {Source: "https://github.com/owner/elsewhere", Version: "v1.0.0"},
+		"unlisted":   {Source: "https://github.com/owner/unlisted", Version: "v0.1.0"},
+		"unresolved": {Source: "https://github.com/owner/unresolved", Version: "v1.0.0"},
+	}
+	for name, exec := range installed {
+		exec.Path = filepath.Join(binDir, name)
+		reg.Add(name, exec)
+	}
+
+	m := &manifest.Manifest{Tools: []manifest.Tool{
+		{Source: "github.com/owner/kept", Version: "^1.2"},
+		{Source: "github.com/owner/outdated", Version: "^2"},
+		{Source: "github.com/owner/ahead", Version: "~2.1"},
+		{Source: "github.com/owner/fresh", Location: "@work"},
+		{Source: "github.com/bob/tool"},
+		{Source: "github.com/owner/elsewhere", Version: "^1", Location: "@work"},
+		{Source: "github.com/owner/unresolved", Version: "^9"},
+	}}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	latest := map[string]string{
+		"outdated": "v2.3.0",
+		"ahead":    "v2.1.5",
+		"fresh":    "v0.9.0",
+	}
+	resolve := func(tool *manifest.Tool) (string, error) {
+		if tag, ok := latest[tool.Name]; ok {
+			return tag, nil
+		}
+		return "", errors.New("no matching release")
+	}
+
+	tests := []struct {
+		name  string
+		prune bool
+		want  []Action
+	}{
+		{
+			name: "without prune",
+			want: []Action{
+				{Kind: ActionKeep, Name: "kept", From: "v1.4.0", Into: binDir},
+				{Kind: ActionUpdate, Name: "outdated", From: "v1.0.0", To: "v2.3.0", Into: binDir},
+				{Kind: ActionDowngrade, Name: "ahead", From: "v3.0.0", To: "v2.1.5", Into: binDir},
+				{Kind: ActionInstall, Name: "fresh", To: "v0.9.0", Into: "@work"},
+				{Kind: ActionSkip, Name: "tool", From: "v1.0.0", Into: binDir},
+				{Kind: ActionKeep, Name: "elsewhere", From: "v1.0.0", Into: binDir},
+				{Kind: ActionSkip, Name: "unresolved", From: "v1.0.0", Into: binDir},
+			},
+		},
+		{
+			name:  "with prune",
+			prune: true,
+			want: []Action{
+				{Kind: ActionKeep, Name: "kept"},
+				{Kind: ActionUpdate, Name: "outdated"},
+				{Kind: ActionDowngrade, Name: "ahead"},
+				{Kind: ActionInstall, Name: "fresh"},
+				{Kind: ActionSkip, Name: "tool"},
+				{Kind: ActionKeep, Name: "elsewhere"},
+				{Kind: ActionSkip, Name: "unresolved"},
+				{Kind: ActionRemove, Name: "unlisted", From: "v0.1.0", Into: binDir},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions, err := Plan(m, reg, cfg, tt.prune, nil, resolve)
+			if err != nil {
+				t.Fatalf("Plan() error: %v", err)
+			}
+			if len(actions) != len(tt.want) {
+				t.Fatalf("Plan() returned %d actions, want %d: %+v", len(actions), len(tt.want), actions)
+			}
+			for i, want := range tt.want {
+				got := actions[i]
+				if got.Kind != want.Kind || got.Name != want.Name {
+					t.Errorf("action %d = %s %s, want %s %s", i, got.Kind, got.Name, want.Kind, want.Name)
+				}
+				if want.From != "" && got.From != want.From {
+					t.Errorf("action %d From = %q, want %q", i, got.From, want.From)
+				}
+				if want.To != "" && got.To != want.To {
+					t.Errorf("action %d To = %q, want %q", i, got.To, want.To)
+				}
+				if want.Into != "" && got.Into != want.Into {
+					t.Errorf("action %d Into = %q, want %q", i, got.Into, want.Into)
+				}
+			}
+		})
+	}
+
+	// An executable installed elsewhere than its manifest location is left
+	// where it is, with a warning.
+	actions, _ := Plan(m, reg, cfg, false, nil, resolve)
+	if actions[5].Note == "" {
+		t.Error("Plan() gave no warning for an executable outside its location")
+	}
+}
+
+func TestPlanPolicies(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-sync-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		DefaultInstallDir: filepath.Join(tmpDir, "bin"),
+		ChecksumPolicy:    config.PolicyWarn,
+		SignaturePolicy:   config.PolicyWarn,
+		Sources: map[string]*config.SourceTrust{
+			"github.com/owner/signed": {SignaturePolicy: config.PolicyRequire},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		tool          manifest.Tool
+		wantChecksum  string
+		wantSignature string
+		wantNote      bool
+	}{
+		{
+			name: "no overrides",
+			tool: manifest.Tool{Source: "github.com/owner/plain"},
+		},
+		{
+			name:          "stricter policies",
+			tool:          manifest.Tool{Source: "github.com/owner/strict", ChecksumPolicy: config.PolicyRequire, SignaturePolicy: config.PolicyRequire},
+			wantChecksum:  config.PolicyRequire,
+			wantSignature: config.PolicyRequire,
+		},
+		{
+			name:     "weaker policies are ignored",
+			tool:     manifest.Tool{Source: "github.com/owner/lax", ChecksumPolicy: config.PolicyOff, SignaturePolicy: config.PolicyOff},
+			wantNote: true,
+		},
+		{
+			name:     "weaker than the source's policy",
+			tool:     manifest.Tool{Source: "github.com/owner/signed", SignaturePolicy: config.PolicyWarn},
+			wantNote: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &manifest.Manifest{Tools: []manifest.Tool{tt.tool}}
+			if err := m.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			actions, err := Plan(m, reg, cfg, false, nil, func(tool *manifest.Tool) (string, error) {
+				return "v1.0.0", nil
+			})
+			if err != nil {
+				t.Fatalf("Plan() error: %v", err)
+			}
+			got := actions[0]
+			if got.ChecksumPolicy != tt.wantChecksum || got.SignaturePolicy != tt.wantSignature {
+				t.Errorf("Plan() policies = %q, %q, want %q, %q", got.ChecksumPolicy, got.SignaturePolicy, tt.wantChecksum, tt.wantSignature)
+			}
+			if (got.Note != "") != tt.wantNote {
+				t.Errorf("Plan() Note = %q, want a note %v", got.Note, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestPlanFrozen(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-sync-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binDir := filepath.Join(tmpDir, "bin")
+	cfg := &config.Config{DefaultInstallDir: binDir}
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := map[string]*registry.Executable{
+		"exact":    {Source: "https://github.com/owner/exact", Version: "v1.2.0", Checksum: "sha256:exact"},
+		"newer":    {Source: "https://github.com/owner/newer", Version: "v1.3.0", Checksum: "sha256:newer"},
+		"tampered": {Source: "https://github.com/owner/tampered", Version: "v1.0.0", Checksum: "sha256:other"},
+	}
+	for name, exec := range installed {
+		exec.Path = filepath.Join(binDir, name)
+		reg.Add(name, exec)
+	}
+
+	m := &manifest.Manifest{Tools: []manifest.Tool{
+		{Source: "github.com/owner/exact", Version: "^1"},
+		{Source: "github.com/owner/newer", Version: "^1"},
+		{Source: "github.com/owner/tampered"},
+		{Source: "github.com/owner/fresh"},
+		{Source: "github.com/owner/unported"},
+	}}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	locked := func(name, constraint, version, checksum string) manifest.LockedTool {
+		return manifest.LockedTool{
+			Name:       name,
+			Source:     "https://github.com/owner/" + name,
+			Constraint: constraint,
+			Version:    version,
+			Platforms:  map[string]manifest.LockedAsset{platform: {Asset: name + ".tar.gz", BinaryChecksum: checksum}},
+		}
+	}
+	lock := &manifest.Lock{Tools: []manifest.LockedTool{
+		locked("exact", "^1", "v1.2.0", "sha256:exact"),
+		locked("newer", "^1", "v1.2.0", "sha256:newer-locked"),
+		locked("tampered", "", "v1.0.0", "sha256:tampered"),
+		locked("fresh", "", "v0.1.0", "sha256:fresh"),
+		{Name: "unported", Source: "https://github.com/owner/unported", Version: "v1.0.0", Platforms: map[string]manifest.LockedAsset{}},
+	}}
+	if err := lock.Check(m); err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+
+	resolve := func(tool *manifest.Tool) (string, error) {
+		t.Errorf("resolve(%s) called when syncing frozen", tool.Name)
+		return "", errors.New("unexpected")
+	}
+	actions, err := Plan(m, reg, cfg, false, lock, resolve)
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+
+	want := []struct{ kind, to string }{
+		{ActionKeep, ""},
+		{ActionDowngrade, "v1.2.0"},
+		{ActionReinstall, "v1.0.0"},
+		{ActionInstall, "v0.1.0"},
+		{ActionSkip, ""},
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("Plan() returned %d actions, want %d", len(actions), len(want))
+	}
+	for i, w := range want {
+		if actions[i].Kind != w.kind || actions[i].To != w.to {
+			t.Errorf("action %d (%s) = %s %q, want %s %q", i, actions[i].Name, actions[i].Kind, actions[i].To, w.kind, w.to)
+		}
+		if actions[i].Changes() && actions[i].Locked == nil {
+			t.Errorf("action %d (%s) has no locked download", i, actions[i].Name)
+		}
+	}
+}
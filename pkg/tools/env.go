@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/scope"
+	"github.com/sfkleach/execman/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// ProjectPath returns the PATH to use inside a project: path with every
+// directory in the store removed, and then dirs put first.
+func ProjectPath(path, storeRoot string, dirs []string) string {
+	entries := append([]string{}, dirs...)
+	for _, dir := range filepath.SplitList(path) {
+		if dir != "" && !store.Contains(storeRoot, dir) {
+			entries = append(entries, dir)
+		}
+	}
+	return strings.Join(entries, string(os.PathListSeparator))
+}
+
+// projectDirs returns the store directories of the versions that the tools
+// file applying in the working directory selects. Versions not installed yet
+// are reported on standard error and left out.
+func projectDirs() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	path, err := Find(cwd)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := registry.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	selections, err := Select(f, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, sel := range selections {
+		switch {
+		case !sel.Installed:
+			fmt.Fprintf(os.Stderr, "execman: %s %s is not installed; run 'execman tools install'\n", sel.Name, sel.Version)
+		case !sel.Active:
+			dirs = append(dirs, filepath.Dir(sel.Path))
+		}
+	}
+	return dirs, nil
+}
+
+func newEnvCommand() *cobra.Command {
+	var shell string
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print the PATH for the project's tool versions",
+		Long: `Print a shell command that sets PATH so that the versions declared by the
+nearest .execman-tools file come first. Directories from the store that an
+earlier project added are taken out again, so running it after changing
+directory keeps PATH right. The hook from 'execman tools hook' runs it
+before each prompt.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if shell != "sh" && shell != "fish" {
+				return fmt.Errorf("unsupported shell %q: expected sh or fish", shell)
+			}
+			root, err := store.Root()
+			if err != nil {
+				return err
+			}
+
+			// A broken tools file must not break the shell, so it is
+			// reported and PATH is reset as if there were none.
+			dirs, err := projectDirs()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "execman: %v\n", err)
+			}
+			path := ProjectPath(os.Getenv("PATH"), root, dirs)
+			if shell == "fish" {
+				var quoted []string
+				for _, dir := range filepath.SplitList(path) {
+					quoted = append(quoted, quote(shell, dir))
+				}
+				fmt.Printf("set -gx PATH %s;\n", strings.Join(quoted, " "))
+			} else {
+				fmt.Printf("export PATH=%s;\n", quote(shell, path))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&shell, "shell", "sh", "Syntax to print: sh (also bash and zsh) or fish")
+
+	return cmd
+}
+
+// quote quotes a string for a POSIX shell, or for fish, which escapes quotes
+// inside quotes instead.
+func quote(shell, s string) string {
+	if shell == "fish" {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Shell hooks, with the command to run in place of %s.
+var hooks = map[string]string{
+	"bash": `_execman_hook() {
+  eval "$(%s tools env --shell sh)"
+}
+if [[ ";${PROMPT_COMMAND:-};" != *";_execman_hook;"* ]]; then
+  PROMPT_COMMAND="_execman_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	"zsh": `_execman_hook() {
+  eval "$(%s tools env --shell sh)"
+}
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_execman_hook]} )); then
+  precmd_functions=(_execman_hook $precmd_functions)
+fi
+`,
+	"fish": `function _execman_hook --on-variable PWD
+    %s tools env --shell fish | source
+end
+_execman_hook
+`,
+}
+
+func newHookCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hook <bash|zsh|fish>",
+		Short: "Print a shell hook that follows the project's tool versions",
+		Long: `Print shell code that updates PATH for the project's tool versions whenever
+the prompt is shown, or in fish whenever the directory changes. Add it to
+the shell's startup file:
+
+  eval "$(execman tools hook bash)"      # ~/.bashrc
+  eval "$(execman tools hook zsh)"       # ~/.zshrc
+  execman tools hook fish | source       # ~/.config/fish/config.fish`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			hook, ok := hooks[args[0]]
+			if !ok {
+				return fmt.Errorf("unsupported shell %q: expected bash, zsh or fish", args[0])
+			}
+
+			// Run this execman, in the scope selected now, whatever PATH
+			// holds later.
+			self, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to locate execman: %w", err)
+			}
+			shell := "sh"
+			if args[0] == "fish" {
+				shell = "fish"
+			}
+			command := quote(shell, self)
+			if scope.Current() == scope.System {
+				command += " --system"
+			}
+			fmt.Printf(hook, command)
+			return nil
+		},
+	}
+
+	return cmd
+}
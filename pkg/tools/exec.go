@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+// NewExecCommand creates the exec command.
+func NewExecCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec <name> [args...]",
+		Short: "Run a managed executable at the project's version",
+		Long: `Run a managed executable at the version declared for it by the nearest
+.execman-tools file, or the installed version if none is declared. This
+works without the shell hook, in scripts and CI jobs for example. The
+executable takes execman's place, so it receives the arguments after its
+name, signals and standard streams, and its exit status is execman's.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			reg, err := registry.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load registry: %w", err)
+			}
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+			path, err := Resolve(reg, cwd, args[0])
+			if err != nil {
+				return err
+			}
+			return runner.Exec(path, args[1:])
+		},
+	}
+
+	// Flags after the name belong to the executable.
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+// Resolve returns the path of the version of a managed executable to run in
+// dir: the version declared by the tools file that applies there, or else
+// the installed executable.
+func Resolve(reg *registry.Registry, dir, name string) (string, error) {
+	path, err := Find(dir)
+	if err != nil {
+		return "", err
+	}
+	if path != "" {
+		f, err := Load(path)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := f.Get(name); ok {
+			selections, err := Select(f, reg)
+			if err != nil {
+				return "", err
+			}
+			for _, sel := range selections {
+				if sel.Name != name {
+					continue
+				}
+				if !sel.Installed {
+					return "", fmt.Errorf("%s %s, declared in %s, is not installed; run 'execman tools install'", name, sel.Version, path)
+				}
+				return sel.Path, nil
+			}
+		}
+	}
+
+	exec, ok := reg.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%s is not managed by execman", name)
+	}
+	return exec.Path, nil
+}
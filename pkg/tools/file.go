@@ -0,0 +1,121 @@
+// Package tools implements project-local tool versions: a .execman-tools file
+// declares the versions of executables a project needs, which execman keeps
+// in its versioned store and selects inside that project's directory tree.
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// FileName is the name of the file that declares a project's tool versions.
+const FileName = ".execman-tools"
+
+// Entry is one line of a tools file: an executable and the version wanted.
+type Entry struct {
+	Name string
+	// Source is the repository URL when the line gives one. When it does not,
+	// the source is that of the managed executable called Name.
+	Source  string
+	Version string
+	Line    int
+}
+
+// File is a parsed tools file.
+type File struct {
+	Path    string
+	Entries []Entry
+}
+
+// Find returns the path of the tools file that applies in dir: the first
+// found in dir or one of its parents. It returns "" if there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads a tools file. Each line names an executable, either by the name
+// it is managed under or by its source, and the release tag wanted:
+//
+//	terraform v1.5.7
+//	github.com/cli/cli v2.40.0
+//
+// Blank lines and text after a '#' are ignored.
+func Load(path string) (*File, error) {
+	// #nosec G304 -- Reading the tools file of the project being worked in
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools file: %w", err)
+	}
+	defer file.Close()
+
+	f := &File{Path: path}
+	seen := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a name or source and a version", path, lineNo)
+		}
+
+		entry := Entry{Name: fields[0], Version: fields[1], Line: lineNo}
+		if strings.Contains(entry.Name, "/") {
+			owner, repo, version, err := github.ParseSource(entry.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+			if version != "" {
+				return nil, fmt.Errorf("%s:%d: give the version as a separate field, not in the source", path, lineNo)
+			}
+			entry.Name = repo
+			entry.Source = github.ToURL(owner, repo)
+		} else if err := registry.ValidateName(entry.Name); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if strings.ContainsAny(entry.Version, `/\`) || entry.Version == "." || entry.Version == ".." {
+			return nil, fmt.Errorf("%s:%d: invalid version %q", path, lineNo, entry.Version)
+		}
+		if previous, ok := seen[entry.Name]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already given on line %d", path, lineNo, entry.Name, previous)
+		}
+		seen[entry.Name] = lineNo
+		f.Entries = append(f.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tools file: %w", err)
+	}
+	return f, nil
+}
+
+// Get returns the entry for an executable.
+func (f *File) Get(name string) (*Entry, bool) {
+	for i := range f.Entries {
+		if f.Entries[i].Name == name {
+			return &f.Entries[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/execman/pkg/install"
+	"github.com/sfkleach/execman/pkg/policy"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// Selection is the executable chosen for one entry of a tools file.
+type Selection struct {
+	Entry
+	// Path is where the chosen version is, or will be once installed.
+	Path string
+	// Installed reports whether the chosen version is installed.
+	Installed bool
+	// Active reports that the installed executable on PATH is already at
+	// the wanted version, so no version from the store is needed.
+	Active bool
+}
+
+// Select chooses, for each entry of a tools file, the installed executable if
+// it is at the wanted version, and otherwise that version in the store.
+// Entries that only give a name take their source from the registry.
+func Select(f *File, reg *registry.Registry) ([]Selection, error) {
+	selections := make([]Selection, 0, len(f.Entries))
+	for _, entry := range f.Entries {
+		active, hasActive := reg.Get(entry.Name)
+		source := entry.Source
+		if source == "" {
+			switch {
+			case hasActive:
+				source = active.Source
+			case len(reg.ListVersions(entry.Name)) > 0:
+				stored, _ := reg.GetVersion(entry.Name, reg.ListVersions(entry.Name)[0])
+				source = stored.Source
+			default:
+				return nil, fmt.Errorf("%s:%d: %s is not managed by execman; give its source instead, such as github.com/owner/%s", f.Path, entry.Line, entry.Name, entry.Name)
+			}
+		}
+		if hasActive && active.Source != source {
+			return nil, fmt.Errorf("%s:%d: %s is installed from %s, not %s", f.Path, entry.Line, entry.Name, active.Source, source)
+		}
+
+		sel := Selection{Entry: entry}
+		sel.Source = source
+		if hasActive && active.Version == entry.Version {
+			sel.Path = active.Path
+			sel.Installed = true
+			sel.Active = true
+		} else if stored, ok := reg.GetVersion(entry.Name, entry.Version); ok {
+			if stored.Source != source {
+				return nil, fmt.Errorf("%s:%d: the store holds %s from %s, not %s", f.Path, entry.Line, entry.Name, stored.Source, source)
+			}
+			sel.Path = stored.Path
+			sel.Installed = true
+		} else {
+			dir, err := store.Dir(entry.Name, entry.Version)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", f.Path, entry.Line, err)
+			}
+			sel.Path = filepath.Join(dir, entry.Name)
+		}
+		selections = append(selections, sel)
+	}
+	return selections, nil
+}
+
+// loadProject finds and reads the tools file that applies in the working
+// directory, and chooses a version for each of its entries.
+func loadProject() (*File, []Selection, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	path, err := Find(cwd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		return nil, nil, fmt.Errorf("no %s file found in %s or its parents", FileName, cwd)
+	}
+	f, err := Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reg, err := registry.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	selections, err := Select(f, reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, selections, nil
+}
+
+// NewToolsCommand creates the tools command and its subcommands.
+func NewToolsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tools",
+		Short: "Manage project-local tool versions",
+		Long: `Manage the tool versions declared by a project's .execman-tools file. Each
+line names a managed executable, or gives its source, and the release tag the
+project needs:
+
+  terraform v1.5.7
+  github.com/cli/cli v2.40.0
+
+Versions other than the installed one are kept side by side in execman's
+versioned store. Inside the project's directory tree, 'execman exec' runs the
+declared version, and the shell hook from 'execman tools hook' puts the
+declared versions first on PATH.`,
+	}
+
+	cmd.AddCommand(newInstallCommand())
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newEnvCommand())
+	cmd.AddCommand(newHookCommand())
+
+	return cmd
+}
+
+func newInstallCommand() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the tool versions the project declares",
+		Long: `Install every version declared by the nearest .execman-tools file that is
+not installed yet into the versioned store. The installed executables on
+PATH are left alone.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return runInstall(yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+
+	return cmd
+}
+
+func runInstall(yes bool) error {
+	f, selections, err := loadProject()
+	if err != nil {
+		return err
+	}
+
+	var missing []Selection
+	for _, sel := range selections {
+		if !sel.Installed {
+			missing = append(missing, sel)
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Printf("All tools in %s are installed.\n", f.Path)
+		return nil
+	}
+
+	fmt.Printf("Tools in %s to install into the store:\n\n", f.Path)
+	for _, sel := range missing {
+		fmt.Printf("  %-15s %-12s %s\n", sel.Name, sel.Version, sel.Source)
+	}
+
+	if !yes {
+		fmt.Print("\nProceed? (Y/n): ")
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response == "n" || response == "no" {
+			fmt.Println("Installation cancelled.")
+			return nil
+		}
+	}
+
+	failCount := 0
+	var violations policy.Violations
+	for _, sel := range missing {
+		fmt.Printf("\nInstalling %s %s...\n", sel.Name, sel.Version)
+		err := install.Run(install.Options{
+			Source: sel.Source + "@" + sel.Version,
+			Name:   sel.Name,
+			Store:  true,
+			Yes:    true,
+		})
+		var violation *policy.Violation
+		if errors.As(err, &violation) {
+			violations = append(violations, violation)
+		}
+		if err != nil {
+			fmt.Printf("Failed to install %s %s: %v\n", sel.Name, sel.Version, err)
+			failCount++
+		}
+	}
+
+	fmt.Printf("\n%d installed, %d failed.\n", len(missing)-failCount, failCount)
+	if len(violations) > 0 {
+		return violations
+	}
+	if failCount > 0 {
+		return fmt.Errorf("%d tools failed to install", failCount)
+	}
+	return nil
+}
+
+func newListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "Show the tool versions the project declares",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			f, selections, err := loadProject()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Tools in %s:\n\n", f.Path)
+			missing := 0
+			for _, sel := range selections {
+				status := "store"
+				switch {
+				case sel.Active:
+					status = "installed"
+				case !sel.Installed:
+					status = "missing"
+					missing++
+				}
+				fmt.Printf("  %-15s %-12s %-10s %s\n", sel.Name, sel.Version, status, sel.Path)
+			}
+			if missing > 0 {
+				fmt.Printf("\n%d missing; run 'execman tools install' to install them.\n", missing)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
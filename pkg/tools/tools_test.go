@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+)
+
+func TestLoad(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-tools-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    []Entry
+		wantErr string
+	}{
+		{
+			name:    "names and sources",
+			content: "# Project tools.\nterraform v1.5.7\n\ngithub.com/cli/cli   v2.40.0  # the GitHub CLI\n",
+			want: []Entry{
+				{Name: "terraform", Version: "v1.5.7", Line: 2},
+				{Name: "cli", Source: "https://github.com/cli/cli", Version: "v2.40.0", Line: 4},
+			},
+		},
+		{name: "empty", content: "\n# Nothing yet.\n"},
+		{name: "missing version", content: "terraform\n", wantErr: "expected a name or source and a version"},
+		{name: "version in source", content: "github.com/cli/cli@v2.40.0 v2.40.0\n", wantErr: "not in the source"},
+		{name: "bad version", content: "terraform ../v1\n", wantErr: "invalid version"},
+		{name: "duplicate", content: "gh v1\ngh v2\n", wantErr: "already given on line 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, FileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if len(f.Entries) != len(tt.want) {
+				t.Fatalf("Load() = %+v, want %+v", f.Entries, tt.want)
+			}
+			for i, entry := range f.Entries {
+				if entry != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, entry, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-tools-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	project := filepath.Join(tmpDir, "project")
+	nested := filepath.Join(project, "src", "pkg")
+	if err := os.MkdirAll(nested, 0750); err != nil {
+		t.Fatal(err)
+	}
+	toolsPath := filepath.Join(project, FileName)
+	if err := os.WriteFile(toolsPath, []byte("gh v2.40.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{project, nested} {
+		got, err := Find(dir)
+		if err != nil {
+			t.Fatalf("Find(%s) error: %v", dir, err)
+		}
+		if got != toolsPath {
+			t.Errorf("Find(%s) = %q, want %q", dir, got, toolsPath)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-tools-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Add("gh", &registry.Executable{Source: "https://github.com/cli/cli", Version: "v2.40.0", Path: "/bin/gh"})
+	reg.Add("terraform", &registry.Executable{Source: "https://github.com/hashicorp/terraform", Version: "v1.9.0", Path: "/bin/terraform"})
+	reg.AddVersion("terraform", &registry.Executable{Source: "https://github.com/hashicorp/terraform", Version: "v1.5.7", Path: "/store/terraform/v1.5.7/terraform"})
+
+	f := &File{Path: FileName, Entries: []Entry{
+		{Name: "gh", Version: "v2.40.0", Line: 1},
+		{Name: "terraform", Version: "v1.5.7", Line: 2},
+		{Name: "tool", Source: "https://github.com/owner/tool", Version: "v1.0.0", Line: 3},
+	}}
+	selections, err := Select(f, reg)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+
+	toolDir, err := store.Dir("tool", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Selection{
+		{Path: "/bin/gh", Installed: true, Active: true},
+		{Path: "/store/terraform/v1.5.7/terraform", Installed: true},
+		{Path: filepath.Join(toolDir, "tool")},
+	}
+	for i, sel := range selections {
+		if sel.Path != want[i].Path || sel.Installed != want[i].Installed || sel.Active != want[i].Active {
+			t.Errorf("selection for %s = %+v, want %+v", sel.Name, sel, want[i])
+		}
+	}
+
+	// A source that differs from the installed executable's is refused.
+	f.Entries = []Entry{{Name: "gh", Source: "https://github.com/other/gh", Version: "v1.0.0", Line: 1}}
+	if _, err := Select(f, reg); err == nil {
+		t.Errorf("Select() accepted a different source for an installed executable")
+	}
+
+	// A bare name that execman does not manage cannot be resolved.
+	f.Entries = []Entry{{Name: "unknown", Version: "v1.0.0", Line: 1}}
+	if _, err := Select(f, reg); err == nil {
+		t.Errorf("Select() accepted an unmanaged name without a source")
+	}
+}
+
+func TestProjectPath(t *testing.T) {
+	root := filepath.Join("/data", "execman", "store")
+	sep := string(os.PathListSeparator)
+	usrBin := filepath.Join("/usr", "bin")
+	localBin := filepath.Join("/home", "user", ".local", "bin")
+	oldDir := filepath.Join(root, "gh", "v2.0.0")
+	newDir := filepath.Join(root, "gh", "v2.40.0")
+
+	tests := []struct {
+		name string
+		path string
+		dirs []string
+		want string
+	}{
+		{
+			name: "prepends the project's directories",
+			path: localBin + sep + usrBin,
+			dirs: []string{newDir},
+			want: newDir + sep + localBin + sep + usrBin,
+		},
+		{
+			name: "drops directories of an earlier project",
+			path: oldDir + sep + localBin + sep + usrBin,
+			dirs: []string{newDir},
+			want: newDir + sep + localBin + sep + usrBin,
+		},
+		{
+			name: "restores PATH outside a project",
+			path: oldDir + sep + localBin,
+			want: localBin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProjectPath(tt.path, root, tt.dirs); got != tt.want {
+				t.Errorf("ProjectPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package update
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,8 +11,13 @@ import (
 	"time"
 
 	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/binfmt"
+	"github.com/sfkleach/execman/pkg/companion"
 	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/dircheck"
+	"github.com/sfkleach/execman/pkg/fetch"
 	"github.com/sfkleach/execman/pkg/github"
+	"github.com/sfkleach/execman/pkg/policy"
 	"github.com/sfkleach/execman/pkg/registry"
 	"github.com/sfkleach/execman/pkg/symlink"
 	"github.com/spf13/cobra"
@@ -23,6 +29,11 @@ type Options struct {
 	All                bool
 	Yes                bool
 	IncludePrereleases bool
+	Companions         bool
+	ChecksumPolicy     string
+	SignaturePolicy    string
+	TrustKey           string
+	VerifyProvenance   bool
 }
 
 // NewUpdateCommand creates the update command.
@@ -30,6 +41,11 @@ func NewUpdateCommand() *cobra.Command {
 	var all bool
 	var yes bool
 	var includePrereleases bool
+	var companions bool
+	var checksumPolicy string
+	var signaturePolicy string
+	var trustKey string
+	var verifyProvenance bool
 
 	cmd := &cobra.Command{
 		Use:   "update [executable]",
@@ -55,6 +71,11 @@ func NewUpdateCommand() *cobra.Command {
 				All:                all,
 				Yes:                yes,
 				IncludePrereleases: includePrereleases,
+				Companions:         companions,
+				ChecksumPolicy:     checksumPolicy,
+				SignaturePolicy:    signaturePolicy,
+				TrustKey:           trustKey,
+				VerifyProvenance:   verifyProvenance,
 			}
 			return Run(opts)
 		},
@@ -63,6 +84,11 @@ func NewUpdateCommand() *cobra.Command {
 	cmd.Flags().BoolVarP(&all, "all", "a", false, "Update all managed executables")
 	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip all confirmation prompts")
 	cmd.Flags().BoolVar(&includePrereleases, "include-prereleases", false, "Allow updating to prerelease versions")
+	cmd.Flags().BoolVar(&companions, "companions", false, "Also install completions, man pages and licenses")
+	cmd.Flags().StringVar(&checksumPolicy, "checksum-policy", "", "Checksum policy for this update: off, warn or require")
+	cmd.Flags().StringVar(&signaturePolicy, "signature-policy", "", "Signature policy for this update: off, warn or require")
+	cmd.Flags().StringVar(&trustKey, "trust-key", "", "Trust this minisign or GPG public key file in place of the pinned key")
+	cmd.Flags().BoolVar(&verifyProvenance, "verify-provenance", false, "Require SLSA build provenance from the source repository")
 
 	return cmd
 }
@@ -80,19 +106,43 @@ func Run(opts Options) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	pol, err := policy.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load policy: %w", err)
+	}
+
 	if !opts.IncludePrereleases {
 		opts.IncludePrereleases = cfg.IncludePrereleases
 	}
+	if pol.ForbidsPrereleases() {
+		opts.IncludePrereleases = false
+	}
+	if !opts.Companions {
+		opts.Companions = cfg.InstallCompanions
+	}
+
+	if opts.ChecksumPolicy != "" {
+		if err := config.ValidatePolicy(opts.ChecksumPolicy); err != nil {
+			return fmt.Errorf("invalid checksum policy: %w", err)
+		}
+	}
+	if opts.SignaturePolicy != "" {
+		if err := config.ValidatePolicy(opts.SignaturePolicy); err != nil {
+			return fmt.Errorf("invalid signature policy: %w", err)
+		}
+	}
 
 	if opts.All {
-		return updateAll(reg, opts)
+		return updateAll(reg, cfg, pol, opts)
 	}
 
-	_, err = updateOne(reg, opts)
+	_, err = updateOne(reg, cfg, pol, opts)
 	return err
 }
 
-func updateAll(reg *registry.Registry, opts Options) error {
+// updateAll updates every managed executable, reporting failures as it goes.
+// Only policy violations make it fail, so that they give a distinct exit code.
+func updateAll(reg *registry.Registry, cfg *config.Config, pol *policy.Policy, opts Options) error {
 	names := reg.List()
 	if len(names) == 0 {
 		fmt.Println("No managed executables to update.")
@@ -102,11 +152,16 @@ func updateAll(reg *registry.Registry, opts Options) error {
 	updatedCount := 0
 	upToDateCount := 0
 	failCount := 0
+	var violations policy.Violations
 
 	for _, name := range names {
 		fmt.Printf("\nUpdating %s...\n", name)
 		opts.Name = name
-		updated, err := updateOne(reg, opts)
+		updated, err := updateOne(reg, cfg, pol, opts)
+		var violation *policy.Violation
+		if errors.As(err, &violation) {
+			violations = append(violations, violation)
+		}
 		if err != nil {
 			fmt.Printf("Failed to update %s: %v\n", name, err)
 			failCount++
@@ -118,10 +173,13 @@ func updateAll(reg *registry.Registry, opts Options) error {
 	}
 
 	fmt.Printf("\n%d updated, %d already up to date, %d failed.\n", updatedCount, upToDateCount, failCount)
+	if len(violations) > 0 {
+		return violations
+	}
 	return nil
 }
 
-func updateOne(reg *registry.Registry, opts Options) (bool, error) {
+func updateOne(reg *registry.Registry, cfg *config.Config, pol *policy.Policy, opts Options) (bool, error) {
 	// Get current installation.
 	exec, ok := reg.Get(opts.Name)
 	if !ok {
@@ -163,6 +221,9 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if err := pol.CheckSource(exec.Source); err != nil {
+		return false, err
+	}
 
 	// Fetch latest release.
 	fmt.Printf("Checking for updates from %s/%s...\n", owner, repo)
@@ -170,6 +231,9 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if err := pol.CheckRelease(exec.Source, release.TagName, release.Prerelease); err != nil {
+		return false, err
+	}
 
 	latestVersion := release.TagName
 
@@ -203,6 +267,9 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 					if err != nil {
 						return false, fmt.Errorf("failed to fetch recorded version %s: %w", exec.Version, err)
 					}
+					if err := pol.CheckRelease(exec.Source, release.TagName, release.Prerelease); err != nil {
+						return false, err
+					}
 					latestVersion = exec.Version
 				case "l", "latest":
 					// Use latest - already have it.
@@ -238,6 +305,13 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 		}
 	}
 
+	// Check the install directory before writing to it.
+	if err := dircheck.Preflight(effectivePath, cfg.InstallDirCheck, func(issue dircheck.Issue) {
+		fmt.Printf("Warning: %s\n", issue)
+	}); err != nil {
+		return false, fmt.Errorf("refusing to update %s: %w", effectivePath, err)
+	}
+
 	// Ask about backup (only if file exists).
 	createBackup := false
 	if !executableMissing && !opts.Yes {
@@ -261,20 +335,47 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	// Download asset.
-	archivePath := filepath.Join(tmpDir, asset.Name)
-	fmt.Printf("Downloading %s...\n", asset.Name)
-	if err := github.DownloadAsset(asset, archivePath); err != nil {
+	// Download and verify the asset.
+	trust := cfg.TrustFor(exec.Source)
+	pinnedKey, _ := reg.GetKey(exec.Source)
+	signaturePolicy := fetch.EffectiveSignaturePolicy(opts.SignaturePolicy, exec.SignaturePolicy, trust, cfg)
+	// Once a download has been signed, updates must be signed too.
+	if pol.RequiresSignature(exec.Source) || exec.Signature != nil || pinnedKey != nil {
+		signaturePolicy = config.PolicyRequire
+	}
+	fetched, err := fetch.Asset(cfg, release, asset, fetch.Options{
+		ChecksumPolicy:  fetch.EffectivePolicy(opts.ChecksumPolicy, exec.ChecksumPolicy, cfg),
+		SignaturePolicy: signaturePolicy,
+		Source:          exec.Source,
+		Trust:           trust,
+		PinnedKey:       pinnedKey,
+		TrustKey:        opts.TrustKey,
+		// Once provenance has been verified, updates must keep verifying it.
+		VerifyProvenance: opts.VerifyProvenance || exec.Provenance != nil,
+	})
+	if errors.Is(err, fetch.ErrSignatureRequired) && pol.RequiresSignature(exec.Source) {
+		return false, policy.SignatureViolation(exec.Source, err)
+	}
+	if err != nil {
 		return false, err
 	}
+	archivePath := fetched.ArchivePath
 
 	// Extract binary to temp location.
 	binaryPath := filepath.Join(tmpDir, "binary")
 	fmt.Println("Extracting...")
-	if err := archive.ExtractBinary(archivePath, binaryPath); err != nil {
+	if err := archive.ExtractBinary(archivePath, binaryPath, cfg.ExtractionLimits); err != nil {
 		return false, err
 	}
 
+	// Verify the binary was built for this platform.
+	info, err := binfmt.Check(binaryPath, runtime.GOOS, runtime.GOARCH, cfg.PlatformCheck, func(err error) {
+		fmt.Printf("Warning: %v\n", err)
+	})
+	if err != nil {
+		return false, fmt.Errorf("refusing to install %s: %w", asset.Name, err)
+	}
+
 	// Calculate checksum.
 	checksum, err := archive.CalculateChecksum(binaryPath)
 	if err != nil {
@@ -296,28 +397,56 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 		}
 	}
 
-	// Replace executable.
+	// Replace executable. The new binary is staged beside the old one and
+	// renamed over it, so that a failure never leaves no executable at all.
 	fmt.Println("Installing...")
-	if err := os.Remove(effectivePath); err != nil && !os.IsNotExist(err) {
-		return false, fmt.Errorf("failed to remove old executable: %w", err)
-	}
-
-	if err := copyFile(binaryPath, effectivePath); err != nil {
+	stagingPath := filepath.Join(targetDir, "."+filepath.Base(effectivePath)+".execman-new")
+	if err := copyFile(binaryPath, stagingPath); err != nil {
+		_ = os.Remove(stagingPath)
 		return false, fmt.Errorf("failed to install new executable: %w", err)
 	}
 
 	// Set executable permissions.
 	// #nosec G302 -- Executables need 0755 permissions
-	if err := os.Chmod(effectivePath, 0755); err != nil {
+	if err := os.Chmod(stagingPath, 0755); err != nil {
+		_ = os.Remove(stagingPath)
 		return false, fmt.Errorf("failed to set executable permissions: %w", err)
 	}
 
+	if err := os.Rename(stagingPath, effectivePath); err != nil {
+		_ = os.Remove(stagingPath)
+		return false, fmt.Errorf("failed to install new executable: %w", err)
+	}
+
+	// Refresh companion files so they match the new version. Executables that
+	// were installed with companions keep them even without --companions.
+	if len(exec.Companions) > 0 || opts.Companions {
+		if err := companion.Remove(exec.Companions); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		companions, err := companion.Install(archivePath, opts.Name, cfg.ExtractionLimits)
+		if err != nil {
+			fmt.Printf("Warning: failed to install companion files: %v\n", err)
+		}
+		exec.Companions = companions
+	}
+
 	// Update registry - if we replaced the symlink itself, update the path.
 	if symlinkInfo != nil && symlinkInfo.IsSymlink && symlinkAction == symlink.ActionReplaceSymlink {
 		exec.Path = effectivePath
 	}
 	exec.Version = latestVersion
 	exec.Checksum = checksum
+	exec.Format = ""
+	if info != nil {
+		exec.Format = info.String()
+	}
+	exec.Prerelease = release.Prerelease
+	exec.Signature = fetched.Signature
+	exec.Provenance = fetched.Provenance
+	if fetched.Key != nil {
+		reg.PinKey(exec.Source, fetched.Key)
+	}
 	exec.InstalledAt = time.Now()
 
 	reg.Add(opts.Name, exec)
@@ -327,24 +456,6 @@ func updateOne(reg *registry.Registry, opts Options) (bool, error) {
 
 	fmt.Printf("\nSuccessfully updated %s to %s\n", opts.Name, latestVersion)
 
-	// Ask about cleanup.
-	if !opts.Yes {
-		fmt.Print("Delete download archive? [Y/n]: ")
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.ToLower(strings.TrimSpace(response))
-		if response == "" || response == "y" || response == "yes" {
-			// tmpDir cleanup is handled by defer
-			fmt.Println("Archive deleted.")
-		} else {
-			// Move archive to current directory before tmpDir cleanup.
-			finalPath := filepath.Join(".", asset.Name)
-			if err := copyFile(archivePath, finalPath); err == nil {
-				fmt.Printf("Archive saved to %s\n", finalPath)
-			}
-		}
-	}
-
 	return true, nil
 }
 
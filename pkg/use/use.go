@@ -0,0 +1,256 @@
+// Package use implements the use command, which switches the installed
+// version of an executable to another version kept in the versioned store.
+package use
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/config"
+	"github.com/sfkleach/execman/pkg/dircheck"
+	"github.com/sfkleach/execman/pkg/install"
+	"github.com/sfkleach/execman/pkg/manifest"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// Options represents the use command options.
+type Options struct {
+	Name string
+	// Version selects the version to use: an exact tag, or a constraint such
+	// as "1.5" that picks the newest matching version installed.
+	Version string
+	// Yes replaces a file that execman does not manage without asking.
+	Yes bool
+}
+
+// NewUseCommand creates the use command.
+func NewUseCommand() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "use <executable> <version>",
+		Short: "Switch an executable to another installed version",
+		Long: `Make another installed version of an executable the one on PATH. The version
+may be an exact tag, or a partial version or constraint, such as 1.5, which
+picks the newest matching version in the versioned store. The version that
+was on PATH is kept in the store, so that it can be switched back to. If no
+version is on PATH, the chosen one is installed into its recorded location or
+the default install directory, as install would.
+
+Versions are added to the store with 'execman install --store'.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return Run(Options{Name: args[0], Version: args[1], Yes: yes})
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Replace a file that execman does not manage without asking")
+
+	return cmd
+}
+
+// Run executes the use command.
+func Run(opts Options) error {
+	// Load registry and config.
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	active, hasActive := reg.Get(opts.Name)
+	versions := reg.ListVersions(opts.Name)
+	if !hasActive && len(versions) == 0 {
+		return fmt.Errorf("executable %q is not managed by execman", opts.Name)
+	}
+	installed := append([]string{}, versions...)
+	if hasActive {
+		installed = append(installed, active.Version)
+	}
+
+	version, err := Pick(installed, opts.Version)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		return fmt.Errorf("no installed version of %s matches %s; add it with 'execman install --store'", opts.Name, opts.Version)
+	}
+	if hasActive && version == active.Version {
+		fmt.Printf("%s %s is already in use.\n", opts.Name, version)
+		return nil
+	}
+
+	// Without an installed version, install where the chosen version was
+	// last installed, or else into the default install directory.
+	var targetPath, location string
+	if hasActive {
+		targetPath = active.Path
+	} else {
+		chosen, _ := reg.GetVersion(opts.Name, version)
+		into := ""
+		if chosen.Location != "" {
+			into = "@" + chosen.Location
+		}
+		dir, name, err := cfg.ResolveInstallDir(into)
+		if err != nil {
+			return err
+		}
+		targetPath = filepath.Join(dir, opts.Name)
+		location = name
+	}
+
+	// Never overwrite another managed executable, and only replace a file
+	// that execman does not manage with consent.
+	ok, err := install.Claim(reg, opts.Name, targetPath, opts.Yes, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Switch cancelled.")
+		return nil
+	}
+	if err := dircheck.Preflight(targetPath, cfg.InstallDirCheck, func(issue dircheck.Issue) {
+		fmt.Printf("Warning: %s\n", issue)
+	}); err != nil {
+		return fmt.Errorf("refusing to install into %s: %w", filepath.Dir(targetPath), err)
+	}
+
+	if err := Switch(reg, opts.Name, version, targetPath); err != nil {
+		return err
+	}
+	if !hasActive {
+		exec, _ := reg.Get(opts.Name)
+		exec.Location = location
+	}
+	if err := reg.Save(); err != nil {
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+
+	fmt.Printf("Now using %s %s at %s\n", opts.Name, version, targetPath)
+	return nil
+}
+
+// Pick chooses the installed version that a version argument names: the
+// exact tag, with or without a "v" prefix, or else the newest installed
+// version that satisfies it as a constraint. It returns "" if none does.
+func Pick(installed []string, want string) (string, error) {
+	for _, v := range installed {
+		if v == want || v == "v"+want {
+			return v, nil
+		}
+	}
+	c, err := manifest.ParseConstraint(want)
+	if err != nil {
+		return "", err
+	}
+	return c.Select(installed, true), nil
+}
+
+// Switch makes a version from the store the installed executable at
+// targetPath. The version that was installed there moves into the store in
+// its place, keeping its record. Companion files, aliases and the install
+// location stay with the installed executable. The registry is updated but
+// not saved.
+func Switch(reg *registry.Registry, name, version, targetPath string) error {
+	chosen, ok := reg.GetVersion(name, version)
+	if !ok {
+		return fmt.Errorf("%s %s is not in the store", name, version)
+	}
+
+	// Refuse to put a tampered copy on PATH.
+	checksum, err := archive.CalculateChecksum(chosen.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s %s from the store: %w", name, version, err)
+	}
+	if checksum != chosen.Checksum {
+		return fmt.Errorf("%s %s in the store has been modified: checksum %s, recorded %s", name, version, checksum, chosen.Checksum)
+	}
+
+	// Keep the version being replaced in the store.
+	active, hasActive := reg.Get(name)
+	var kept *registry.Executable
+	if hasActive {
+		if _, err := os.Stat(active.Path); err == nil {
+			dir, err := store.Dir(name, active.Version)
+			if err != nil {
+				return err
+			}
+			storedPath := filepath.Join(dir, name)
+			if err := place(active.Path, storedPath); err != nil {
+				return fmt.Errorf("failed to keep %s %s in the store: %w", name, active.Version, err)
+			}
+			copied := *active
+			copied.Path = storedPath
+			copied.Location = ""
+			copied.Companions = nil
+			copied.Aliases = nil
+			kept = &copied
+		} else {
+			fmt.Printf("Warning: %s %s is missing from %s, so it is not kept\n", name, active.Version, active.Path)
+		}
+	}
+
+	if err := place(chosen.Path, targetPath); err != nil {
+		// The replaced version is still installed, so drop its copy.
+		if kept != nil {
+			_ = os.Remove(kept.Path)
+			store.RemoveEmpty(kept.Path)
+		}
+		return fmt.Errorf("failed to install %s %s: %w", name, version, err)
+	}
+	if kept != nil {
+		reg.AddVersion(name, kept)
+	}
+
+	record := *chosen
+	record.Path = targetPath
+	if hasActive {
+		record.Location = active.Location
+		record.Companions = active.Companions
+		record.Aliases = active.Aliases
+	}
+	reg.Add(name, &record)
+	reg.RemoveVersion(name, version)
+
+	// The version's directory in the store is now empty.
+	if err := os.Remove(chosen.Path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove %s: %v\n", chosen.Path, err)
+	}
+	store.RemoveEmpty(chosen.Path)
+	return nil
+}
+
+// place copies an executable to dst, replacing any file there atomically by
+// staging the copy beside it first.
+func place(src, dst string) error {
+	// #nosec G301 -- Install and store directories need 0755 for executables to be accessible
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	stagingPath := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".execman-new")
+	// #nosec G304 -- Copying between paths recorded in the registry
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	// #nosec G306 -- Executables need 0755 permissions
+	if err := os.WriteFile(stagingPath, data, 0755); err != nil {
+		_ = os.Remove(stagingPath)
+		return err
+	}
+	if err := os.Rename(stagingPath, dst); err != nil {
+		_ = os.Remove(stagingPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package use
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/sfkleach/execman/pkg/store"
+)
+
+func TestPick(t *testing.T) {
+	installed := []string{"v1.5.2", "v1.5.7", "v1.9.0", "v2.0.0-rc.1"}
+
+	tests := []struct {
+		want string
+		got  string
+	}{
+		{want: "v1.5.2", got: "v1.5.2"},
+		{want: "1.9.0", got: "v1.9.0"},
+		{want: "1.5", got: "v1.5.7"},
+		{want: "1", got: "v1.9.0"},
+		{want: "^1.5", got: "v1.9.0"},
+		{want: "v2.0.0-rc.1", got: "v2.0.0-rc.1"},
+		{want: "1.7", got: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := Pick(installed, tt.want)
+			if err != nil {
+				t.Fatalf("Pick(%q) error: %v", tt.want, err)
+			}
+			if got != tt.got {
+				t.Errorf("Pick(%q) = %q, want %q", tt.want, got, tt.got)
+			}
+		})
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-use-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+	t.Setenv("APPDATA", filepath.Join(tmpDir, "data"))
+
+	// Install v1.9.0 on PATH and keep v1.5.7 in the store.
+	binDir := filepath.Join(tmpDir, "bin")
+	activePath := filepath.Join(binDir, "tool")
+	storeDir, err := store.Dir("tool", "v1.5.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedPath := filepath.Join(storeDir, "tool")
+	for path, content := range map[string]string{activePath: "new", storedPath: "old"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum := func(path string) string {
+		sum, err := archive.CalculateChecksum(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := "https://github.com/owner/tool"
+	companions := []registry.CompanionFile{{Kind: "man", Path: "/man/tool.1"}}
+	reg.Add("tool", &registry.Executable{Source: source, Version: "v1.9.0", Path: activePath, Checksum: checksum(activePath), Location: "work", Companions: companions})
+	reg.AddVersion("tool", &registry.Executable{Source: source, Version: "v1.5.7", Path: storedPath, Checksum: checksum(storedPath)})
+
+	if err := Switch(reg, "tool", "v1.5.7", activePath); err != nil {
+		t.Fatalf("Switch() error: %v", err)
+	}
+
+	// The stored version is now on PATH, with the location and companions.
+	active, _ := reg.Get("tool")
+	if active.Version != "v1.5.7" || active.Path != activePath || active.Location != "work" || len(active.Companions) != 1 {
+		t.Errorf("installed executable = %+v, want v1.5.7 at %s", active, activePath)
+	}
+	if data, _ := os.ReadFile(activePath); string(data) != "old" {
+		t.Errorf("%s holds %q, want the stored version", activePath, data)
+	}
+	if _, err := os.Stat(storeDir); !os.IsNotExist(err) {
+		t.Errorf("the store directory of v1.5.7 was not removed")
+	}
+
+	// The version that was on PATH is kept in the store.
+	kept, ok := reg.GetVersion("tool", "v1.9.0")
+	if !ok {
+		t.Fatalf("v1.9.0 was not kept in the store")
+	}
+	if data, _ := os.ReadFile(kept.Path); string(data) != "new" {
+		t.Errorf("%s holds %q, want the replaced version", kept.Path, data)
+	}
+	if kept.Location != "" || kept.Companions != nil {
+		t.Errorf("kept version = %+v, want no location or companions", kept)
+	}
+	if _, ok := reg.GetVersion("tool", "v1.5.7"); ok {
+		t.Errorf("v1.5.7 is still recorded in the store")
+	}
+
+	// A modified copy in the store is refused.
+	if err := os.WriteFile(kept.Path, []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Switch(reg, "tool", "v1.9.0", activePath); err == nil {
+		t.Errorf("Switch() accepted a modified copy from the store")
+	}
+}
+
+func TestSwitchFailure(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-use-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+	t.Setenv("APPDATA", filepath.Join(tmpDir, "data"))
+
+	activePath := filepath.Join(tmpDir, "tool")
+	storeDir, err := store.Dir("tool", "v1.5.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedPath := filepath.Join(storeDir, "tool")
+	if err := os.MkdirAll(storeDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{activePath: "new", storedPath: "old"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum, err := archive.CalculateChecksum(storedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := registry.LoadFrom(filepath.Join(tmpDir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Add("tool", &registry.Executable{Source: "https://github.com/owner/tool", Version: "v1.9.0", Path: activePath})
+	reg.AddVersion("tool", &registry.Executable{Source: "https://github.com/owner/tool", Version: "v1.5.7", Path: storedPath, Checksum: checksum})
+
+	// The target cannot be written, since its directory is a file.
+	if err := Switch(reg, "tool", "v1.5.7", filepath.Join(activePath, "tool")); err == nil {
+		t.Fatal("Switch() into an unwritable directory succeeded")
+	}
+
+	// The version that is still installed is not left in the store.
+	if _, ok := reg.GetVersion("tool", "v1.9.0"); ok {
+		t.Errorf("v1.9.0 was recorded in the store")
+	}
+	keptDir, err := store.Dir("tool", "v1.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keptDir); !os.IsNotExist(err) {
+		t.Errorf("the copy of v1.9.0 was left in the store")
+	}
+	if active, _ := reg.Get("tool"); active.Version != "v1.9.0" || active.Path != activePath {
+		t.Errorf("installed executable = %+v, want v1.9.0 unchanged", active)
+	}
+	if _, ok := reg.GetVersion("tool", "v1.5.7"); !ok {
+		t.Errorf("v1.5.7 was dropped from the store")
+	}
+}
@@ -0,0 +1,211 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sfkleach/execman/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+// Options represents the verify command options.
+type Options struct {
+	Name          string
+	JSON          bool
+	WriteSnapshot bool
+	SnapshotPath  string
+	KeyPath       string
+}
+
+// NewVerifyCommand creates the verify command.
+func NewVerifyCommand() *cobra.Command {
+	var jsonOutput bool
+	var writeSnapshot bool
+	var snapshotPath string
+	var keyPath string
+
+	cmd := &cobra.Command{
+		Use:   "verify [executable]",
+		Short: "Audit managed files for tampering",
+		Long: `Audit managed executables, their companion files and aliases, and the
+versions kept in the store, without using the network. Each file's checksum is
+recomputed and compared with the registry, and its mode, owner and symlink
+target are checked; each alias must still link to its executable. If a
+snapshot has been written, the registry is also compared with it, so that
+tampering with the registry itself is detected. Any sign of tampering gives
+exit code 2.
+
+The snapshot is authenticated with a key that, by default, is kept with
+execman's own configuration. Anyone who can rewrite the registry can then also
+read that key and write a matching snapshot, so the default only catches
+changes made without it. To detect a compromised account, keep the key where
+that account cannot read it and pass it with --key.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := Options{
+				JSON:          jsonOutput,
+				WriteSnapshot: writeSnapshot,
+				SnapshotPath:  snapshotPath,
+				KeyPath:       keyPath,
+			}
+			if len(args) > 0 {
+				opts.Name = args[0]
+			}
+			if opts.Name != "" && opts.WriteSnapshot {
+				return fmt.Errorf("cannot write a snapshot of a single executable")
+			}
+			cmd.SilenceUsage = true
+			return Run(opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the report as JSON")
+	cmd.Flags().BoolVar(&writeSnapshot, "write-snapshot", false, "Record an HMAC-authenticated snapshot for later audits")
+	cmd.Flags().StringVar(&snapshotPath, "snapshot", "", "Snapshot file (default ~/.config/execman/snapshot.json)")
+	cmd.Flags().StringVar(&keyPath, "key", "", "HMAC key file for the snapshot (default ~/.config/execman/snapshot.key)")
+
+	return cmd
+}
+
+// Run executes the verify command.
+func Run(opts Options) error {
+	reg, err := registry.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	if opts.SnapshotPath == "" {
+		if opts.SnapshotPath, err = DefaultSnapshotPath(); err != nil {
+			return err
+		}
+	}
+	defaultKey := opts.KeyPath == ""
+	if defaultKey {
+		if opts.KeyPath, err = DefaultKeyPath(); err != nil {
+			return err
+		}
+	}
+
+	var names []string
+	if opts.Name != "" {
+		if _, ok := reg.Get(opts.Name); !ok && len(reg.ListVersions(opts.Name)) == 0 {
+			return fmt.Errorf("executable %q is not managed by execman", opts.Name)
+		}
+		names = []string{opts.Name}
+	} else {
+		names = managedNames(reg)
+	}
+
+	report, entries := Files(reg, names)
+
+	if opts.WriteSnapshot {
+		// A snapshot records the current state as trusted, so the files must
+		// match the registry. Differences from an older snapshot are expected,
+		// since the snapshot is being replaced.
+		if len(report.Findings) > 0 {
+			printReport(report, opts.JSON)
+			return fmt.Errorf("refusing to write a snapshot: %w", report)
+		}
+		if defaultKey {
+			// Warn on standard error, so that JSON output stays parseable.
+			fmt.Fprintf(os.Stderr, "Warning: the snapshot key %s can be read by whoever can change the registry, so the snapshot cannot detect them; keep the key elsewhere with --key\n", opts.KeyPath)
+		}
+		key, err := LoadKey(opts.KeyPath, true)
+		if err != nil {
+			return err
+		}
+		if err := NewSnapshot(entries, pinnedKeys(reg)).Save(opts.SnapshotPath, key); err != nil {
+			return err
+		}
+		report.Snapshot = opts.SnapshotPath
+		printReport(report, opts.JSON)
+		if !opts.JSON {
+			fmt.Printf("Snapshot written to %s.\n", opts.SnapshotPath)
+		}
+		return nil
+	}
+
+	// A key without a snapshot means the snapshot has been deleted.
+	_, snapshotErr := os.Stat(opts.SnapshotPath)
+	_, keyErr := os.Stat(opts.KeyPath)
+	if os.IsNotExist(snapshotErr) && keyErr == nil {
+		report.Findings = append(report.Findings, Finding{
+			Kind:    KindSnapshot,
+			Message: fmt.Sprintf("the snapshot %s is missing, but its key exists", opts.SnapshotPath),
+		})
+	} else if snapshotErr == nil {
+		report.Snapshot = opts.SnapshotPath
+		snapshot, err := loadSnapshot(opts.SnapshotPath, opts.KeyPath)
+		if errors.Is(err, ErrBadSnapshot) {
+			report.Findings = append(report.Findings, Finding{Kind: KindSnapshot, Message: err.Error()})
+		} else if err != nil {
+			return err
+		} else if snapshot != nil {
+			report.Findings = append(report.Findings, Compare(snapshot, entries, reg, opts.Name == "")...)
+		}
+	}
+
+	printReport(report, opts.JSON)
+	if len(report.Findings) > 0 {
+		return report
+	}
+	return nil
+}
+
+// managedNames returns the names of the installed executables and of those
+// with versions in the store, sorted.
+func managedNames(reg *registry.Registry) []string {
+	names := reg.List()
+	for name := range reg.Versions {
+		if _, ok := reg.Get(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadSnapshot loads the snapshot at path with the key at keyPath. A missing
+// key is reported as a sign of tampering, since a snapshot exists.
+func loadSnapshot(path, keyPath string) (*Snapshot, error) {
+	key, err := LoadKey(keyPath, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: the snapshot key %s is missing", ErrBadSnapshot, keyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadSnapshot(path, key)
+}
+
+// printReport prints the report as text or JSON.
+func printReport(report *Report, jsonOutput bool) {
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+		return
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Printf("✓ %d files verified", report.Checked)
+		if report.Snapshot != "" {
+			fmt.Printf(" against %s", report.Snapshot)
+		}
+		fmt.Println(".")
+		return
+	}
+
+	fmt.Println("Tamper report:")
+	for _, f := range report.Findings {
+		name := f.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("  %-15s %-9s %s\n", name, f.Kind, f.Message)
+	}
+	fmt.Printf("\n%d files checked, %d signs of tampering.\n", report.Checked, len(report.Findings))
+}
@@ -0,0 +1,193 @@
+package verify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/execman/pkg/scope"
+)
+
+// ErrBadSnapshot is returned when a snapshot's HMAC does not verify.
+var ErrBadSnapshot = errors.New("snapshot failed authentication")
+
+// Snapshot records the registry and the state of the managed files at a
+// point in time.
+type Snapshot struct {
+	CreatedAt   time.Time       `json:"created_at"`
+	Executables []SnapshotEntry `json:"executables"`
+	// Keys records the key pinned for each source.
+	Keys map[string]string `json:"keys,omitempty"`
+	// HMAC authenticates the rest of the snapshot.
+	HMAC string `json:"hmac,omitempty"`
+}
+
+// SnapshotEntry records one executable, or one version of it in the store.
+type SnapshotEntry struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version"`
+	// Stored is set for a version kept in the versioned store, rather than
+	// the installed executable.
+	Stored bool           `json:"stored,omitempty"`
+	Files  []SnapshotFile `json:"files"`
+}
+
+// key identifies the entry within a snapshot. The installed executable is
+// identified by its name, so that a change of version is reported, and a
+// stored version by its name and version.
+func (e SnapshotEntry) key() string {
+	if e.Stored {
+		return e.Name + "\x00" + e.Version
+	}
+	return e.Name
+}
+
+// describe names the entry in findings.
+func (e SnapshotEntry) describe() string {
+	if e.Stored {
+		return fmt.Sprintf("%s %s in the store", e.Name, e.Version)
+	}
+	return e.Name
+}
+
+// SnapshotFile records one managed file.
+type SnapshotFile struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	// Target is the file the path resolved to, if it was a symlink.
+	Target   string `json:"target,omitempty"`
+	Checksum string `json:"checksum"`
+	Mode     string `json:"mode"`
+}
+
+// DefaultSnapshotPath returns the snapshot file path of the current scope,
+// kept beside its registry.
+func DefaultSnapshotPath() (string, error) {
+	stateDir, err := scope.StateDir(scope.Current())
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "snapshot.json"), nil
+}
+
+// DefaultKeyPath returns the snapshot key file path of the current scope,
+// kept with its configuration.
+func DefaultKeyPath() (string, error) {
+	configDir, err := scope.ConfigDir(scope.Current())
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "snapshot.key"), nil
+}
+
+// LoadKey reads an HMAC key, stored as hex. If create is set and the file
+// does not exist, a new random key is written to it.
+func LoadKey(path string, create bool) ([]byte, error) {
+	// #nosec G304 -- Reading the key from a path the user chose
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate snapshot key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, fmt.Errorf("failed to create key directory: %w", err)
+		}
+		// Use 0600 permissions so that only the user can read the key.
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write snapshot key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < 16 {
+		return nil, fmt.Errorf("snapshot key %s is not at least 16 hex-encoded bytes", path)
+	}
+	return key, nil
+}
+
+// mac returns the HMAC of the snapshot, excluding its HMAC field.
+func (s *Snapshot) mac(key []byte) (string, error) {
+	unsigned := *s
+	unsigned.HMAC = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Save authenticates the snapshot with key and writes it to path.
+func (s *Snapshot) Save(path string, key []byte) error {
+	mac, err := s.mac(key)
+	if err != nil {
+		return err
+	}
+	s.HMAC = mac
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads a snapshot and checks its HMAC. It returns nil if there
+// is no snapshot at path.
+func LoadSnapshot(path string, key []byte) (*Snapshot, error) {
+	// #nosec G304 -- Reading the snapshot from a path the user chose
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	want, err := s.mac(key)
+	if err != nil {
+		return nil, err
+	}
+	got, err := hex.DecodeString(s.HMAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed HMAC", ErrBadSnapshot)
+	}
+	wantBytes, _ := hex.DecodeString(want)
+	if !hmac.Equal(got, wantBytes) {
+		return nil, fmt.Errorf("%w: the snapshot or the key has changed", ErrBadSnapshot)
+	}
+	return &s, nil
+}
+
+// NewSnapshot creates a snapshot of the observed executables and the keys
+// pinned in the registry.
+func NewSnapshot(entries []SnapshotEntry, keys map[string]string) *Snapshot {
+	if entries == nil {
+		entries = []SnapshotEntry{}
+	}
+	return &Snapshot{CreatedAt: time.Now().UTC(), Executables: entries, Keys: keys}
+}
@@ -0,0 +1,346 @@
+// Package verify audits managed executables and their companion files
+// offline, reporting any that have been tampered with since they were
+// installed. A snapshot of the registry and the files, authenticated with an
+// HMAC, lets later audits detect tampering with the registry itself.
+package verify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/dircheck"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// ExitTampered is the exit code when verification finds tampering.
+const ExitTampered = 2
+
+// Kinds of finding.
+const (
+	// KindMissing means a managed file no longer exists.
+	KindMissing = "missing"
+	// KindModified means a managed file's checksum has changed.
+	KindModified = "modified"
+	// KindMode means a managed file's mode lets other users change it, or an
+	// executable is no longer executable.
+	KindMode = "mode"
+	// KindOwner means a managed file belongs to another user.
+	KindOwner = "owner"
+	// KindSymlink means a managed path is a symlink to a different file than
+	// the snapshot recorded.
+	KindSymlink = "symlink"
+	// KindRegistry means the registry differs from the snapshot.
+	KindRegistry = "registry"
+	// KindSnapshot means the snapshot could not be authenticated.
+	KindSnapshot = "snapshot"
+)
+
+// fileKindExecutable is the kind recorded for the executable itself, as
+// opposed to its companion files.
+const fileKindExecutable = "executable"
+
+// fileKindAlias is the kind recorded for an alias of the executable.
+const fileKindAlias = "alias"
+
+// Finding is one sign of tampering.
+type Finding struct {
+	// Name is the executable concerned, if any.
+	Name string `json:"name,omitempty"`
+	// Path is the file concerned, if any.
+	Path    string `json:"path,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Report is the result of an audit. It is an error when it has findings.
+type Report struct {
+	// Checked is the number of files checked.
+	Checked int `json:"checked"`
+	// Snapshot is the snapshot the registry was compared with, if any.
+	Snapshot string    `json:"snapshot,omitempty"`
+	Findings []Finding `json:"findings"`
+}
+
+// Error implements the error interface.
+func (r *Report) Error() string {
+	if len(r.Findings) == 1 {
+		return "verification failed: " + r.Findings[0].Message
+	}
+	return fmt.Sprintf("verification failed: %d signs of tampering", len(r.Findings))
+}
+
+// ExitCode returns the process exit code for a report with findings.
+func (r *Report) ExitCode() int {
+	return ExitTampered
+}
+
+// Files checks the named executables, their companion files and aliases, and
+// their versions in the store, against the registry. It needs no network
+// access.
+func Files(reg *registry.Registry, names []string) (*Report, []SnapshotEntry) {
+	report := &Report{Findings: []Finding{}}
+	var entries []SnapshotEntry
+	for _, name := range names {
+		if exec, ok := reg.Get(name); ok {
+			entries = append(entries, checkExecutable(report, name, exec, false))
+		}
+		for _, version := range reg.ListVersions(name) {
+			exec, _ := reg.GetVersion(name, version)
+			entries = append(entries, checkExecutable(report, name, exec, true))
+		}
+	}
+	return report, entries
+}
+
+// checkExecutable checks an executable's files, adding any findings to the
+// report, and returns what it observed. Stored is set for a version in the
+// store.
+func checkExecutable(report *Report, name string, exec *registry.Executable, stored bool) SnapshotEntry {
+	entry := SnapshotEntry{Name: name, Source: exec.Source, Version: exec.Version, Stored: stored}
+
+	files := []registry.CompanionFile{{Kind: fileKindExecutable, Path: exec.Path, Checksum: exec.Checksum}}
+	files = append(files, exec.Companions...)
+	for _, file := range files {
+		report.Checked++
+		target, mode, findings := checkFile(name, file)
+		report.Findings = append(report.Findings, findings...)
+		entry.Files = append(entry.Files, SnapshotFile{
+			Kind:     file.Kind,
+			Path:     file.Path,
+			Target:   target,
+			Checksum: file.Checksum,
+			Mode:     mode.String(),
+		})
+	}
+	for _, alias := range exec.Aliases {
+		report.Checked++
+		target, mode, findings := checkAlias(name, alias, exec.Path)
+		report.Findings = append(report.Findings, findings...)
+		entry.Files = append(entry.Files, SnapshotFile{
+			Kind:   fileKindAlias,
+			Path:   alias,
+			Target: target,
+			Mode:   mode.String(),
+		})
+	}
+	return entry
+}
+
+// checkAlias checks that an alias is still a symlink to the executable at
+// path. It returns the file the alias resolves to and the symlink's mode.
+func checkAlias(name, alias, path string) (string, os.FileMode, []Finding) {
+	finding := func(kind, format string, args ...any) []Finding {
+		return []Finding{{Name: name, Path: alias, Kind: kind, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	info, err := os.Lstat(alias)
+	if err != nil {
+		return "", 0, finding(KindMissing, "%s is missing", alias)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", info.Mode(), finding(KindSymlink, "alias %s is no longer a symlink", alias)
+	}
+	target, err := filepath.EvalSymlinks(alias)
+	if err != nil {
+		return "", info.Mode(), finding(KindMissing, "%s is a symlink to a missing file", alias)
+	}
+	// A missing executable is reported by checkFile.
+	if want, err := filepath.EvalSymlinks(path); err == nil && target != want {
+		return target, info.Mode(), finding(KindSymlink, "alias %s resolves to %s instead of %s", alias, target, path)
+	}
+	return target, info.Mode(), nil
+}
+
+// checkFile checks one managed file against its recorded checksum, and checks
+// that other users cannot change it. It returns the file the path resolves to,
+// if it is a symlink, and the file's mode.
+func checkFile(name string, file registry.CompanionFile) (string, os.FileMode, []Finding) {
+	finding := func(kind, format string, args ...any) Finding {
+		return Finding{Name: name, Path: file.Path, Kind: kind, Message: fmt.Sprintf(format, args...)}
+	}
+
+	linkInfo, err := os.Lstat(file.Path)
+	if err != nil {
+		return "", 0, []Finding{finding(KindMissing, "%s is missing", file.Path)}
+	}
+	var target string
+	if linkInfo.Mode()&os.ModeSymlink != 0 {
+		target, err = filepath.EvalSymlinks(file.Path)
+		if err != nil {
+			return "", 0, []Finding{finding(KindMissing, "%s is a symlink to a missing file", file.Path)}
+		}
+	}
+
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return target, 0, []Finding{finding(KindMissing, "%s cannot be read: %v", file.Path, err)}
+	}
+
+	var findings []Finding
+	checksum, err := archive.CalculateChecksum(file.Path)
+	if err != nil {
+		findings = append(findings, finding(KindModified, "%s cannot be read: %v", file.Path, err))
+	} else if checksum != file.Checksum {
+		findings = append(findings, finding(KindModified, "%s has checksum %s, but %s was installed", file.Path, checksum, file.Checksum))
+	}
+
+	// File modes do not reflect Windows permissions.
+	if runtime.GOOS != "windows" {
+		if info.Mode().Perm()&0022 != 0 {
+			findings = append(findings, finding(KindMode, "%s has mode %s, so other users can change it", file.Path, info.Mode()))
+		}
+		if file.Kind == fileKindExecutable && info.Mode().Perm()&0100 == 0 {
+			findings = append(findings, finding(KindMode, "%s has mode %s and is no longer executable", file.Path, info.Mode()))
+		}
+	}
+	if uid, foreign := dircheck.ForeignOwner(info); foreign {
+		findings = append(findings, finding(KindOwner, "%s is owned by another user (uid %d)", file.Path, uid))
+	}
+	return target, info.Mode(), findings
+}
+
+// Compare reports how the registry and files, as observed by Files, differ
+// from a snapshot. Only the named executables are compared; with all set,
+// executables missing from either side are reported too.
+func Compare(snapshot *Snapshot, entries []SnapshotEntry, reg *registry.Registry, all bool) []Finding {
+	var findings []Finding
+	previous := map[string]SnapshotEntry{}
+	for _, entry := range snapshot.Executables {
+		previous[entry.key()] = entry
+	}
+	current := map[string]bool{}
+
+	for _, entry := range entries {
+		current[entry.key()] = true
+		old, ok := previous[entry.key()]
+		if !ok {
+			findings = append(findings, Finding{
+				Name:    entry.Name,
+				Kind:    KindRegistry,
+				Message: fmt.Sprintf("%s was added to the registry after the snapshot", entry.describe()),
+			})
+			continue
+		}
+		findings = append(findings, compareEntry(old, entry)...)
+	}
+
+	if all {
+		var removed []string
+		for key := range previous {
+			if !current[key] {
+				removed = append(removed, key)
+			}
+		}
+		sort.Strings(removed)
+		for _, key := range removed {
+			entry := previous[key]
+			findings = append(findings, Finding{
+				Name:    entry.Name,
+				Kind:    KindRegistry,
+				Message: fmt.Sprintf("%s was removed from the registry after the snapshot", entry.describe()),
+			})
+		}
+
+		keys := pinnedKeys(reg)
+		for _, source := range sortedKeys(snapshot.Keys, keys) {
+			if snapshot.Keys[source] != keys[source] {
+				findings = append(findings, Finding{
+					Kind:    KindRegistry,
+					Message: fmt.Sprintf("the key pinned for %s changed after the snapshot", source),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// compareEntry reports how an executable differs from its snapshot.
+func compareEntry(old, entry SnapshotEntry) []Finding {
+	var findings []Finding
+	registryFinding := func(format string, args ...any) {
+		findings = append(findings, Finding{Name: entry.Name, Kind: KindRegistry, Message: fmt.Sprintf(format, args...)})
+	}
+	if old.Source != entry.Source {
+		registryFinding("the source of %s changed from %s to %s after the snapshot", entry.describe(), old.Source, entry.Source)
+	}
+	if old.Version != entry.Version {
+		registryFinding("the version of %s changed from %s to %s after the snapshot", entry.describe(), old.Version, entry.Version)
+	}
+
+	oldFiles := map[string]SnapshotFile{}
+	for _, file := range old.Files {
+		oldFiles[file.Kind+"\x00"+file.Path] = file
+	}
+	for _, file := range entry.Files {
+		oldFile, ok := oldFiles[file.Kind+"\x00"+file.Path]
+		if !ok {
+			registryFinding("%s %s was recorded after the snapshot", file.Kind, file.Path)
+			continue
+		}
+		delete(oldFiles, file.Kind+"\x00"+file.Path)
+		if oldFile.Checksum != file.Checksum {
+			registryFinding("the recorded checksum of %s changed after the snapshot", file.Path)
+		}
+		if oldFile.Target != file.Target {
+			findings = append(findings, Finding{
+				Name:    entry.Name,
+				Path:    file.Path,
+				Kind:    KindSymlink,
+				Message: fmt.Sprintf("%s now resolves to %s instead of %s", file.Path, describeTarget(file.Target), describeTarget(oldFile.Target)),
+			})
+		}
+		if oldFile.Mode != file.Mode && file.Mode != os.FileMode(0).String() {
+			findings = append(findings, Finding{
+				Name:    entry.Name,
+				Path:    file.Path,
+				Kind:    KindMode,
+				Message: fmt.Sprintf("%s changed mode from %s to %s after the snapshot", file.Path, oldFile.Mode, file.Mode),
+			})
+		}
+	}
+	for _, oldFile := range old.Files {
+		if _, ok := oldFiles[oldFile.Kind+"\x00"+oldFile.Path]; ok {
+			registryFinding("%s %s was dropped from the registry after the snapshot", oldFile.Kind, oldFile.Path)
+		}
+	}
+	return findings
+}
+
+// describeTarget describes where a path resolves to.
+func describeTarget(target string) string {
+	if target == "" {
+		return "itself"
+	}
+	return target
+}
+
+// pinnedKeys returns the ID of the key pinned for each source.
+func pinnedKeys(reg *registry.Registry) map[string]string {
+	keys := map[string]string{}
+	for source, key := range reg.Keys {
+		if key != nil {
+			keys[source] = key.Type + ":" + key.ID
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of both maps, sorted.
+func sortedKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
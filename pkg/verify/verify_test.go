@@ -0,0 +1,408 @@
+package verify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sfkleach/execman/pkg/archive"
+	"github.com/sfkleach/execman/pkg/registry"
+)
+
+// newRegistry creates a registry managing one executable, "tool", with a man
+// page, in a temporary directory.
+func newRegistry(t *testing.T, dir string) (*registry.Registry, *registry.Executable) {
+	t.Helper()
+	reg, err := registry.LoadFrom(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toolPath := filepath.Join(dir, "tool")
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(toolPath, []byte("tool v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manPath := filepath.Join(dir, "tool.1")
+	if err := os.WriteFile(manPath, []byte(".TH TOOL 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	toolChecksum, err := archive.CalculateChecksum(toolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manChecksum, err := archive.CalculateChecksum(manPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &registry.Executable{
+		Source:     "https://github.com/owner/tool",
+		Version:    "v1.0.0",
+		Path:       toolPath,
+		Checksum:   toolChecksum,
+		Companions: []registry.CompanionFile{{Kind: "man", Path: manPath, Checksum: manChecksum}},
+	}
+	reg.Add("tool", exec)
+	return reg, exec
+}
+
+func findingKinds(findings []Finding) string {
+	var kinds []string
+	for _, f := range findings {
+		kinds = append(kinds, f.Kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+func TestFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func(t *testing.T, exec *registry.Executable)
+		wantKinds string
+		unixOnly  bool
+	}{
+		{
+			name:   "untouched",
+			tamper: func(t *testing.T, exec *registry.Executable) {},
+		},
+		{
+			name: "executable replaced",
+			tamper: func(t *testing.T, exec *registry.Executable) {
+				// #nosec G306 -- Test executable needs to be executable
+				if err := os.WriteFile(exec.Path, []byte("evil"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds: KindModified,
+		},
+		{
+			name: "companion deleted",
+			tamper: func(t *testing.T, exec *registry.Executable) {
+				if err := os.Remove(exec.Companions[0].Path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds: KindMissing,
+		},
+		{
+			name: "made world-writable",
+			tamper: func(t *testing.T, exec *registry.Executable) {
+				// #nosec G302 -- Deliberately unsafe mode under test
+				if err := os.Chmod(exec.Path, 0777); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds: KindMode,
+			unixOnly:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("file modes do not reflect Windows permissions")
+			}
+			tmpDir, err := os.MkdirTemp("", "execman-verify-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			reg, exec := newRegistry(t, tmpDir)
+			tt.tamper(t, exec)
+			report, entries := Files(reg, []string{"tool"})
+			if report.Checked != 2 {
+				t.Errorf("Files() checked %d files, want 2", report.Checked)
+			}
+			if got := findingKinds(report.Findings); got != tt.wantKinds {
+				t.Errorf("Files() findings = %q, want %q", got, tt.wantKinds)
+			}
+			if len(entries) != 1 || len(entries[0].Files) != 2 {
+				t.Errorf("Files() entries = %+v, want one executable with two files", entries)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-verify-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, exec := newRegistry(t, tmpDir)
+	keyPath := filepath.Join(tmpDir, "snapshot.key")
+	snapshotPath := filepath.Join(tmpDir, "snapshot.json")
+
+	key, err := LoadKey(keyPath, true)
+	if err != nil {
+		t.Fatalf("LoadKey() error: %v", err)
+	}
+	_, entries := Files(reg, []string{"tool"})
+	if err := NewSnapshot(entries, pinnedKeys(reg)).Save(snapshotPath, key); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// The key is reused once created.
+	again, err := LoadKey(keyPath, true)
+	if err != nil || string(again) != string(key) {
+		t.Fatalf("LoadKey() did not return the saved key")
+	}
+
+	snapshot, err := LoadSnapshot(snapshotPath, key)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error: %v", err)
+	}
+	if findings := Compare(snapshot, entries, reg, true); len(findings) != 0 {
+		t.Errorf("Compare() = %v, want no findings", findings)
+	}
+
+	// Replacing the binary and its recorded checksum together passes the
+	// file check, but not the snapshot.
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(exec.Path, []byte("evil"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	exec.Checksum, _ = archive.CalculateChecksum(exec.Path)
+	exec.Source = "https://github.com/attacker/tool"
+	report, entries := Files(reg, []string{"tool"})
+	if len(report.Findings) != 0 {
+		t.Errorf("Files() findings = %v, want none", report.Findings)
+	}
+	if got := findingKinds(Compare(snapshot, entries, reg, true)); got != KindRegistry+","+KindRegistry {
+		t.Errorf("Compare() findings = %q, want source and checksum changes", got)
+	}
+
+	// A modified snapshot, or the wrong key, fails authentication.
+	if _, err := LoadSnapshot(snapshotPath, []byte("another key of sixteen bytes")); !errors.Is(err, ErrBadSnapshot) {
+		t.Errorf("LoadSnapshot() with wrong key error = %v, want %v", err, ErrBadSnapshot)
+	}
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := strings.Replace(string(data), "owner/tool", "attacker/tool", 1)
+	if err := os.WriteFile(snapshotPath, []byte(forged), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSnapshot(snapshotPath, key); !errors.Is(err, ErrBadSnapshot) {
+		t.Errorf("LoadSnapshot() of forged snapshot error = %v, want %v", err, ErrBadSnapshot)
+	}
+}
+
+func TestCompareSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on Windows")
+	}
+	tmpDir, err := os.MkdirTemp("", "execman-verify-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, exec := newRegistry(t, tmpDir)
+
+	// Manage the executable through a symlink, as update allows.
+	original := exec.Path
+	link := filepath.Join(tmpDir, "tool-link")
+	if err := os.Symlink(original, link); err != nil {
+		t.Fatal(err)
+	}
+	exec.Path = link
+	_, entries := Files(reg, []string{"tool"})
+	snapshot := NewSnapshot(entries, nil)
+
+	// Point the symlink at an identical copy elsewhere.
+	copyPath := filepath.Join(tmpDir, "copy")
+	data, err := os.ReadFile(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(copyPath, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(copyPath, link); err != nil {
+		t.Fatal(err)
+	}
+
+	report, entries := Files(reg, []string{"tool"})
+	if len(report.Findings) != 0 {
+		t.Errorf("Files() findings = %v, want none", report.Findings)
+	}
+	if got := findingKinds(Compare(snapshot, entries, reg, true)); got != KindSymlink {
+		t.Errorf("Compare() findings = %q, want %q", got, KindSymlink)
+	}
+}
+
+func TestFilesAliases(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on Windows")
+	}
+
+	tests := []struct {
+		name      string
+		tamper    func(t *testing.T, alias string)
+		wantKinds string
+		// wantCompare are the findings against a snapshot taken before.
+		wantCompare string
+	}{
+		{
+			name:   "untouched",
+			tamper: func(t *testing.T, alias string) {},
+		},
+		{
+			name: "alias deleted",
+			tamper: func(t *testing.T, alias string) {
+				if err := os.Remove(alias); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds:   KindMissing,
+			wantCompare: KindSymlink,
+		},
+		{
+			name: "alias replaced by a file",
+			tamper: func(t *testing.T, alias string) {
+				if err := os.Remove(alias); err != nil {
+					t.Fatal(err)
+				}
+				// #nosec G306 -- Test executable needs to be executable
+				if err := os.WriteFile(alias, []byte("evil"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds:   KindSymlink,
+			wantCompare: KindSymlink + "," + KindMode,
+		},
+		{
+			name: "alias linked elsewhere",
+			tamper: func(t *testing.T, alias string) {
+				evil := filepath.Join(filepath.Dir(alias), "evil")
+				// #nosec G306 -- Test executable needs to be executable
+				if err := os.WriteFile(evil, []byte("evil"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Remove(alias); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink("evil", alias); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantKinds:   KindSymlink,
+			wantCompare: KindSymlink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "execman-verify-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			reg, exec := newRegistry(t, tmpDir)
+			alias := filepath.Join(tmpDir, "t")
+			if err := os.Symlink("tool", alias); err != nil {
+				t.Fatal(err)
+			}
+			exec.Aliases = []string{alias}
+			_, entries := Files(reg, []string{"tool"})
+			snapshot := NewSnapshot(entries, nil)
+
+			tt.tamper(t, alias)
+			report, entries := Files(reg, []string{"tool"})
+			if report.Checked != 3 {
+				t.Errorf("Files() checked %d files, want 3", report.Checked)
+			}
+			if got := findingKinds(report.Findings); got != tt.wantKinds {
+				t.Errorf("Files() findings = %q, want %q", got, tt.wantKinds)
+			}
+			if got := findingKinds(Compare(snapshot, entries, reg, true)); got != tt.wantCompare {
+				t.Errorf("Compare() findings = %q, want %q", got, tt.wantCompare)
+			}
+		})
+	}
+}
+
+func TestFilesStore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "execman-verify-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	reg, _ := newRegistry(t, tmpDir)
+	storedPath := filepath.Join(tmpDir, "store", "tool", "v0.9.0", "tool")
+	// #nosec G301 -- Test store directory
+	if err := os.MkdirAll(filepath.Dir(storedPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(storedPath, []byte("tool v0.9"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := archive.CalculateChecksum(storedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.AddVersion("tool", &registry.Executable{
+		Source:   "https://github.com/owner/tool",
+		Version:  "v0.9.0",
+		Path:     storedPath,
+		Checksum: checksum,
+	})
+	// A version kept only in the store is checked too.
+	reg.AddVersion("other", &registry.Executable{
+		Source:   "https://github.com/owner/other",
+		Version:  "v2.0.0",
+		Path:     storedPath,
+		Checksum: checksum,
+	})
+
+	names := managedNames(reg)
+	if strings.Join(names, ",") != "other,tool" {
+		t.Fatalf("managedNames() = %v, want other and tool", names)
+	}
+	report, entries := Files(reg, names)
+	if report.Checked != 4 || len(report.Findings) != 0 {
+		t.Fatalf("Files() checked %d files with findings %v, want 4 and none", report.Checked, report.Findings)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Files() entries = %+v, want the executable and two stored versions", entries)
+	}
+	snapshot := NewSnapshot(entries, nil)
+
+	// A stored version that is modified is reported.
+	// #nosec G306 -- Test executable needs to be executable
+	if err := os.WriteFile(storedPath, []byte("evil"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = Files(reg, []string{"tool"})
+	if got := findingKinds(report.Findings); got != KindModified {
+		t.Errorf("Files() findings = %q, want %q", got, KindModified)
+	}
+
+	// A stored version dropped from the registry differs from the snapshot,
+	// even though the installed executable is unchanged.
+	reg.RemoveVersion("tool", "v0.9.0")
+	reg.RemoveVersion("other", "v2.0.0")
+	_, entries = Files(reg, managedNames(reg))
+	findings := Compare(snapshot, entries, reg, true)
+	if got := findingKinds(findings); got != KindRegistry+","+KindRegistry {
+		t.Fatalf("Compare() findings = %q, want two removals", got)
+	}
+	if !strings.Contains(findings[1].Message, "tool v0.9.0 in the store") {
+		t.Errorf("Compare() finding = %q, want it to name the stored version", findings[1].Message)
+	}
+}